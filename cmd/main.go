@@ -29,24 +29,142 @@ package main
 
 import (
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/drdgvhbh/gitserver/internal"
+	"github.com/drdgvhbh/gitserver/internal/config"
+	"github.com/drdgvhbh/gitserver/internal/connection"
+	"github.com/drdgvhbh/gitserver/internal/credential"
+	"github.com/drdgvhbh/gitserver/internal/discovery"
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/jobs"
+	"github.com/drdgvhbh/gitserver/internal/key"
+	"github.com/drdgvhbh/gitserver/internal/lifecycle"
+	"github.com/drdgvhbh/gitserver/internal/mirror"
+	"github.com/drdgvhbh/gitserver/internal/registry"
+	"github.com/drdgvhbh/gitserver/internal/ssh"
+	"github.com/drdgvhbh/gitserver/internal/webhook"
 	"gopkg.in/src-d/go-billy.v4/osfs"
 )
 
 func main() {
-	fs := osfs.New("")
-	rootHandler := internal.NewRootHandler(fs)
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Environ())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys, err := key.NewStore(cfg.SSH.KeysFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	credentials, err := credential.NewStore(cfg.CredentialsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sandbox, err := git.NewSandbox(cfg.Roots...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	names, err := registry.NewStore(cfg.RegistryFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	trashDirectory := cfg.Trash.Directory
+	if trashDirectory == "" {
+		trashDirectory = filepath.Join(sandbox.Roots()[0], ".trash")
+	}
+	trashDirectory, err = filepath.Abs(trashDirectory)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Trashed repositories are only kept to be restored by hand
+	if err := sandbox.Exclude(trashDirectory); err != nil {
+		log.Fatal(err)
+	}
+
+	fs := osfs.New("/")
+	trash := lifecycle.NewTrash(fs, trashDirectory, cfg.Trash.Retention)
+	go trash.PurgeEvery(time.Hour)
+
+	reader := registry.NewReader(names, git.NewSandboxedReader(fs, sandbox))
+	runner := jobs.NewRunner(2)
+	bus := event.NewBus()
+	scanner := discovery.NewScanner(fs, sandbox.Roots(), names)
+	mirrors := mirror.NewScheduler(reader, scanner, runner, bus)
+	go mirrors.ScheduleEvery(time.Minute)
+	pusher := mirror.NewPusher(reader, 10*time.Second)
+	bus.Subscribe(pusher.Handle)
+	webhooks := webhook.NewDispatcher(reader, scanner, 10*time.Second)
+	bus.Subscribe(webhooks.Handle)
+	connections := connection.NewTracker()
+
+	rootHandler := internal.NewRootHandler(&internal.Options{
+		FileSystem:  fs,
+		Sandbox:     sandbox,
+		Registry:    names,
+		Keys:        keys,
+		APIKeys:     cfg.APIKeys,
+		Credentials: credentials,
+		Trash:       trash,
+		Jobs:        runner,
+		Mirrors:     mirrors,
+		Events:      bus,
+		Pusher:      pusher,
+		Webhooks:    webhooks,
+		Connections: connections,
+	})
+
+	if cfg.SSH.Address != "" {
+		sshServer := ssh.NewServer(reader, keys, bus)
+		sshServer.Addr = cfg.SSH.Address
+		hostKey, err := ssh.LoadHostKey(cfg.SSH.HostKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sshServer.AddHostKey(hostKey)
+
+		go func() {
+			log.Printf("SSH server is listening on %s\n", cfg.SSH.Address)
+			log.Fatal(sshServer.ListenAndServe())
+		}()
+	}
+
+	errs := make(chan error)
+	for _, address := range cfg.Addresses {
+		server := &http.Server{
+			Handler:      rootHandler,
+			Addr:         address,
+			WriteTimeout: cfg.WriteTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+		}
+
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listener = connections.Listen(listener)
+
+		go func() {
+			if cfg.TLS.Enabled() {
+				log.Printf("Server is listening on %s with TLS\n", server.Addr)
+				errs <- server.ServeTLS(listener, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+				return
+			}
 
-	server := &http.Server{
-		Handler:      rootHandler,
-		Addr:         "127.0.0.1:8000",
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+			log.Printf("Server is listening on %s\n", server.Addr)
+			errs <- server.Serve(listener)
+		}()
 	}
 
-	log.Printf("Server is listening on port %d\n", 8000)
-	log.Fatal(server.ListenAndServe())
+	log.Fatal(<-errs)
 }
@@ -0,0 +1,370 @@
+// Package archive writes the tree of a commit as a tarball or a zip file, the
+// way `git archive` does
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Format is the file format of an archive
+type Format string
+
+const (
+	// TarGz is a gzip compressed tarball
+	TarGz Format = "tar.gz"
+	// Zip is a zip file
+	Zip Format = "zip"
+)
+
+// ErrUnsupportedFormat is returned for formats other than TarGz and Zip
+var ErrUnsupportedFormat = errors.New("unsupported archive format")
+
+// ErrInvalidPrefix is returned for prefixes that would place entries outside
+// of the directory the archive is extracted in
+var ErrInvalidPrefix = errors.New("the prefix must be a relative path without ..")
+
+// Options control what goes into an archive
+type Options struct {
+	// Prefix is prepended to every path in the archive
+	Prefix string
+	// Paths restricts the archive to the files and directories at these
+	// paths. Everything is archived when it is empty.
+	Paths []string
+}
+
+// entry is a file or directory to be archived
+type entry struct {
+	name string
+	mode filemode.FileMode
+	file *object.File
+}
+
+// archiver adds entries to an archive of a specific format
+type archiver interface {
+	add(entry entry, modified time.Time) error
+	Close() error
+}
+
+// Write archives the tree of a commit
+func Write(writer io.Writer, format Format, commit *object.Commit, options *Options) error {
+	if options == nil {
+		options = &Options{}
+	}
+
+	if err := CheckPrefix(options.Prefix); err != nil {
+		return err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	var output archiver
+	switch format {
+	case TarGz:
+		output, err = newTarArchiver(writer, commit.Hash.String())
+	case Zip:
+		output, err = newZipArchiver(writer, commit.Hash.String())
+	default:
+		return ErrUnsupportedFormat
+	}
+	if err != nil {
+		return err
+	}
+
+	walker := &treeWalker{
+		output:   output,
+		prefix:   options.Prefix,
+		paths:    options.Paths,
+		modified: commit.Committer.When,
+	}
+	if err := walker.walk(tree, nil, nil); err != nil {
+		return err
+	}
+
+	return output.Close()
+}
+
+// CheckPrefix makes sure a prefix keeps every entry under the directory the
+// archive is extracted in
+func CheckPrefix(prefix string) error {
+	if strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "\\") {
+		return ErrInvalidPrefix
+	}
+
+	for _, element := range strings.FieldsFunc(prefix, func(r rune) bool {
+		return r == '/' || r == '\\'
+	}) {
+		if element == ".." || strings.HasSuffix(element, ":") {
+			return ErrInvalidPrefix
+		}
+	}
+
+	return nil
+}
+
+type treeWalker struct {
+	output   archiver
+	prefix   string
+	paths    []string
+	modified time.Time
+}
+
+// selected reports whether a path is in, contains or is contained by one of
+// the selected paths
+func (w *treeWalker) selected(name string, isDir bool) bool {
+	if len(w.paths) == 0 {
+		return true
+	}
+
+	for _, selected := range w.paths {
+		selected = strings.Trim(selected, "/")
+		if name == selected || strings.HasPrefix(name, selected+"/") {
+			return true
+		}
+		if isDir && strings.HasPrefix(selected, name+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// included reports whether a path is itself selected, rather than being an
+// ancestor of a selected path
+func (w *treeWalker) included(name string) bool {
+	if len(w.paths) == 0 {
+		return true
+	}
+
+	for _, selected := range w.paths {
+		selected = strings.Trim(selected, "/")
+		if name == selected || strings.HasPrefix(name, selected+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *treeWalker) walk(tree *object.Tree, directory []string, rules exportRules) error {
+	for _, treeEntry := range tree.Entries {
+		if treeEntry.Name != attributesFile || !treeEntry.Mode.IsFile() {
+			continue
+		}
+
+		file, err := tree.TreeEntryFile(&treeEntry)
+		if err != nil {
+			return err
+		}
+
+		reader, err := file.Reader()
+		if err != nil {
+			return err
+		}
+
+		local, err := readExportRules(reader, directory)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+
+		rules = append(append(exportRules{}, rules...), local...)
+	}
+
+	for _, treeEntry := range tree.Entries {
+		entryPath := append(append([]string{}, directory...), treeEntry.Name)
+		name := path.Join(entryPath...)
+		isDir := treeEntry.Mode == filemode.Dir || treeEntry.Mode == filemode.Submodule
+
+		if rules.ignores(entryPath, isDir) || !w.selected(name, isDir) {
+			continue
+		}
+
+		archived := entry{
+			name: path.Join(w.prefix, name),
+			mode: treeEntry.Mode,
+		}
+
+		switch treeEntry.Mode {
+		case filemode.Dir:
+			if w.included(name) {
+				if err := w.output.add(archived, w.modified); err != nil {
+					return err
+				}
+			}
+
+			subtree, err := tree.Tree(treeEntry.Name)
+			if err != nil {
+				return err
+			}
+
+			if err := w.walk(subtree, entryPath, rules); err != nil {
+				return err
+			}
+		case filemode.Submodule:
+			// The commits of submodules are not in this repository, so like
+			// git we archive them as empty directories
+			archived.mode = filemode.Dir
+			if err := w.output.add(archived, w.modified); err != nil {
+				return err
+			}
+		default:
+			file, err := tree.TreeEntryFile(&treeEntry)
+			if err != nil {
+				return err
+			}
+
+			archived.file = file
+			if err := w.output.add(archived, w.modified); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileMode converts a git file mode to the mode files are extracted with
+func fileMode(mode filemode.FileMode) os.FileMode {
+	switch mode {
+	case filemode.Dir:
+		return os.ModeDir | 0755
+	case filemode.Executable:
+		return 0755
+	case filemode.Symlink:
+		return os.ModeSymlink | 0777
+	default:
+		return 0644
+	}
+}
+
+type tarArchiver struct {
+	gzipWriter *gzip.Writer
+	tarWriter  *tar.Writer
+}
+
+func newTarArchiver(writer io.Writer, commit string) (archiver, error) {
+	gzipWriter := gzip.NewWriter(writer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	// git records the commit in a global extended header, which
+	// `git get-tar-commit-id` reads back
+	err := tarWriter.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": commit},
+		Format:     tar.FormatPAX,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarArchiver{gzipWriter: gzipWriter, tarWriter: tarWriter}, nil
+}
+
+func (a *tarArchiver) add(entry entry, modified time.Time) error {
+	header := &tar.Header{
+		Name:    entry.name,
+		Mode:    int64(fileMode(entry.mode).Perm()),
+		ModTime: modified,
+	}
+
+	switch entry.mode {
+	case filemode.Dir:
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+		return a.tarWriter.WriteHeader(header)
+	case filemode.Symlink:
+		target, err := entry.file.Contents()
+		if err != nil {
+			return err
+		}
+
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = target
+		return a.tarWriter.WriteHeader(header)
+	}
+
+	header.Typeflag = tar.TypeReg
+	header.Size = entry.file.Size
+	if err := a.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	return copyContents(a.tarWriter, entry.file)
+}
+
+func (a *tarArchiver) Close() error {
+	if err := a.tarWriter.Close(); err != nil {
+		return err
+	}
+
+	return a.gzipWriter.Close()
+}
+
+type zipArchiver struct {
+	zipWriter *zip.Writer
+}
+
+func newZipArchiver(writer io.Writer, commit string) (archiver, error) {
+	zipWriter := zip.NewWriter(writer)
+
+	// git stores the commit as the comment of the archive
+	if err := zipWriter.SetComment(commit); err != nil {
+		return nil, err
+	}
+
+	return &zipArchiver{zipWriter: zipWriter}, nil
+}
+
+func (a *zipArchiver) add(entry entry, modified time.Time) error {
+	header := &zip.FileHeader{
+		Name:     entry.name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	}
+	header.SetMode(fileMode(entry.mode))
+
+	if entry.mode == filemode.Dir {
+		header.Name += "/"
+		header.Method = zip.Store
+		_, err := a.zipWriter.CreateHeader(header)
+		return err
+	}
+
+	writer, err := a.zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// Symbolic links are stored with their target as content
+	return copyContents(writer, entry.file)
+}
+
+func (a *zipArchiver) Close() error {
+	return a.zipWriter.Close()
+}
+
+func copyContents(writer io.Writer, file *object.File) error {
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(writer, reader)
+	return err
+}
@@ -0,0 +1,126 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/archive"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// newCommit stores a commit with files marked export-ignore at the root and
+// in a subdirectory
+func newCommit(t *testing.T) *object.Commit {
+	storage := memory.NewStorage()
+
+	docs := testutil.StoreObject(t, storage, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "guide.md", Mode: filemode.Regular, Hash: testutil.StoreBlob(t, storage, "guide")},
+	}})
+	src := testutil.StoreObject(t, storage, &object.Tree{Entries: []object.TreeEntry{
+		{Name: ".gitattributes", Mode: filemode.Regular,
+			Hash: testutil.StoreBlob(t, storage, "generated.go export-ignore\n")},
+		{Name: "generated.go", Mode: filemode.Regular, Hash: testutil.StoreBlob(t, storage, "generated")},
+		{Name: "main.go", Mode: filemode.Executable, Hash: testutil.StoreBlob(t, storage, "main")},
+	}})
+	root := testutil.StoreObject(t, storage, &object.Tree{Entries: []object.TreeEntry{
+		{Name: ".gitattributes", Mode: filemode.Regular,
+			Hash: testutil.StoreBlob(t, storage, "secret.txt export-ignore\ndocs export-ignore\n")},
+		{Name: "README.md", Mode: filemode.Regular, Hash: testutil.StoreBlob(t, storage, "readme")},
+		{Name: "docs", Mode: filemode.Dir, Hash: docs},
+		{Name: "secret.txt", Mode: filemode.Regular, Hash: testutil.StoreBlob(t, storage, "secret")},
+		{Name: "src", Mode: filemode.Dir, Hash: src},
+	}})
+
+	signature := object.Signature{Name: "Ryan Lee", Email: "ryanleecode@gmail.com", When: time.Now()}
+	hash := testutil.StoreObject(t, storage, &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   "Initial commit",
+		TreeHash:  root,
+	})
+
+	commit, err := object.GetCommit(storage, hash)
+	assert.NoError(t, err)
+
+	return commit
+}
+
+func TestTarballLeavesOutExportIgnoredPaths(t *testing.T) {
+	assert := assert.New(t)
+	commit := newCommit(t)
+
+	var buffer bytes.Buffer
+	err := archive.Write(&buffer, archive.TarGz, commit, &archive.Options{Prefix: "project/"})
+	assert.NoError(err)
+
+	gzipReader, err := gzip.NewReader(&buffer)
+	assert.NoError(err)
+	tarReader := tar.NewReader(gzipReader)
+
+	var names []string
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			assert.Equal(commit.Hash.String(), header.PAXRecords["comment"])
+			continue
+		}
+
+		names = append(names, header.Name)
+	}
+
+	assert.Equal([]string{
+		"project/.gitattributes",
+		"project/README.md",
+		"project/src/",
+		"project/src/.gitattributes",
+		"project/src/main.go",
+	}, names)
+}
+
+func TestZipOfASubdirectory(t *testing.T) {
+	assert := assert.New(t)
+	commit := newCommit(t)
+
+	var buffer bytes.Buffer
+	err := archive.Write(&buffer, archive.Zip, commit, &archive.Options{Paths: []string{"src"}})
+	assert.NoError(err)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	assert.NoError(err)
+	assert.Equal(commit.Hash.String(), zipReader.Comment)
+
+	var names []string
+	for _, file := range zipReader.File {
+		names = append(names, file.Name)
+	}
+
+	assert.Equal([]string{"src/", "src/.gitattributes", "src/main.go"}, names)
+	assert.Equal(uint32(0755), uint32(zipReader.File[2].Mode().Perm()))
+}
+
+func TestWriteRejectsPrefixesOutsideTheArchive(t *testing.T) {
+	commit := newCommit(t)
+
+	for _, prefix := range []string{"../", "project/../../", "/etc/", `..\project\`, "C:/project/"} {
+		var buffer bytes.Buffer
+		err := archive.Write(&buffer, archive.Zip, commit, &archive.Options{Prefix: prefix})
+		assert.Equal(t, archive.ErrInvalidPrefix, err, prefix)
+	}
+
+	assert.NoError(t, archive.CheckPrefix("project-1.0/"))
+	assert.NoError(t, archive.CheckPrefix("releases/..project/"))
+}
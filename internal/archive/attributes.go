@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+)
+
+const attributesFile = ".gitattributes"
+
+// exportRule sets or unsets the export-ignore attribute for a pattern
+type exportRule struct {
+	pattern gitignore.Pattern
+	ignore  bool
+}
+
+// exportRules holds the export-ignore rules of the .gitattributes files seen
+// so far. Rules read later, from deeper directories, take precedence.
+type exportRules []exportRule
+
+// readExportRules parses the export-ignore attributes of a .gitattributes
+// file found in the directory domain
+func readExportRules(reader io.Reader, domain []string) (exportRules, error) {
+	var rules exportRules
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Negative patterns are forbidden in attribute files
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") ||
+			strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+
+		for _, attribute := range fields[1:] {
+			switch attribute {
+			case "export-ignore":
+				rules = append(rules, exportRule{
+					pattern: gitignore.ParsePattern(fields[0], domain),
+					ignore:  true,
+				})
+			case "-export-ignore", "!export-ignore":
+				rules = append(rules, exportRule{
+					pattern: gitignore.ParsePattern(fields[0], domain),
+					ignore:  false,
+				})
+			}
+		}
+	}
+
+	return rules, scanner.Err()
+}
+
+// ignores reports whether a path is left out of archives
+func (rules exportRules) ignores(path []string, isDir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].pattern.Match(path, isDir) != gitignore.NoMatch {
+			return rules[i].ignore
+		}
+	}
+
+	return false
+}
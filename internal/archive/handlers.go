@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// An archive of the tree at a revision
+// swagger:response GetArchiveOkResponse
+type GetArchiveOkResponse struct {
+	// in: body
+	Body []byte
+}
+
+// swagger:parameters getArchive
+type GetArchiveParams struct {
+	// The branch, tag or commit to archive
+	//
+	// in: path
+	// required: true
+	Revision string `json:"revision"`
+	// The archive format, either tar.gz or zip
+	//
+	// in: path
+	// required: true
+	Format string `json:"format"`
+	// A directory every path in the archive is placed under. It must be
+	// relative and cannot contain ..
+	//
+	// in: query
+	Prefix string `json:"prefix"`
+	// The files and directories to archive. The whole tree is archived when
+	// none are specified.
+	//
+	// in: query
+	Path []string `json:"path"`
+}
+
+var contentTypes = map[Format]string{
+	TarGz: "application/gzip",
+	Zip:   "application/zip",
+}
+
+// NewGetArchiveHandler streams an archive of the tree at a revision
+func NewGetArchiveHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repositoryPath := vars["directory"]
+		repository, _ := reader.Open(repositoryPath)
+		query := request.URL.Query()
+
+		format := Format(vars["format"])
+		contentType, ok := contentTypes[format]
+		if !ok {
+			response.WriteError(writer, http.StatusBadRequest, ErrUnsupportedFormat)
+			return
+		}
+
+		prefix := query.Get("prefix")
+		if err := CheckPrefix(prefix); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		revision := vars["revision"]
+		hash, err := repository.ResolveRevision(revision)
+		if err != nil {
+			response.WriteError(writer, http.StatusNotFound,
+				fmt.Errorf("revision %s not found", revision))
+			return
+		}
+
+		commit, err := object.GetCommit(repository.Storer(), plumbing.Hash(hash))
+		if err != nil {
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+
+		filename := fmt.Sprintf("%s-%s.%s",
+			path.Base(repositoryPath), strings.Replace(revision, "/", "-", -1), format)
+		writer.Header().Set("Content-Type", contentType)
+		writer.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		err = Write(writer, format, commit, &Options{
+			Prefix: prefix,
+			Paths:  query["path"],
+		})
+		if err != nil {
+			log.Printf("%s: archiving %s: %s\n", repositoryPath, revision, err)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package bundle reads and writes git bundles, which carry references along
+// with the objects they need in a single file
+package bundle
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/pack"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+const signature = "# v2 git bundle"
+
+// ErrInvalidBundle is returned when a bundle cannot be parsed
+var ErrInvalidBundle = errors.New("not a v2 git bundle")
+
+// MissingPrerequisitesError is returned when a bundle depends on commits the
+// repository does not have
+type MissingPrerequisitesError struct {
+	Hashes []plumbing.Hash
+}
+
+func (err *MissingPrerequisitesError) Error() string {
+	missing := make([]string, len(err.Hashes))
+	for i, hash := range err.Hashes {
+		missing[i] = hash.String()
+	}
+
+	return fmt.Sprintf("repository lacks prerequisite commits: %s",
+		strings.Join(missing, ", "))
+}
+
+// IncompleteError is returned when a bundle lacks the object a reference it
+// carries points to
+type IncompleteError struct {
+	Reference *plumbing.Reference
+}
+
+func (err *IncompleteError) Error() string {
+	return fmt.Sprintf("bundle is missing %s for %s", err.Reference.Hash(), err.Reference.Name())
+}
+
+// RejectedError is returned when references of a bundle cannot be updated.
+// None of the references are updated then.
+type RejectedError struct {
+	// Reasons holds why each rejected reference was rejected
+	Reasons map[plumbing.ReferenceName]string
+}
+
+func (err *RejectedError) Error() string {
+	rejected := make([]string, 0, len(err.Reasons))
+	for name, reason := range err.Reasons {
+		rejected = append(rejected, fmt.Sprintf("%s (%s)", name, reason))
+	}
+	sort.Strings(rejected)
+
+	return fmt.Sprintf("rejected %s", strings.Join(rejected, ", "))
+}
+
+// UnbundleOptions control how the references of a bundle are updated
+type UnbundleOptions struct {
+	// Force updates references whose new commit does not descend from their
+	// current one, and tags that already exist
+	Force bool
+}
+
+// Header lists what a bundle depends on and the references it carries
+type Header struct {
+	// Prerequisites are the commits a repository must already have for the
+	// bundle to be complete
+	Prerequisites []plumbing.Hash
+	// References are the references the bundle provides
+	References []*plumbing.Reference
+}
+
+// ReadHeader reads the header of a bundle, leaving the reader at the start of
+// the packfile
+func ReadHeader(reader *bufio.Reader) (*Header, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSuffix(line, "\n") != signature {
+		return nil, ErrInvalidBundle
+	}
+
+	header := &Header{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, ErrInvalidBundle
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return header, nil
+		}
+
+		if strings.HasPrefix(line, "-") {
+			hash, err := parseHash(strings.SplitN(line[1:], " ", 2)[0])
+			if err != nil {
+				return nil, err
+			}
+
+			header.Prerequisites = append(header.Prerequisites, hash)
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, ErrInvalidBundle
+		}
+
+		hash, err := parseHash(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		header.References = append(header.References,
+			plumbing.NewHashReference(plumbing.ReferenceName(fields[1]), hash))
+	}
+}
+
+func parseHash(hex string) (plumbing.Hash, error) {
+	hash := plumbing.NewHash(hex)
+	if len(hex) != 40 || hash.String() != strings.ToLower(hex) {
+		return plumbing.ZeroHash, ErrInvalidBundle
+	}
+
+	return hash, nil
+}
+
+// Create writes a bundle of the references and every object they need, except
+// for the objects reachable from the prerequisites
+func Create(
+	writer io.Writer,
+	s storer.Storer,
+	references []*plumbing.Reference,
+	prerequisites []plumbing.Hash,
+) error {
+	if _, err := fmt.Fprintf(writer, "%s\n", signature); err != nil {
+		return err
+	}
+
+	for _, prerequisite := range prerequisites {
+		// Like git, describe each prerequisite by the subject of its commit
+		var subject string
+		if commit, err := object.GetCommit(s, prerequisite); err == nil {
+			subject = strings.SplitN(commit.Message, "\n", 2)[0]
+		}
+
+		if _, err := fmt.Fprintf(writer, "-%s %s\n", prerequisite, subject); err != nil {
+			return err
+		}
+	}
+
+	wants := make([]plumbing.Hash, len(references))
+	for i, ref := range references {
+		wants[i] = ref.Hash()
+		if _, err := fmt.Fprintf(writer, "%s %s\n", ref.Hash(), ref.Name()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(writer, "\n"); err != nil {
+		return err
+	}
+
+	objects, err := pack.Objects(s, wants, prerequisites, nil)
+	if err != nil {
+		return err
+	}
+
+	return pack.Encode(writer, s, objects, false)
+}
+
+// Unbundle stores the objects of a bundle and updates the references it
+// carries, except HEAD which is left to the repository. Like a push, it
+// refuses to update the branch checked out in the worktree, and unless
+// forced, to move references other than by a fast-forward. It returns the
+// references that were updated.
+func Unbundle(s storage.Storer, reader io.Reader, options *UnbundleOptions) ([]*plumbing.Reference, error) {
+	if options == nil {
+		options = &UnbundleOptions{}
+	}
+
+	buffered := bufio.NewReader(reader)
+
+	header, err := ReadHeader(buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []plumbing.Hash
+	for _, prerequisite := range header.Prerequisites {
+		_, err := s.EncodedObject(plumbing.CommitObject, prerequisite)
+		if err == plumbing.ErrObjectNotFound {
+			missing = append(missing, prerequisite)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &MissingPrerequisitesError{Hashes: missing}
+	}
+
+	if err := packfile.UpdateObjectStorage(s, buffered); err != nil {
+		return nil, err
+	}
+
+	unlock := git.LockReferences(s)
+	defer unlock()
+
+	var references []*plumbing.Reference
+	reasons := make(map[plumbing.ReferenceName]string)
+	for _, ref := range header.References {
+		if !strings.HasPrefix(ref.Name().String(), "refs/") {
+			continue
+		}
+
+		if _, err := s.EncodedObject(plumbing.AnyObject, ref.Hash()); err != nil {
+			return nil, &IncompleteError{Reference: ref}
+		}
+
+		reason, err := checkUpdate(s, ref, options.Force)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			reasons[ref.Name()] = reason
+			continue
+		}
+
+		references = append(references, ref)
+	}
+	if len(reasons) > 0 {
+		return nil, &RejectedError{Reasons: reasons}
+	}
+
+	var updated []*plumbing.Reference
+	for _, ref := range references {
+		if err := s.SetReference(ref); err != nil {
+			return updated, err
+		}
+
+		updated = append(updated, ref)
+	}
+
+	return updated, nil
+}
+
+// checkUpdate returns why a reference cannot be updated, or an empty string
+// if it can
+func checkUpdate(s storage.Storer, ref *plumbing.Reference, force bool) (string, error) {
+	head, err := s.Reference(plumbing.HEAD)
+	if err == nil && head.Type() == plumbing.SymbolicReference && head.Target() == ref.Name() {
+		config, err := s.Config()
+		if err != nil {
+			return "", err
+		}
+		if !config.Core.IsBare {
+			return "branch is currently checked out", nil
+		}
+	}
+
+	current, err := s.Reference(ref.Name())
+	if err == plumbing.ErrReferenceNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if current.Hash() == ref.Hash() || force {
+		return "", nil
+	}
+
+	if ref.Name().IsTag() {
+		return "already exists", nil
+	}
+
+	descends, err := descendsFrom(s, ref.Hash(), current.Hash())
+	if err != nil {
+		return "", err
+	}
+	if !descends {
+		return "non-fast-forward", nil
+	}
+
+	return "", nil
+}
+
+// descendsFrom reports whether ancestor is in the history of the commit
+func descendsFrom(s storer.EncodedObjectStorer, hash plumbing.Hash, ancestor plumbing.Hash) (bool, error) {
+	commit, err := object.GetCommit(s, hash)
+	if err == plumbing.ErrObjectNotFound || err == object.ErrUnsupportedObject {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	err = object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(c *object.Commit) error {
+		if c.Hash == ancestor {
+			found = true
+			return storer.ErrStop
+		}
+		return nil
+	})
+
+	return found, err
+}
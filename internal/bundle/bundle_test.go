@@ -0,0 +1,133 @@
+package bundle_test
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/bundle"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	source := memory.NewStorage()
+	commit := testutil.StoreCommit(t, source, "Initial commit")
+	master := plumbing.NewHashReference("refs/heads/master", commit)
+
+	var buffer bytes.Buffer
+	assert.NoError(bundle.Create(&buffer, source, []*plumbing.Reference{master}, nil))
+
+	destination := memory.NewStorage()
+	updated, err := bundle.Unbundle(destination, &buffer, nil)
+	assert.NoError(err)
+	assert.Equal([]*plumbing.Reference{master}, updated)
+
+	ref, err := destination.Reference("refs/heads/master")
+	assert.NoError(err)
+	assert.Equal(commit, ref.Hash())
+
+	_, err = object.GetCommit(destination, commit)
+	assert.NoError(err)
+}
+
+func TestBundleOfARangeRequiresItsBase(t *testing.T) {
+	assert := assert.New(t)
+
+	source := memory.NewStorage()
+	base := testutil.StoreCommit(t, source, "Initial commit")
+	tip := testutil.StoreCommit(t, source, "Second commit", base)
+	master := plumbing.NewHashReference("refs/heads/master", tip)
+
+	var buffer bytes.Buffer
+	err := bundle.Create(&buffer, source, []*plumbing.Reference{master}, []plumbing.Hash{base})
+	assert.NoError(err)
+
+	header, err := bundle.ReadHeader(bufio.NewReader(bytes.NewReader(buffer.Bytes())))
+	assert.NoError(err)
+	assert.Equal([]plumbing.Hash{base}, header.Prerequisites)
+
+	_, err = bundle.Unbundle(memory.NewStorage(), &buffer, nil)
+	assert.IsType(&bundle.MissingPrerequisitesError{}, err)
+}
+
+func TestUnbundleRefusesNonFastForwards(t *testing.T) {
+	assert := assert.New(t)
+
+	source := memory.NewStorage()
+	base := testutil.StoreCommit(t, source, "Initial commit")
+	tip := testutil.StoreCommit(t, source, "Second commit", base)
+	other := testutil.StoreCommit(t, source, "Other commit", base)
+
+	destination := memory.NewStorage()
+	var buffer bytes.Buffer
+	assert.NoError(bundle.Create(&buffer, source, []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", tip),
+	}, nil))
+	_, err := bundle.Unbundle(destination, &buffer, nil)
+	assert.NoError(err)
+
+	diverged := []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", other),
+		plumbing.NewHashReference("refs/heads/feature", other),
+	}
+	buffer.Reset()
+	assert.NoError(bundle.Create(&buffer, source, diverged, nil))
+	data := buffer.Bytes()
+
+	_, err = bundle.Unbundle(destination, bytes.NewReader(data), nil)
+	assert.Equal(&bundle.RejectedError{Reasons: map[plumbing.ReferenceName]string{
+		"refs/heads/master": "non-fast-forward",
+	}}, err)
+	// Nothing is updated when a reference is rejected
+	_, err = destination.Reference("refs/heads/feature")
+	assert.Equal(plumbing.ErrReferenceNotFound, err)
+
+	updated, err := bundle.Unbundle(destination, bytes.NewReader(data), &bundle.UnbundleOptions{Force: true})
+	assert.NoError(err)
+	assert.Equal(diverged, updated)
+}
+
+func TestUnbundleRefusesTheCheckedOutBranch(t *testing.T) {
+	assert := assert.New(t)
+
+	source := memory.NewStorage()
+	commit := testutil.StoreCommit(t, source, "Initial commit")
+
+	var buffer bytes.Buffer
+	assert.NoError(bundle.Create(&buffer, source, []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", commit),
+	}, nil))
+
+	destination := memory.NewStorage()
+	assert.NoError(destination.SetReference(
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master")))
+
+	_, err := bundle.Unbundle(destination, &buffer, &bundle.UnbundleOptions{Force: true})
+	assert.Equal(&bundle.RejectedError{Reasons: map[plumbing.ReferenceName]string{
+		"refs/heads/master": "branch is currently checked out",
+	}}, err)
+}
+
+func TestUnbundleRefusesReferencesToObjectsItLacks(t *testing.T) {
+	assert := assert.New(t)
+
+	source := memory.NewStorage()
+	commit := testutil.StoreCommit(t, source, "Initial commit")
+	other := testutil.StoreCommit(t, source, "Other commit")
+	master := plumbing.NewHashReference("refs/heads/master", commit)
+
+	var buffer bytes.Buffer
+	assert.NoError(bundle.Create(&buffer, source, []*plumbing.Reference{master}, nil))
+
+	// The header is the only place the hash is spelled out in hexadecimal
+	incomplete := bytes.Replace(buffer.Bytes(), []byte(commit.String()), []byte(other.String()), 1)
+
+	_, err := bundle.Unbundle(memory.NewStorage(), bytes.NewReader(incomplete), nil)
+	assert.IsType(&bundle.IncompleteError{}, err)
+}
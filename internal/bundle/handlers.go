@@ -0,0 +1,204 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/repository/reference"
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// A git bundle
+// swagger:response GetBundleOkResponse
+type GetBundleOkResponse struct {
+	// in: body
+	Body []byte
+}
+
+// The references updated by the bundle
+// swagger:response CreateBundleOkResponse
+type CreateBundleOkResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []reference.Reference `json:"data,omitempty"`
+	}
+}
+
+// swagger:parameters getBundle
+type GetBundleParams struct {
+	// The references to bundle. Every branch, tag and HEAD is bundled when
+	// none are specified.
+	//
+	// in: query
+	Ref []string `json:"ref"`
+	// Revisions the receiving repository already has. Objects reachable from
+	// them are left out and they become prerequisites of the bundle, so
+	// since=v1.0&ref=master bundles the range v1.0..master.
+	//
+	// in: query
+	Since []string `json:"since"`
+}
+
+// swagger:parameters createBundle
+type CreateBundleParams struct {
+	// Whether to update references whose new commit does not descend from
+	// their current one, and tags that already exist
+	//
+	// in: query
+	Force bool `json:"force"`
+}
+
+// selectReferences resolves the named references, or every branch, tag and
+// HEAD if no names are given
+func selectReferences(s storer.Storer, names []string) ([]*plumbing.Reference, error) {
+	if len(names) == 0 {
+		refIter, err := s.IterReferences()
+		if err != nil {
+			return nil, err
+		}
+		defer refIter.Close()
+
+		err = refIter.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Name().IsBranch() || ref.Name().IsTag() {
+				names = append(names, ref.Name().String())
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := storer.ResolveReference(s, plumbing.HEAD); err == nil {
+			names = append(names, plumbing.HEAD.String())
+		}
+	}
+
+	var references []*plumbing.Reference
+	for _, name := range names {
+		ref, err := resolveReference(s, name)
+		if err != nil {
+			return nil, fmt.Errorf("reference %s not found", name)
+		}
+		if ref.Hash().IsZero() {
+			continue
+		}
+
+		references = append(references, ref)
+	}
+
+	return references, nil
+}
+
+// resolveReference finds a reference by its full or short name and returns it
+// under its full name
+func resolveReference(s storer.Storer, name string) (*plumbing.Reference, error) {
+	candidates := []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name}
+	for _, candidate := range candidates {
+		resolved, err := storer.ResolveReference(s, plumbing.ReferenceName(candidate))
+		if err == nil {
+			return plumbing.NewHashReference(
+				plumbing.ReferenceName(candidate), resolved.Hash()), nil
+		}
+	}
+
+	return nil, plumbing.ErrReferenceNotFound
+}
+
+// NewGetBundleHandler streams a bundle of the repository
+func NewGetBundleHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repositoryPath := vars["directory"]
+		repository, _ := reader.Open(repositoryPath)
+		query := request.URL.Query()
+
+		references, err := selectReferences(repository.Storer(), query["ref"])
+		if err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		if len(references) == 0 {
+			response.WriteError(writer, http.StatusBadRequest, fmt.Errorf("no references to bundle"))
+			return
+		}
+
+		prerequisites := make([]plumbing.Hash, len(query["since"]))
+		for i, revision := range query["since"] {
+			hash, err := repository.ResolveRevision(revision)
+			if err != nil {
+				response.WriteError(writer, http.StatusBadRequest,
+					fmt.Errorf("revision %s not found", revision))
+				return
+			}
+
+			prerequisites[i] = plumbing.Hash(hash)
+		}
+
+		writer.Header().Set("Content-Type", "application/x-git-bundle")
+		writer.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="%s.bundle"`, path.Base(repositoryPath)))
+
+		err = Create(writer, repository.Storer(), references, prerequisites)
+		if err != nil {
+			log.Printf("%s: creating bundle: %s\n", repositoryPath, err)
+		}
+	}
+}
+
+// NewCreateBundleHandler unbundles the request body into the repository
+func NewCreateBundleHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repositoryPath := vars["directory"]
+		repository, _ := reader.Open(repositoryPath)
+
+		updated, err := Unbundle(repository.Storer(), request.Body, &UnbundleOptions{
+			Force: request.URL.Query().Get("force") == "true",
+		})
+		if _, missing := err.(*MissingPrerequisitesError); missing {
+			response.WriteError(writer, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if _, incomplete := err.(*IncompleteError); incomplete {
+			response.WriteError(writer, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if _, rejected := err.(*RejectedError); rejected {
+			response.WriteError(writer, http.StatusConflict, err)
+			return
+		}
+		if err == ErrInvalidBundle {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := make([]interface{}, len(updated))
+		for i, ref := range updated {
+			data[i] = reference.Reference{
+				Hash: ref.Hash().String(),
+				Name: ref.Name().String(),
+			}
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
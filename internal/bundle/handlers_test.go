@@ -0,0 +1,55 @@
+package bundle_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/bundle"
+	"github.com/drdgvhbh/gitserver/internal/mock"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestGetBundleOnlyBundlesBranchesTagsAndHeadByDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	commit := testutil.StoreCommit(t, storage, "Initial commit")
+	for _, name := range []string{
+		"refs/heads/master",
+		"refs/tags/v1.0",
+		"refs/remotes/origin/master",
+		"refs/notes/commits",
+	} {
+		assert.NoError(storage.SetReference(
+			plumbing.NewHashReference(plumbing.ReferenceName(name), commit)))
+	}
+	assert.NoError(storage.SetReference(
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master")))
+
+	path := "/srv/project.git"
+	repository := new(mock.Repository)
+	repository.On("Storer").Return(storage)
+	reader := new(mock.Reader)
+	reader.On("Open", path).Return(repository, nil)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"directory": path})
+	res := httptest.NewRecorder()
+	bundle.NewGetBundleHandler(reader)(res, req)
+	assert.Equal(http.StatusOK, res.Code)
+
+	header, err := bundle.ReadHeader(bufio.NewReader(res.Body))
+	assert.NoError(err)
+
+	var names []string
+	for _, ref := range header.References {
+		names = append(names, ref.Name().String())
+	}
+	assert.ElementsMatch([]string{"refs/heads/master", "refs/tags/v1.0", "HEAD"}, names)
+}
@@ -0,0 +1,294 @@
+// Package config loads the server configuration from a YAML file, the
+// environment and command line flags, in increasing order of precedence
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix prefixes the environment variables the configuration is read from
+const EnvPrefix = "GITSERVER_"
+
+// TLS holds the certificate the HTTP server is served with
+type TLS struct {
+	// CertFile is the PEM encoded certificate chain
+	CertFile string `yaml:"cert_file"`
+	// KeyFile is the PEM encoded private key of the certificate
+	KeyFile string `yaml:"key_file"`
+}
+
+// Enabled reports whether a certificate is configured
+func (tls TLS) Enabled() bool {
+	return tls.CertFile != "" && tls.KeyFile != ""
+}
+
+// SSH configures the SSH transport
+type SSH struct {
+	// Address is the address to serve git over SSH on. SSH is disabled when
+	// it is empty.
+	Address string `yaml:"address"`
+	// HostKeyFile is the host key of the server. An ed25519 key is
+	// generated and saved there when the file does not exist.
+	HostKeyFile string `yaml:"host_key_file"`
+	// KeysFile is the file the registered public keys are stored in
+	KeysFile string `yaml:"keys_file"`
+}
+
+// Trash configures where deleted repositories are kept
+type Trash struct {
+	// Directory holds the deleted repositories. It defaults to .trash in the
+	// first root, and must be on the same device as the roots.
+	Directory string `yaml:"directory"`
+	// Retention is how long deleted repositories are kept
+	Retention time.Duration `yaml:"retention"`
+}
+
+// Config is the configuration of the server
+type Config struct {
+	// Addresses are the addresses the HTTP server listens on
+	Addresses []string `yaml:"addresses"`
+	// TLS serves HTTPS instead of HTTP when configured
+	TLS TLS `yaml:"tls"`
+	// ReadTimeout bounds the time spent reading a request
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// WriteTimeout bounds the time spent writing a response
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// APIKeys are the keys clients authenticate with. A key written as
+	// name:key attributes the requests that carry it to name.
+	APIKeys []string `yaml:"api_keys"`
+	// Roots are the directories repositories are confined to. Relative
+	// repository paths are resolved in them.
+	Roots []string `yaml:"roots"`
+	// RegistryFile is the file the repository names are stored in
+	RegistryFile string `yaml:"registry_file"`
+	// CredentialsFile is the file the credentials remotes are authenticated
+	// to with are stored in
+	CredentialsFile string `yaml:"credentials_file"`
+	// SSH configures the SSH transport
+	SSH SSH `yaml:"ssh"`
+	// Trash configures where deleted repositories are kept
+	Trash Trash `yaml:"trash"`
+}
+
+// Default returns the configuration used for anything left unset
+func Default() *Config {
+	return &Config{
+		Addresses:       []string{"127.0.0.1:8000"},
+		ReadTimeout:     15 * time.Second,
+		WriteTimeout:    15 * time.Second,
+		RegistryFile:    "registry.json",
+		CredentialsFile: "credentials.json",
+		SSH: SSH{
+			HostKeyFile: "ssh_host_ed25519_key",
+			KeysFile:    "keys.json",
+		},
+		Trash: Trash{
+			Retention: 30 * 24 * time.Hour,
+		},
+	}
+}
+
+// Validate checks that the configuration can be served
+func (config *Config) Validate() error {
+	if len(config.Addresses) == 0 {
+		return errors.New("no listen addresses configured")
+	}
+	if len(config.APIKeys) == 0 {
+		return errors.New("no API keys configured")
+	}
+	if (config.TLS.CertFile == "") != (config.TLS.KeyFile == "") {
+		return errors.New("TLS needs both a certificate and a key file")
+	}
+	if len(config.Roots) == 0 {
+		return errors.New("no repository roots configured")
+	}
+	if config.Trash.Retention < 0 {
+		return errors.New("the trash retention cannot be negative")
+	}
+
+	return nil
+}
+
+// stringsFlag is a flag that can be repeated or given a comma separated list
+type stringsFlag struct {
+	values *[]string
+	set    bool
+}
+
+func (f *stringsFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+
+	return strings.Join(*f.values, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	// The first occurrence replaces the defaults, later ones add to it
+	if !f.set {
+		*f.values = nil
+		f.set = true
+	}
+	*f.values = append(*f.values, splitList(value)...)
+
+	return nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
+// Load reads the configuration file named by the -config flag or the
+// GITSERVER_CONFIG environment variable, then applies the environment and
+// finally the remaining flags
+func Load(name string, arguments []string, environment []string) (*Config, error) {
+	env := make(map[string]string)
+	for _, variable := range environment {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], EnvPrefix) {
+			env[strings.TrimPrefix(parts[0], EnvPrefix)] = parts[1]
+		}
+	}
+
+	config := Default()
+
+	// Flags are parsed twice: once to find the configuration file, and once
+	// the file and the environment have been applied, so that they win
+	flags, configFile := newFlagSet(name, config)
+	if err := flags.Parse(arguments); err != nil {
+		return nil, err
+	}
+	if *configFile == "" {
+		*configFile = env["CONFIG"]
+	}
+
+	config = Default()
+	if *configFile != "" {
+		if err := config.readFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.applyEnvironment(env); err != nil {
+		return nil, err
+	}
+
+	flags, _ = newFlagSet(name, config)
+	if err := flags.Parse(arguments); err != nil {
+		return nil, err
+	}
+
+	return config, config.Validate()
+}
+
+func newFlagSet(name string, config *Config) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	configFile := flags.String("config", "", "YAML configuration file")
+	flags.Var(&stringsFlag{values: &config.Addresses}, "address",
+		"address to listen on, may be repeated")
+	flags.StringVar(&config.TLS.CertFile, "tls-cert", config.TLS.CertFile,
+		"TLS certificate file, enables HTTPS along with -tls-key")
+	flags.StringVar(&config.TLS.KeyFile, "tls-key", config.TLS.KeyFile,
+		"TLS private key file")
+	flags.DurationVar(&config.ReadTimeout, "read-timeout", config.ReadTimeout,
+		"maximum duration for reading a request")
+	flags.DurationVar(&config.WriteTimeout, "write-timeout", config.WriteTimeout,
+		"maximum duration for writing a response")
+	flags.Var(&stringsFlag{values: &config.APIKeys}, "api-key",
+		"API key clients authenticate with, may be repeated")
+	flags.Var(&stringsFlag{values: &config.Roots}, "root",
+		"directory repositories are confined to, may be repeated")
+	flags.StringVar(&config.RegistryFile, "registry", config.RegistryFile,
+		"file the repository names are stored in")
+	flags.StringVar(&config.CredentialsFile, "credentials", config.CredentialsFile,
+		"file the credentials remotes are authenticated to with are stored in")
+	flags.StringVar(&config.SSH.KeysFile, "keys", config.SSH.KeysFile,
+		"file the registered SSH public keys are stored in")
+	flags.StringVar(&config.SSH.Address, "ssh-address", config.SSH.Address,
+		"address to serve git over SSH on, disabled when empty")
+	flags.StringVar(&config.SSH.HostKeyFile, "ssh-host-key", config.SSH.HostKeyFile,
+		"SSH host key file, an ed25519 key is generated when it does not exist")
+	flags.StringVar(&config.Trash.Directory, "trash-dir", config.Trash.Directory,
+		"directory deleted repositories are kept in, .trash in the first root when empty")
+	flags.DurationVar(&config.Trash.Retention, "trash-retention", config.Trash.Retention,
+		"how long deleted repositories are kept")
+
+	return flags, configFile
+}
+
+func (config *Config) readFile(name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	return nil
+}
+
+func (config *Config) applyEnvironment(env map[string]string) error {
+	stringFields := map[string]*string{
+		"TLS_CERT":     &config.TLS.CertFile,
+		"TLS_KEY":      &config.TLS.KeyFile,
+		"SSH_ADDRESS":  &config.SSH.Address,
+		"SSH_HOST_KEY": &config.SSH.HostKeyFile,
+		"KEYS":         &config.SSH.KeysFile,
+		"REGISTRY":     &config.RegistryFile,
+		"CREDENTIALS":  &config.CredentialsFile,
+		"TRASH_DIR":    &config.Trash.Directory,
+	}
+	for name, field := range stringFields {
+		if value, ok := env[name]; ok {
+			*field = value
+		}
+	}
+
+	listFields := map[string]*[]string{
+		"ADDRESSES": &config.Addresses,
+		"API_KEYS":  &config.APIKeys,
+		"ROOTS":     &config.Roots,
+	}
+	for name, field := range listFields {
+		if value, ok := env[name]; ok {
+			*field = splitList(value)
+		}
+	}
+
+	durationFields := map[string]*time.Duration{
+		"READ_TIMEOUT":    &config.ReadTimeout,
+		"WRITE_TIMEOUT":   &config.WriteTimeout,
+		"TRASH_RETENTION": &config.Trash.Retention,
+	}
+	for name, field := range durationFields {
+		value, ok := env[name]
+		if !ok {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s%s: %s", EnvPrefix, name, err)
+		}
+		*field = duration
+	}
+
+	return nil
+}
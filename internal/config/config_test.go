@@ -0,0 +1,97 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAppliesFileThenEnvironmentThenFlags(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "gitserver-config")
+	assert.NoError(err)
+	defer os.RemoveAll(directory)
+
+	configFile := path.Join(directory, "gitserver.yaml")
+	err = ioutil.WriteFile(configFile, []byte(`
+addresses: [":8000", ":8001"]
+read_timeout: 30s
+api_keys: [from-file]
+roots: [/srv/git]
+`), 0644)
+	assert.NoError(err)
+
+	cfg, err := config.Load("gitserver",
+		[]string{"-config", configFile, "-root", "/srv/flag"},
+		[]string{"GITSERVER_API_KEYS=first, second", "GITSERVER_ROOTS=/srv/env"})
+	assert.NoError(err)
+
+	assert.Equal([]string{":8000", ":8001"}, cfg.Addresses)
+	assert.Equal(30*time.Second, cfg.ReadTimeout)
+	assert.Equal(15*time.Second, cfg.WriteTimeout)
+	assert.Equal([]string{"first", "second"}, cfg.APIKeys)
+	assert.Equal([]string{"/srv/flag"}, cfg.Roots)
+}
+
+func TestLoadReadsTheConfigFileFromTheEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "gitserver-config")
+	assert.NoError(err)
+	defer os.RemoveAll(directory)
+
+	configFile := path.Join(directory, "gitserver.yaml")
+	err = ioutil.WriteFile(configFile, []byte("api_keys: [from-file]\n"), 0644)
+	assert.NoError(err)
+
+	cfg, err := config.Load("gitserver",
+		[]string{"-address", "127.0.0.1:9000", "-root", "/srv/git"},
+		[]string{"GITSERVER_CONFIG=" + configFile})
+	assert.NoError(err)
+
+	assert.Equal([]string{"127.0.0.1:9000"}, cfg.Addresses)
+	assert.Equal([]string{"from-file"}, cfg.APIKeys)
+}
+
+func TestLoadRequiresAnAPIKey(t *testing.T) {
+	_, err := config.Load("gitserver", []string{"-root", "/srv/git"}, nil)
+	assert.EqualError(t, err, "no API keys configured")
+}
+
+func TestLoadRejectsUnknownSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "gitserver-config")
+	assert.NoError(err)
+	defer os.RemoveAll(directory)
+
+	configFile := path.Join(directory, "gitserver.yaml")
+	err = ioutil.WriteFile(configFile, []byte("api_key: typo\n"), 0644)
+	assert.NoError(err)
+
+	_, err = config.Load("gitserver", []string{"-config", configFile}, nil)
+	assert.Error(err)
+}
+
+func TestLoadConfiguresTheTrash(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg, err := config.Load("gitserver",
+		[]string{"-api-key", "key", "-root", "/srv/git", "-trash-dir", "/srv/trash"},
+		[]string{"GITSERVER_TRASH_RETENTION=168h"})
+	assert.NoError(err)
+
+	assert.Equal("/srv/trash", cfg.Trash.Directory)
+	assert.Equal(7*24*time.Hour, cfg.Trash.Retention)
+
+	cfg, err = config.Load("gitserver", []string{"-api-key", "key", "-root", "/srv/git"}, nil)
+	assert.NoError(err)
+	assert.Empty(cfg.Trash.Directory)
+	assert.Equal(30*24*time.Hour, cfg.Trash.Retention)
+}
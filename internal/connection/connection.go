@@ -0,0 +1,82 @@
+// Package connection keeps track of the connections a server accepts, so that
+// handlers can change the deadlines of the connection their request came in on
+package connection
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Tracker keeps track of the open connections of its listeners
+type Tracker struct {
+	connections sync.Map
+}
+
+// NewTracker creates a tracker without connections
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// key identifies a connection by both of its ends, as a client may connect
+// to several listeners from the same address
+func key(local net.Addr, remote string) string {
+	return local.String() + " " + remote
+}
+
+// Listen tracks the connections accepted by listener until they are closed
+func (tracker *Tracker) Listen(listener net.Listener) net.Listener {
+	return &trackingListener{Listener: listener, tracker: tracker}
+}
+
+// Conn returns the connection a request came in on. Requests served over
+// HTTP/2 share their connection with other requests, and are not matched.
+func (tracker *Tracker) Conn(request *http.Request) (net.Conn, bool) {
+	if tracker == nil || request.ProtoMajor != 1 {
+		return nil, false
+	}
+
+	local, ok := request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return nil, false
+	}
+
+	conn, ok := tracker.connections.Load(key(local, request.RemoteAddr))
+	if !ok {
+		return nil, false
+	}
+
+	return conn.(net.Conn), true
+}
+
+type trackingListener struct {
+	net.Listener
+	tracker *Tracker
+}
+
+func (listener *trackingListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := &trackedConn{
+		Conn:    conn,
+		tracker: listener.tracker,
+		key:     key(conn.LocalAddr(), conn.RemoteAddr().String()),
+	}
+	listener.tracker.connections.Store(tracked.key, conn)
+
+	return tracked, nil
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *Tracker
+	key     string
+}
+
+func (conn *trackedConn) Close() error {
+	conn.tracker.connections.Delete(conn.key)
+	return conn.Conn.Close()
+}
@@ -0,0 +1,34 @@
+package credential
+
+type Credential struct {
+	// The identifier of the credential
+	//
+	// required: true
+	// example: 0c5f2d0e-8d0b-4f5e-9d36-6b1f3c1e2a7b
+	ID string `json:"id,omitempty"`
+
+	// The URL prefix of the remotes the credential is used for
+	//
+	// required: true
+	// example: https://github.com/drdgvhbh/
+	URL string `json:"url,omitempty"`
+
+	// The user name the credential authenticates as
+	//
+	// required: true
+	// example: drdgvhbh
+	Username string `json:"username,omitempty"`
+
+	// When the credential was stored
+	//
+	// required: true
+	// example: 2019-05-26T12:41:18-04:00
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// entry is how a credential is persisted. Passwords are never handed out
+// through the API.
+type entry struct {
+	Credential
+	Password string `json:"password"`
+}
@@ -0,0 +1,218 @@
+// Package credential manages the credentials the server authenticates to
+// remotes with, so that clients never have to send them along
+package credential
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+var (
+	// ErrCredentialNotFound is returned when no credential has the requested
+	// identifier
+	ErrCredentialNotFound = errors.New("credential does not exist")
+	// ErrCredentialExists is returned when a credential is already stored for
+	// the same URL
+	ErrCredentialExists = errors.New("a credential is already stored for the URL")
+	// ErrInvalidURL is returned for URLs that are not http or https URLs, or
+	// that carry credentials of their own
+	ErrInvalidURL = errors.New("credential URLs must be http or https URLs without a user name or password")
+	// ErrNoPassword is returned when storing a credential without a password
+	// or token
+	ErrNoPassword = errors.New("credentials need a password or token")
+)
+
+// Store holds the credentials, persisting them to a JSON file
+type Store struct {
+	path    string
+	mutex   sync.RWMutex
+	entries []entry
+}
+
+// NewStore loads the credentials stored at path. An empty path keeps the
+// credentials in memory only.
+func NewStore(path string) (*Store, error) {
+	store := &Store{path: path}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.entries); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// parseURL parses a URL credentials are stored for or looked up by
+func parseURL(rawURL string) (*url.URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	return parsed, nil
+}
+
+// List returns every stored credential, without its password
+func (store *Store) List() []Credential {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	credentials := make([]Credential, len(store.entries))
+	for i := range store.entries {
+		credentials[i] = store.entries[i].Credential
+	}
+
+	return credentials
+}
+
+// Add stores the user name and password to authenticate to the remotes under
+// rawURL with. For token based hosts, the token is the password.
+func (store *Store) Add(rawURL string, username string, password string) (Credential, error) {
+	parsed, err := parseURL(rawURL)
+	if err != nil {
+		return Credential{}, err
+	}
+	if parsed.User != nil {
+		return Credential{}, ErrInvalidURL
+	}
+	if password == "" {
+		return Credential{}, ErrNoPassword
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, stored := range store.entries {
+		if stored.URL == parsed.String() {
+			return Credential{}, ErrCredentialExists
+		}
+	}
+
+	stored := entry{
+		Credential: Credential{
+			ID:        uuid.New().String(),
+			URL:       parsed.String(),
+			Username:  username,
+			CreatedAt: time.Now().Format(time.RFC3339),
+		},
+		Password: password,
+	}
+	store.entries = append(store.entries, stored)
+
+	if err := store.save(); err != nil {
+		store.entries = store.entries[:len(store.entries)-1]
+		return Credential{}, err
+	}
+
+	return stored.Credential, nil
+}
+
+// Remove deletes the credential with the given identifier
+func (store *Store) Remove(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i, stored := range store.entries {
+		if stored.ID != id {
+			continue
+		}
+
+		entries := append(append([]entry{}, store.entries[:i]...), store.entries[i+1:]...)
+		previous := store.entries
+		store.entries = entries
+
+		if err := store.save(); err != nil {
+			store.entries = previous
+			return err
+		}
+
+		return nil
+	}
+
+	return ErrCredentialNotFound
+}
+
+// Auth returns the authentication for the remote at rawURL, using the
+// credential with the longest URL that rawURL starts with. It returns nil
+// when no credential applies, in which case the credentials in rawURL, if
+// any, are used.
+func (store *Store) Auth(rawURL string) transport.AuthMethod {
+	if store == nil {
+		return nil
+	}
+	target, err := parseURL(rawURL)
+	if err != nil {
+		return nil
+	}
+	target.User = nil
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var found *entry
+	for i := range store.entries {
+		stored := &store.entries[i]
+		if !matches(stored.URL, target) {
+			continue
+		}
+		if found == nil || len(stored.URL) > len(found.URL) {
+			found = stored
+		}
+	}
+	if found == nil {
+		return nil
+	}
+
+	return &githttp.BasicAuth{
+		Username: found.Username,
+		Password: found.Password,
+	}
+}
+
+// matches tells whether the credential stored for prefix applies to target.
+// Paths only match on whole segments, so that a credential for
+// https://host/org does not apply to https://host/organization.
+func matches(prefix string, target *url.URL) bool {
+	parsed, err := url.Parse(prefix)
+	if err != nil || parsed.Scheme != target.Scheme || parsed.Host != target.Host {
+		return false
+	}
+
+	path := strings.TrimSuffix(parsed.Path, "/")
+	return path == "" ||
+		target.Path == path ||
+		strings.HasPrefix(target.Path, path+"/")
+}
+
+func (store *Store) save() error {
+	if store.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(store.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(store.path, data, 0600)
+}
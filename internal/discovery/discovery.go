@@ -0,0 +1,308 @@
+// Package discovery finds the repositories stored under the repository roots
+package discovery
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/registry"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// ErrRepositoryNotExists is returned when there is no repository at a path
+var ErrRepositoryNotExists = errors.New("repository does not exist")
+
+// maxDepth bounds how many directories deep the roots are scanned
+const maxDepth = 5
+
+type Repository struct {
+	// The name to refer to the repository by. It is the registered name of
+	// the repository, or its path relative to its root.
+	//
+	// required: true
+	// example: team/project
+	Name string `json:"name"`
+
+	// Whether the repository has no worktree
+	//
+	// required: true
+	// example: false
+	Bare bool `json:"bare"`
+
+	// The branch HEAD points to
+	//
+	// example: master
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+
+	// When the commit HEAD points to was committed
+	//
+	// example: 2019-05-26T12:41:18-04:00
+	LastCommitAt string `json:"lastCommitAt,omitempty"`
+
+	// The size of the git directory in bytes
+	//
+	// required: true
+	// example: 1048576
+	Size int64 `json:"size"`
+
+	// Whether a repository with the same path in an earlier root takes
+	// precedence, so that this one is only reachable through a registered
+	// name
+	//
+	// example: false
+	Shadowed bool `json:"shadowed,omitempty"`
+}
+
+// Location is where a repository found under the roots is stored
+type Location struct {
+	// Name is the name the repository is listed by
+	Name string
+	// Path is the absolute path of the repository
+	Path string
+	// Shadowed reports whether a repository with the same path relative to
+	// an earlier root takes precedence
+	Shadowed bool
+
+	gitDirectory string
+}
+
+// Scanner lists the repositories under a set of root directories
+type Scanner struct {
+	fileSystem billy.Filesystem
+	roots      []string
+	names      *registry.Store
+}
+
+// NewScanner creates a scanner for the roots. Repositories that are
+// registered in names are listed by their registered name.
+func NewScanner(fileSystem billy.Filesystem, roots []string, names *registry.Store) *Scanner {
+	return &Scanner{
+		fileSystem: fileSystem,
+		roots:      roots,
+		names:      names,
+	}
+}
+
+// Scan returns the locations of the repositories found under the roots,
+// sorted by name. The repositories are not read, so that only those that are
+// described pay for it.
+func (scanner *Scanner) Scan() ([]Location, error) {
+	registered := scanner.registeredNames()
+	seen := make(map[string]bool)
+
+	var locations []Location
+	for _, root := range scanner.roots {
+		err := scanner.walk(root, 0, func(path string, gitDirectory string) error {
+			relative, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			relative = filepath.ToSlash(relative)
+
+			// Relative paths resolve to the first root they exist in
+			location := Location{
+				Name:         relative,
+				Path:         path,
+				Shadowed:     seen[relative],
+				gitDirectory: gitDirectory,
+			}
+			if name, ok := registered[path]; ok {
+				location.Name = name
+			}
+			seen[relative] = true
+
+			locations = append(locations, location)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Shadowed repositories come after the one that shadows them
+	sort.SliceStable(locations, func(i, j int) bool {
+		return locations[i].Name < locations[j].Name
+	})
+
+	return locations, nil
+}
+
+// Describe reads the repository at a location found by Scan
+func (scanner *Scanner) Describe(location Location) (Repository, error) {
+	repository, err := describe(scanner.fileSystem, location.Path, location.gitDirectory)
+	if err != nil {
+		return repository, err
+	}
+	repository.Name = location.Name
+	repository.Shadowed = location.Shadowed
+
+	return repository, nil
+}
+
+// Name returns the name the repository stored at path is listed by: its
+// registered name, or its path relative to the first root it is in. Paths
+// outside of the roots are named by their path.
+func (scanner *Scanner) Name(path string) string {
+	if name, ok := scanner.registeredNames()[path]; ok {
+		return name
+	}
+
+	for _, root := range scanner.roots {
+		relative, err := filepath.Rel(root, path)
+		if err != nil || relative == ".." ||
+			strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		return filepath.ToSlash(relative)
+	}
+
+	return path
+}
+
+// registeredNames maps the locations of registered repositories to their
+// names. Relative locations are looked up in each root.
+func (scanner *Scanner) registeredNames() map[string]string {
+	names := make(map[string]string)
+	if scanner.names == nil {
+		return names
+	}
+
+	for _, entry := range scanner.names.List() {
+		if filepath.IsAbs(entry.Location) {
+			names[filepath.Clean(entry.Location)] = entry.Name
+			continue
+		}
+
+		for _, root := range scanner.roots {
+			names[filepath.Join(root, entry.Location)] = entry.Name
+		}
+	}
+
+	return names
+}
+
+// walk calls found for every repository under directory. It does not descend
+// into repositories, hidden directories or symbolic links.
+func (scanner *Scanner) walk(
+	directory string,
+	depth int,
+	found func(path string, gitDirectory string) error,
+) error {
+	if depth >= maxDepth {
+		return nil
+	}
+
+	entries, err := scanner.fileSystem.ReadDir(directory)
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(directory, entry.Name())
+		if gitDirectory := git.FindGitDirectory(scanner.fileSystem, path); gitDirectory != "" {
+			if err := found(path, gitDirectory); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := scanner.walk(path, depth+1, found); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Describe describes the repository at path. The name is left to the caller.
+func Describe(fileSystem billy.Filesystem, path string) (Repository, error) {
+	gitDirectory := git.FindGitDirectory(fileSystem, path)
+	if gitDirectory == "" {
+		return Repository{}, ErrRepositoryNotExists
+	}
+
+	return describe(fileSystem, path, gitDirectory)
+}
+
+// describe reads the default branch, last commit and size of a repository
+// from its git directory. Repositories without commits, or that cannot be
+// read, are described as far as possible.
+func describe(fileSystem billy.Filesystem, path string, gitDirectory string) (Repository, error) {
+	repository := Repository{Bare: gitDirectory == path}
+
+	size, err := directorySize(fileSystem, gitDirectory)
+	if err != nil {
+		return repository, err
+	}
+	repository.Size = size
+
+	dotgitFolder, err := fileSystem.Chroot(gitDirectory)
+	if err != nil {
+		return repository, err
+	}
+	s := filesystem.NewStorage(dotgitFolder, cache.NewObjectLRUDefault())
+
+	head, err := s.Reference(plumbing.HEAD)
+	if err != nil {
+		return repository, nil
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		repository.DefaultBranch = head.Target().Short()
+	}
+
+	resolved, err := storer.ResolveReference(s, plumbing.HEAD)
+	if err != nil {
+		return repository, nil
+	}
+
+	commit, err := object.GetCommit(s, resolved.Hash())
+	if err != nil {
+		return repository, nil
+	}
+	repository.LastCommitAt = commit.Committer.When.Format(time.RFC3339)
+
+	return repository, nil
+}
+
+// directorySize adds up the sizes of the files under directory
+func directorySize(fileSystem billy.Filesystem, directory string) (int64, error) {
+	entries, err := fileSystem.ReadDir(directory)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			size += entry.Size()
+			continue
+		}
+
+		subdirectorySize, err := directorySize(
+			fileSystem, filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return 0, err
+		}
+		size += subdirectorySize
+	}
+
+	return size, nil
+}
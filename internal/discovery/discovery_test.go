@@ -0,0 +1,159 @@
+package discovery_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/discovery"
+	"github.com/drdgvhbh/gitserver/internal/registry"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+var committedAt = time.Date(2019, 5, 26, 12, 41, 18, 0, time.UTC)
+
+func initRepository(t *testing.T, fileSystem billy.Filesystem, path string, bare bool) {
+	gitDirectory := path
+	if !bare {
+		gitDirectory = path + "/.git"
+	}
+
+	dotgitFolder, err := fileSystem.Chroot(gitDirectory)
+	assert.NoError(t, err)
+	s := filesystem.NewStorage(dotgitFolder, cache.NewObjectLRUDefault())
+
+	if bare {
+		_, err = gogit.Init(s, nil)
+		assert.NoError(t, err)
+		return
+	}
+
+	worktreeFolder, err := fileSystem.Chroot(path)
+	assert.NoError(t, err)
+	repository, err := gogit.Init(s, worktreeFolder)
+	assert.NoError(t, err)
+
+	assert.NoError(t, util.WriteFile(worktreeFolder, "README.md", []byte("# project\n"), 0644))
+	worktree, err := repository.Worktree()
+	assert.NoError(t, err)
+	_, err = worktree.Add("README.md")
+	assert.NoError(t, err)
+
+	signature := &object.Signature{Name: "drd", Email: "drd@example.com", When: committedAt}
+	_, err = worktree.Commit("Initial commit", &gogit.CommitOptions{
+		Author:    signature,
+		Committer: signature,
+	})
+	assert.NoError(t, err)
+}
+
+func TestScanFindsRepositoriesUnderTheRoots(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/team/project", false)
+	initRepository(t, fileSystem, "/srv/mirror.git", true)
+	assert.NoError(util.WriteFile(fileSystem, "/srv/submodule/.git",
+		[]byte("gitdir: ../team/project/.git\n"), 0644))
+	assert.NoError(fileSystem.MkdirAll("/srv/empty", 0755))
+
+	scanner := discovery.NewScanner(fileSystem, []string{"/srv"}, nil)
+	locations, err := scanner.Scan()
+	assert.NoError(err)
+
+	var names []string
+	var repositories []discovery.Repository
+	for _, location := range locations {
+		names = append(names, location.Name)
+		repository, err := scanner.Describe(location)
+		assert.NoError(err)
+		repositories = append(repositories, repository)
+	}
+	assert.Equal([]string{"mirror.git", "submodule", "team/project"}, names)
+	assert.Equal("/srv/team/project", locations[2].Path)
+
+	mirror := repositories[0]
+	assert.True(mirror.Bare)
+	assert.Equal("master", mirror.DefaultBranch)
+	assert.Empty(mirror.LastCommitAt)
+
+	project := repositories[2]
+	assert.False(project.Bare)
+	assert.Equal("master", project.DefaultBranch)
+	assert.Equal(committedAt.Format(time.RFC3339), project.LastCommitAt)
+	assert.True(project.Size > 0)
+	assert.Equal(project.LastCommitAt, repositories[1].LastCommitAt)
+}
+
+func TestScanListsRegisteredRepositoriesByName(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/a/b/c", true)
+	initRepository(t, fileSystem, "/other/d", true)
+
+	names, err := registry.NewStore("")
+	assert.NoError(err)
+	_, err = names.Add("abc", "/srv/a/b/c")
+	assert.NoError(err)
+
+	locations, err := discovery.NewScanner(
+		fileSystem, []string{"/srv", "/other"}, names).Scan()
+	assert.NoError(err)
+
+	assert.Len(locations, 2)
+	assert.Equal("abc", locations[0].Name)
+	assert.Equal("d", locations[1].Name)
+}
+
+func TestScanFlagsShadowedRepositories(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/project", true)
+	initRepository(t, fileSystem, "/other/project", true)
+
+	scanner := discovery.NewScanner(fileSystem, []string{"/srv", "/other"}, nil)
+	locations, err := scanner.Scan()
+	assert.NoError(err)
+
+	assert.Len(locations, 2)
+	assert.Equal("project", locations[0].Name)
+	assert.Equal("project", locations[1].Name)
+	assert.False(locations[0].Shadowed)
+	assert.True(locations[1].Shadowed)
+	assert.Equal("/other/project", locations[1].Path)
+
+	shadowed, err := scanner.Describe(locations[1])
+	assert.NoError(err)
+	assert.Equal("project", shadowed.Name)
+	assert.True(shadowed.Shadowed)
+}
+
+func TestNameMatchesTheListedName(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/a/b/c", true)
+	initRepository(t, fileSystem, "/srv/project", true)
+	initRepository(t, fileSystem, "/other/project", true)
+	initRepository(t, fileSystem, "/other/team/d", true)
+
+	names, err := registry.NewStore("")
+	assert.NoError(err)
+	_, err = names.Add("abc", "a/b/c")
+	assert.NoError(err)
+
+	scanner := discovery.NewScanner(fileSystem, []string{"/srv", "/other"}, names)
+	assert.Equal("abc", scanner.Name("/srv/a/b/c"))
+	assert.Equal("project", scanner.Name("/srv/project"))
+	assert.Equal("project", scanner.Name("/other/project"))
+	assert.Equal("team/d", scanner.Name("/other/team/d"))
+	assert.Equal("/elsewhere/e", scanner.Name("/elsewhere/e"))
+}
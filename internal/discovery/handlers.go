@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/response"
+)
+
+const (
+	defaultPerPage = 30
+	maxPerPage     = 100
+)
+
+// List of repositories under the repository roots
+// swagger:response GetRepositoriesOkResponse
+type GetRepositoriesOKResponse struct {
+	// The number of repositories matching the filter
+	TotalCount int `json:"X-Total-Count"`
+	// The URL of the next page, as a link with rel="next"
+	Link string `json:"Link"`
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Repository `json:"data,omitempty"`
+	}
+}
+
+// swagger:parameters listRepositories
+type GetRepositoriesParams struct {
+	// Only list repositories whose name contains this
+	//
+	// in: query
+	Name string `json:"name"`
+	// The page to return, starting at 1
+	//
+	// in: query
+	Page int `json:"page"`
+	// The number of repositories per page, at most 100
+	//
+	// in: query
+	PerPage int `json:"perPage"`
+}
+
+// queryInt parses a positive integer query parameter
+func queryInt(request *http.Request, key string, fallback int) (int, error) {
+	value := request.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", key)
+	}
+
+	return number, nil
+}
+
+// NewGetRepositoriesHandler lists the repositories under the roots of the
+// scanner, a page at a time
+func NewGetRepositoriesHandler(scanner *Scanner) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		page, err := queryInt(request, "page", 1)
+		if err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		perPage, err := queryInt(request, "perPage", defaultPerPage)
+		if err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		if perPage > maxPerPage {
+			perPage = maxPerPage
+		}
+
+		locations, err := scanner.Scan()
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		filter := strings.ToLower(request.URL.Query().Get("name"))
+		var matching []Location
+		for _, location := range locations {
+			if strings.Contains(strings.ToLower(location.Name), filter) {
+				matching = append(matching, location)
+			}
+		}
+
+		start := (page - 1) * perPage
+		if start > len(matching) {
+			start = len(matching)
+		}
+		end := start + perPage
+		if end > len(matching) {
+			end = len(matching)
+		}
+
+		writer.Header().Set("X-Total-Count", strconv.Itoa(len(matching)))
+		if end < len(matching) {
+			next := *request.URL
+			query := next.Query()
+			query.Set("page", strconv.Itoa(page+1))
+			query.Set("perPage", strconv.Itoa(perPage))
+			next.RawQuery = query.Encode()
+			writer.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+		}
+
+		// Only the repositories of the page are read
+		data := make([]interface{}, end-start)
+		for i, location := range matching[start:end] {
+			repository, err := scanner.Describe(location)
+			if err != nil {
+				response.WriteError(writer, http.StatusInternalServerError, err)
+				return
+			}
+			data[i] = repository
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package discovery_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/discovery"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestGetRepositoriesDescribesAPage(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/a", true)
+	initRepository(t, fileSystem, "/srv/b", false)
+	initRepository(t, fileSystem, "/srv/c", true)
+	handler := discovery.NewGetRepositoriesHandler(
+		discovery.NewScanner(fileSystem, []string{"/srv"}, nil))
+
+	req, _ := http.NewRequest("GET", "/repositories?page=2&perPage=1", nil)
+	res := httptest.NewRecorder()
+	handler(res, req)
+
+	assert.Equal(http.StatusOK, res.Code)
+	assert.Equal("3", res.Header().Get("X-Total-Count"))
+	assert.Equal(`</repositories?page=3&perPage=1>; rel="next"`, res.Header().Get("Link"))
+
+	var payload struct {
+		Data []discovery.Repository `json:"data"`
+	}
+	assert.NoError(json.NewDecoder(res.Body).Decode(&payload))
+	assert.Len(payload.Data, 1)
+	assert.Equal("b", payload.Data[0].Name)
+	assert.False(payload.Data[0].Bare)
+	assert.Equal(committedAt.Format(time.RFC3339), payload.Data[0].LastCommitAt)
+	assert.True(payload.Data[0].Size > 0)
+}
@@ -0,0 +1,173 @@
+// Package event tells the parts of the server that react to changes of
+// repositories about the references that changed, whichever way they changed
+package event
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+type Change struct {
+	// The reference that changed
+	//
+	// required: true
+	// example: refs/heads/master
+	Reference string `json:"reference"`
+
+	// The hash the reference pointed to, zero when it was created
+	//
+	// required: true
+	// example: 0000000000000000000000000000000000000000
+	Before string `json:"before"`
+
+	// The hash the reference points to, zero when it was deleted
+	//
+	// required: true
+	// example: 2b9dd4a8d0e7e1d4f4ae2ee1b4c1d0d4b3f5c6e7
+	After string `json:"after"`
+}
+
+// IsCreate reports whether the reference did not exist before
+func (change Change) IsCreate() bool {
+	return plumbing.NewHash(change.Before).IsZero()
+}
+
+// IsDelete reports whether the reference was removed
+func (change Change) IsDelete() bool {
+	return plumbing.NewHash(change.After).IsZero()
+}
+
+// Event reports the references of a repository that changed together
+type Event struct {
+	// Repository is where the repository is stored
+	Repository string
+	// Changes are sorted by reference
+	Changes []Change
+	// At is when the references changed
+	At time.Time
+}
+
+// Bus delivers the events published to it to every subscriber
+type Bus struct {
+	mutex    sync.Mutex
+	next     int
+	handlers map[int]func(Event)
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[int]func(Event))}
+}
+
+// Subscribe calls handler with every event published until unsubscribe is
+// called. Handlers are called on the publishing goroutine, so they must hand
+// slow work off to their own goroutines.
+func (bus *Bus) Subscribe(handler func(Event)) (unsubscribe func()) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	id := bus.next
+	bus.next++
+	bus.handlers[id] = handler
+
+	return func() {
+		bus.mutex.Lock()
+		defer bus.mutex.Unlock()
+
+		delete(bus.handlers, id)
+	}
+}
+
+// Publish delivers the event to the subscribers
+func (bus *Bus) Publish(event Event) {
+	bus.mutex.Lock()
+	handlers := make([]func(Event), 0, len(bus.handlers))
+	for _, handler := range bus.handlers {
+		handlers = append(handlers, handler)
+	}
+	bus.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Watch runs change, and publishes the references of the repository stored
+// at repositoryPath that it changed
+func (bus *Bus) Watch(repositoryPath string, s storer.ReferenceStorer, change func() error) error {
+	before, err := Snapshot(s)
+	if err != nil {
+		return err
+	}
+
+	changeErr := change()
+
+	// Changes that failed halfway may still have updated some references
+	after, err := Snapshot(s)
+	if err != nil {
+		return err
+	}
+	if changes := Diff(before, after); len(changes) > 0 {
+		bus.Publish(Event{
+			Repository: repositoryPath,
+			Changes:    changes,
+			At:         time.Now(),
+		})
+	}
+
+	return changeErr
+}
+
+// Snapshot returns the hashes the references of a repository point to.
+// Symbolic references such as HEAD are left out.
+func Snapshot(s storer.ReferenceStorer) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	iter, err := s.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[plumbing.ReferenceName]plumbing.Hash)
+	err = iter.ForEach(func(reference *plumbing.Reference) error {
+		if reference.Type() == plumbing.HashReference {
+			snapshot[reference.Name()] = reference.Hash()
+		}
+
+		return nil
+	})
+
+	return snapshot, err
+}
+
+// Diff returns the references that differ between two snapshots, sorted by
+// reference
+func Diff(before, after map[plumbing.ReferenceName]plumbing.Hash) []Change {
+	var changes []Change
+	for name, hash := range after {
+		if before[name] != hash {
+			changes = append(changes, Change{
+				Reference: name.String(),
+				Before:    before[name].String(),
+				After:     hash.String(),
+			})
+		}
+	}
+	for name, hash := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, Change{
+				Reference: name.String(),
+				Before:    hash.String(),
+				After:     plumbing.ZeroHash.String(),
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Reference < changes[j].Reference
+	})
+
+	return changes
+}
@@ -0,0 +1,77 @@
+package event_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+var (
+	first  = plumbing.NewHash("1111111111111111111111111111111111111111")
+	second = plumbing.NewHash("2222222222222222222222222222222222222222")
+)
+
+func TestDiffReportsCreatedUpdatedAndDeletedReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	changes := event.Diff(
+		map[plumbing.ReferenceName]plumbing.Hash{
+			"refs/heads/master":  first,
+			"refs/heads/removed": first,
+			"refs/tags/v1":       first,
+		},
+		map[plumbing.ReferenceName]plumbing.Hash{
+			"refs/heads/master": second,
+			"refs/heads/added":  second,
+			"refs/tags/v1":      first,
+		})
+
+	assert.Equal([]event.Change{
+		{Reference: "refs/heads/added", Before: plumbing.ZeroHash.String(), After: second.String()},
+		{Reference: "refs/heads/master", Before: first.String(), After: second.String()},
+		{Reference: "refs/heads/removed", Before: first.String(), After: plumbing.ZeroHash.String()},
+	}, changes)
+	assert.True(changes[0].IsCreate())
+	assert.False(changes[1].IsCreate() || changes[1].IsDelete())
+	assert.True(changes[2].IsDelete())
+}
+
+func TestWatchPublishesTheChangedReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	s := memory.NewStorage()
+	assert.NoError(s.SetReference(plumbing.NewHashReference("refs/heads/master", first)))
+	assert.NoError(s.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master")))
+
+	bus := event.NewBus()
+	var published []event.Event
+	unsubscribe := bus.Subscribe(func(changed event.Event) {
+		published = append(published, changed)
+	})
+
+	// Changes that fail still publish what they changed
+	failure := errors.New("connection reset")
+	err := bus.Watch("/srv/project.git", s, func() error {
+		assert.NoError(s.SetReference(plumbing.NewHashReference("refs/heads/master", second)))
+		return failure
+	})
+	assert.Equal(failure, err)
+
+	assert.NoError(bus.Watch("/srv/project.git", s, func() error { return nil }))
+
+	assert.Len(published, 1)
+	assert.Equal("/srv/project.git", published[0].Repository)
+	assert.Equal([]event.Change{
+		{Reference: "refs/heads/master", Before: first.String(), After: second.String()},
+	}, published[0].Changes)
+
+	unsubscribe()
+	assert.NoError(bus.Watch("/srv/project.git", s, func() error {
+		return s.RemoveReference("refs/heads/master")
+	}))
+	assert.Len(published, 1)
+}
@@ -0,0 +1,41 @@
+package git
+
+import "errors"
+
+// ErrArchived is returned when changing a repository that was archived
+var ErrArchived = errors.New("repository is archived and read-only")
+
+// ConfigSection is the section of the git config the server keeps its own
+// settings of a repository in
+const ConfigSection = "gitserver"
+
+// IsArchived reports whether the repository was archived, and is read-only
+func IsArchived(repository Repository) (bool, error) {
+	config, err := repository.Storer().Config()
+	if err != nil {
+		return false, err
+	}
+
+	return config.Raw.Section(ConfigSection).Option("archived") == "true", nil
+}
+
+// SetArchived archives the repository, or makes it writable again
+func SetArchived(repository Repository, archived bool) error {
+	s := repository.Storer()
+	config, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	section := config.Raw.Section(ConfigSection)
+	if archived {
+		section.SetOption("archived", "true")
+	} else {
+		section.RemoveOption("archived")
+		if len(section.Options) == 0 && len(section.Subsections) == 0 {
+			config.Raw.RemoveSection(ConfigSection)
+		}
+	}
+
+	return s.SetConfig(config)
+}
@@ -0,0 +1,38 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestSetArchivedMakesRepositoriesReadOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/project.git", "")
+	reader := git.NewReader(fileSystem)
+
+	repository, err := reader.Open("/srv/project.git")
+	assert.NoError(err)
+
+	archived, err := git.IsArchived(repository)
+	assert.NoError(err)
+	assert.False(archived)
+
+	assert.NoError(git.SetArchived(repository, true))
+
+	// The flag is kept in the git config, so it outlives the repository value
+	repository, err = reader.Open("/srv/project.git")
+	assert.NoError(err)
+	archived, err = git.IsArchived(repository)
+	assert.NoError(err)
+	assert.True(archived)
+
+	assert.NoError(git.SetArchived(repository, false))
+	archived, err = git.IsArchived(repository)
+	assert.NoError(err)
+	assert.False(archived)
+}
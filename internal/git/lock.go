@@ -0,0 +1,64 @@
+package git
+
+import (
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// referenceLock serializes the reference updates of one repository
+type referenceLock struct {
+	sync.Mutex
+	holders int
+}
+
+var (
+	referenceLocksMutex sync.Mutex
+	referenceLocks      = make(map[interface{}]*referenceLock)
+)
+
+// LockReferences locks the references of the repository s stores, so that
+// checking the current value of references and changing them happen as one
+// step. The storer's own compare-and-set cannot be used because it only reads
+// loose references, and fails for those that exist only in packed-refs.
+//
+// Every storage opened on the same git directory shares the lock. It returns
+// the function that unlocks the references.
+func LockReferences(s storer.ReferenceStorer) func() {
+	key := referenceLockKey(s)
+
+	referenceLocksMutex.Lock()
+	lock, ok := referenceLocks[key]
+	if !ok {
+		lock = &referenceLock{}
+		referenceLocks[key] = lock
+	}
+	lock.holders++
+	referenceLocksMutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		referenceLocksMutex.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(referenceLocks, key)
+		}
+		referenceLocksMutex.Unlock()
+	}
+}
+
+// referenceLockKey identifies the repository s stores by its git directory,
+// since each request opens a storage of its own. Storages without one, such
+// as in-memory storages, are their own key.
+func referenceLockKey(s storer.ReferenceStorer) interface{} {
+	if stored, ok := s.(interface{ Filesystem() billy.Filesystem }); ok {
+		return filepath.Clean(stored.Filesystem().Root())
+	}
+
+	return s
+}
@@ -0,0 +1,51 @@
+package git_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestLockReferencesIsSharedByEveryStorageOfARepository(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/project.git", "")
+	initRepository(t, fileSystem, "/srv/other.git", "")
+	reader := git.NewReader(fileSystem)
+
+	open := func(path string) git.Repository {
+		repository, err := reader.Open(path)
+		assert.NoError(err)
+		return repository
+	}
+
+	unlock := git.LockReferences(open("/srv/project.git").Storer())
+
+	// Other repositories are not held up
+	git.LockReferences(open("/srv/other.git").Storer())()
+	git.LockReferences(memory.NewStorage())()
+
+	locked := make(chan struct{})
+	go func() {
+		git.LockReferences(open("/srv/project.git").Storer())()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("the references were locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("the references were not unlocked")
+	}
+}
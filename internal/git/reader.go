@@ -3,7 +3,7 @@ package git
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/src-d/go-billy.v4"
@@ -14,12 +14,17 @@ import (
 
 const dotGitFolderName = ".git"
 
+// gitfilePrefix starts the contents of the .git file of submodules and
+// worktrees
+const gitfilePrefix = "gitdir: "
+
 type Reader interface {
 	Open(path string) (Repository, error)
 }
 
 type StorageReader struct {
 	fileSystem billy.Filesystem
+	sandbox    *Sandbox
 }
 
 func NewReader(fileSystem billy.Filesystem) Reader {
@@ -28,20 +33,106 @@ func NewReader(fileSystem billy.Filesystem) Reader {
 	}
 }
 
+// NewSandboxedReader creates a reader that only opens repositories within the
+// roots of the sandbox. Paths are resolved to absolute paths, so the
+// filesystem must be rooted at the root of the host.
+func NewSandboxedReader(fileSystem billy.Filesystem, sandbox *Sandbox) Reader {
+	return &StorageReader{
+		fileSystem: fileSystem,
+		sandbox:    sandbox,
+	}
+}
+
+// Locator finds where repositories are stored
+type Locator interface {
+	// Locate returns the path of the repository at path, resolved like Open
+	// resolves it
+	Locate(path string) (string, error)
+}
+
+// Locate returns where the repository at path is stored when reader can
+// locate repositories, and path itself otherwise
+func Locate(reader Reader, path string) string {
+	if locator, ok := reader.(Locator); ok {
+		if location, err := locator.Locate(path); err == nil {
+			return location
+		}
+	}
+
+	return path
+}
+
+// Locate returns where the repository at path is stored, with the sandbox
+// and the .git suffix of bare repositories taken into account
+func (reader *StorageReader) Locate(path string) (string, error) {
+	path, folder, err := reader.locate(path)
+	if err != nil {
+		return "", err
+	}
+	if folder == "" {
+		return "", gogit.ErrRepositoryNotExists
+	}
+
+	return path, nil
+}
+
+// locate resolves the path of a repository and finds its git directory
+func (reader *StorageReader) locate(path string) (string, string, error) {
+	if reader.sandbox != nil {
+		resolved, err := reader.sandbox.Resolve(path)
+		if err != nil {
+			return "", "", err
+		}
+		path = resolved
+	}
+
+	folder := FindGitDirectory(reader.fileSystem, path)
+
+	// Like git daemon, fall back to the conventional name of bare
+	// repositories, so that project.git is served at project.git rather
+	// than project.git.git
+	if folder == "" {
+		if bareFolder := FindGitDirectory(reader.fileSystem, path+".git"); bareFolder != "" {
+			path += ".git"
+			folder = bareFolder
+		}
+	}
+
+	// A gitfile could point to a git directory outside of the roots
+	if reader.sandbox != nil && folder != "" {
+		resolved, _, err := evalSymlinks(folder)
+		if err != nil {
+			return "", "", err
+		}
+		if !reader.sandbox.Contains(resolved) {
+			return "", "", ErrOutsideRoot
+		}
+	}
+
+	return path, folder, nil
+}
+
 // Open opens a git repository from the given path
 func (reader *StorageReader) Open(path string) (Repository, error) {
-	folder := findDotGitFolder(path)
-
-	dotgitFolder, err := reader.fileSystem.Chroot(folder)
+	path, folder, err := reader.locate(path)
 	if err != nil {
 		return nil, err
 	}
 
-	repoRoot, err := reader.fileSystem.Chroot(path)
+	dotgitFolder, err := reader.fileSystem.Chroot(folder)
 	if err != nil {
 		return nil, err
 	}
 
+	// Bare repositories are their own git directory and have no worktree
+	var repoRoot billy.Filesystem
+	if folder != path {
+		repoRoot, err = reader.fileSystem.Chroot(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	storage := filesystem.NewStorageWithOptions(
 		dotgitFolder,
 		cache.NewObjectLRUDefault(),
@@ -54,9 +145,41 @@ func (reader *StorageReader) Open(path string) (Repository, error) {
 	return &GitRepository{Wrapee: repo}, nil
 }
 
-func findDotGitFolder(path string) string {
+// FindGitDirectory returns the git directory of the repository at path,
+// which is path itself for bare repositories. It returns "" when there is no
+// repository at path.
+func FindGitDirectory(fileSystem billy.Filesystem, path string) string {
+	if folder := findDotGitFolder(fileSystem, path); folder != "" {
+		return folder
+	}
+
+	if isBareRepository(fileSystem, path) {
+		return path
+	}
+
+	return ""
+}
+
+// isBareRepository reports whether path has the layout of a git directory
+func isBareRepository(fileSystem billy.Filesystem, path string) bool {
+	head, err := fileSystem.Stat(fmt.Sprintf("%s/HEAD", path))
+	if err != nil || head.IsDir() {
+		return false
+	}
+
+	for _, folder := range []string{"objects", "refs"} {
+		stat, err := fileSystem.Stat(fmt.Sprintf("%s/%s", path, folder))
+		if err != nil || !stat.IsDir() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func findDotGitFolder(fileSystem billy.Filesystem, path string) string {
 	dotGitPath := fmt.Sprintf("%s/.git", path)
-	dotGitStat, err := os.Stat(dotGitPath)
+	dotGitStat, err := fileSystem.Stat(dotGitPath)
 	if err != nil {
 		return ""
 	}
@@ -66,15 +189,27 @@ func findDotGitFolder(path string) string {
 		return dotGitPath
 	}
 
-	dotGitData, err := ioutil.ReadFile(dotGitPath)
+	dotGitFile, err := fileSystem.Open(dotGitPath)
 	if err != nil {
 		return ""
 	}
+	defer dotGitFile.Close()
 
-	relativeDotGitPath := strings.Trim(
-		fmt.Sprintf("%s/%s",
-			path,
-			strings.Split(string(dotGitData), " ")[1]), "\n")
+	dotGitData, err := ioutil.ReadAll(dotGitFile)
+	if err != nil {
+		return ""
+	}
+
+	gitdir := strings.TrimSpace(string(dotGitData))
+	if !strings.HasPrefix(gitdir, gitfilePrefix) {
+		return ""
+	}
+	gitdir = strings.TrimPrefix(gitdir, gitfilePrefix)
+
+	// Worktrees created by git write absolute paths into their gitfiles
+	if filepath.IsAbs(gitdir) {
+		return gitdir
+	}
 
-	return relativeDotGitPath
+	return fmt.Sprintf("%s/%s", path, gitdir)
 }
@@ -0,0 +1,65 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+func initRepository(t *testing.T, fileSystem billy.Filesystem, gitDirectory string, worktree string) {
+	dotgitFolder, err := fileSystem.Chroot(gitDirectory)
+	assert.NoError(t, err)
+
+	var worktreeFolder billy.Filesystem
+	if worktree != "" {
+		worktreeFolder, err = fileSystem.Chroot(worktree)
+		assert.NoError(t, err)
+	}
+
+	_, err = gogit.Init(
+		filesystem.NewStorage(dotgitFolder, cache.NewObjectLRUDefault()),
+		worktreeFolder)
+	assert.NoError(t, err)
+}
+
+func TestReaderOpensBareRepositories(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/project.git", "")
+
+	assert.Equal("/srv/project.git", git.FindGitDirectory(fileSystem, "/srv/project.git"))
+
+	for _, path := range []string{"/srv/project.git", "/srv/project"} {
+		repository, err := git.NewReader(fileSystem).Open(path)
+		assert.NoError(err)
+		assert.True(repository.IsBare())
+	}
+}
+
+func TestReaderOpensRepositoriesWithAWorktree(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	initRepository(t, fileSystem, "/srv/project/.git", "/srv/project")
+	initRepository(t, fileSystem, "/srv/modules/library", "/srv/library")
+	assert.NoError(util.WriteFile(fileSystem, "/srv/library/.git",
+		[]byte("gitdir: ../modules/library\n"), 0644))
+
+	assert.Equal("/srv/project/.git", git.FindGitDirectory(fileSystem, "/srv/project"))
+	assert.Equal("/srv/library/../modules/library", git.FindGitDirectory(fileSystem, "/srv/library"))
+	assert.Empty(git.FindGitDirectory(fileSystem, "/srv"))
+
+	for _, path := range []string{"/srv/project", "/srv/library"} {
+		repository, err := git.NewReader(fileSystem).Open(path)
+		assert.NoError(err)
+		assert.False(repository.IsBare())
+	}
+}
@@ -0,0 +1,58 @@
+package git
+
+import (
+	"net/url"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// MirrorRefSpec copies every reference of a remote as it is, like
+// git clone --mirror
+const MirrorRefSpec = config.RefSpec("+refs/*:refs/*")
+
+// RemoteHead returns the branch HEAD points to in the advertised references
+// of a remote. Remotes that do not advertise where HEAD points to get the
+// first branch HEAD is at, preferring master.
+func RemoteHead(references []*plumbing.Reference) plumbing.ReferenceName {
+	var head *plumbing.Reference
+	for _, reference := range references {
+		if reference.Name() == plumbing.HEAD {
+			head = reference
+		}
+	}
+	if head == nil {
+		return ""
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target()
+	}
+
+	var candidate plumbing.ReferenceName
+	for _, reference := range references {
+		if !reference.Name().IsBranch() || reference.Hash() != head.Hash() {
+			continue
+		}
+		if reference.Name() == plumbing.Master {
+			return reference.Name()
+		}
+		if candidate == "" || reference.Name() < candidate {
+			candidate = reference.Name()
+		}
+	}
+
+	return candidate
+}
+
+// RedactURL hides the password of a remote URL, so that it can be shown
+func RedactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL
+	}
+	if _, ok := parsed.User.Password(); !ok {
+		return rawURL
+	}
+
+	return parsed.Redacted()
+}
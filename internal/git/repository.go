@@ -1,12 +1,24 @@
 package git
 
 import (
+	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 )
 
+// ErrObjectNotFound is returned when an object does not exist in the repository
+var ErrObjectNotFound = plumbing.ErrObjectNotFound
+
 type Hash [20]byte
 
+// NewHash parses a hexadecimal hash string
+func NewHash(hash string) Hash {
+	return Hash(plumbing.NewHash(hash))
+}
+
 func (hash Hash) String() string {
 	return plumbing.Hash(hash).String()
 }
@@ -24,6 +36,12 @@ type Repository interface {
 	Log(options *LogOptions) (CommitIter, error)
 	Reference(name ReferenceName) (Reference, error)
 	References() (ReferenceIter, error)
+	ReferencesContaining(hash Hash) ([]Reference, error)
+	ResolveRevision(revision string) (Hash, error)
+	Storer() storage.Storer
+	GitDirectory() billy.Filesystem
+	Worktree() billy.Filesystem
+	IsBare() bool
 }
 
 type GitRepository struct {
@@ -73,3 +91,147 @@ func (repo *GitRepository) Reference(name ReferenceName) (Reference, error) {
 
 	return &GitReference{Wrapee: wrapped}, nil
 }
+
+// ResolveRevision resolves a revision such as a branch, a tag, a hash or an
+// expression like HEAD~2 to the hash it designates
+func (repo *GitRepository) ResolveRevision(revision string) (Hash, error) {
+	hash, err := repo.Wrapee.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return Hash(*hash), nil
+}
+
+// Storer returns the underlying object and reference storage, which the
+// transport protocols operate on directly
+func (repo *GitRepository) Storer() storage.Storer {
+	return repo.Wrapee.Storer
+}
+
+// GitDirectory returns the filesystem rooted at the repository's git
+// directory, where server side data such as LFS objects is kept
+func (repo *GitRepository) GitDirectory() billy.Filesystem {
+	storage, ok := repo.Wrapee.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+
+	return storage.Filesystem()
+}
+
+// Worktree returns the filesystem rooted at the repository's worktree, or nil
+// for bare repositories
+func (repo *GitRepository) Worktree() billy.Filesystem {
+	worktree, err := repo.Wrapee.Worktree()
+	if err != nil {
+		return nil
+	}
+
+	return worktree.Filesystem
+}
+
+// IsBare reports whether the repository was opened without a worktree
+func (repo *GitRepository) IsBare() bool {
+	_, err := repo.Wrapee.Worktree()
+
+	return err == git.ErrIsBareRepository
+}
+
+// ReferencesContaining returns every branch and tag whose history includes
+// the specified commit
+func (repo *GitRepository) ReferencesContaining(hash Hash) ([]Reference, error) {
+	target, err := repo.Wrapee.CommitObject(plumbing.Hash(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	refIter, err := repo.Wrapee.References()
+	if err != nil {
+		return nil, err
+	}
+	defer refIter.Close()
+
+	// Commits that were fully walked without finding the target can never
+	// contain it, so they are shared between walks of different references.
+	excluded := make(map[plumbing.Hash]bool)
+
+	var containing []Reference
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		if !name.IsBranch() && !name.IsTag() {
+			return nil
+		}
+
+		tip, err := repo.peelToCommit(ref.Hash())
+		if err != nil {
+			// Tags can point to trees and blobs, which contain no history
+			return nil
+		}
+
+		found, err := reaches(tip, target.Hash, excluded)
+		if err != nil {
+			return err
+		}
+		if found {
+			containing = append(containing, &GitReference{Wrapee: ref})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return containing, nil
+}
+
+func (repo *GitRepository) peelToCommit(hash plumbing.Hash) (*object.Commit, error) {
+	for {
+		tag, err := repo.Wrapee.TagObject(hash)
+		if err != nil {
+			break
+		}
+
+		hash = tag.Target
+	}
+
+	return repo.Wrapee.CommitObject(hash)
+}
+
+func reaches(
+	from *object.Commit,
+	target plumbing.Hash,
+	excluded map[plumbing.Hash]bool,
+) (bool, error) {
+	visited := make(map[plumbing.Hash]bool)
+	pending := []*object.Commit{from}
+
+	for len(pending) > 0 {
+		commit := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if commit.Hash == target {
+			return true, nil
+		}
+		if visited[commit.Hash] || excluded[commit.Hash] {
+			continue
+		}
+		visited[commit.Hash] = true
+
+		err := commit.Parents().ForEach(func(parent *object.Commit) error {
+			pending = append(pending, parent)
+
+			return nil
+		})
+		if err != nil && err != plumbing.ErrObjectNotFound {
+			return false, err
+		}
+	}
+
+	for hash := range visited {
+		excluded[hash] = true
+	}
+
+	return false, nil
+}
@@ -0,0 +1,159 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoot is returned for repository paths that are not confined to a
+// repository root
+var ErrOutsideRoot = errors.New("repository is outside of the repository roots")
+
+// Sandbox confines repository paths to a set of root directories
+type Sandbox struct {
+	roots    []string
+	excluded []string
+}
+
+// NewSandbox creates a sandbox for the root directories
+func NewSandbox(roots ...string) (*Sandbox, error) {
+	if len(roots) == 0 {
+		return nil, errors.New("a sandbox needs at least one root")
+	}
+
+	sandbox := &Sandbox{}
+	for _, root := range roots {
+		absolute, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+
+		// Roots are compared against paths whose links are resolved
+		resolved, err := filepath.EvalSymlinks(absolute)
+		if err != nil {
+			return nil, err
+		}
+
+		sandbox.roots = append(sandbox.roots, resolved)
+	}
+
+	return sandbox, nil
+}
+
+// Roots returns the root directories of the sandbox
+func (sandbox *Sandbox) Roots() []string {
+	return append([]string{}, sandbox.roots...)
+}
+
+// Exclude takes directory out of the sandbox, so that the repositories
+// under it cannot be opened even though it lies within a root
+func (sandbox *Sandbox) Exclude(directory string) error {
+	absolute, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+
+	// The directory may not have been created yet
+	resolved, _, err := evalSymlinks(absolute)
+	if err != nil {
+		return err
+	}
+
+	sandbox.excluded = append(sandbox.excluded, resolved)
+	return nil
+}
+
+// Resolve returns the absolute path of a repository, with symbolic links
+// resolved. Absolute paths must lie within a root. Relative paths are looked
+// up in each root in turn, and resolve to the first root they exist in, or
+// to the first root if they exist in none.
+func (sandbox *Sandbox) Resolve(path string) (string, error) {
+	for _, element := range strings.Split(filepath.ToSlash(path), "/") {
+		if element == ".." {
+			return "", ErrOutsideRoot
+		}
+	}
+
+	var candidates []string
+	if filepath.IsAbs(path) {
+		candidates = []string{filepath.Clean(path)}
+	} else {
+		for _, root := range sandbox.roots {
+			candidates = append(candidates, filepath.Join(root, path))
+		}
+	}
+
+	var fallback string
+	for i, candidate := range candidates {
+		resolved, exists, err := evalSymlinks(candidate)
+		if err != nil {
+			return "", err
+		}
+
+		if !sandbox.Contains(resolved) {
+			return "", ErrOutsideRoot
+		}
+		if exists {
+			return resolved, nil
+		}
+		if i == 0 {
+			fallback = resolved
+		}
+	}
+
+	return fallback, nil
+}
+
+// Contains reports whether an absolute path lies within a root, and not
+// within an excluded directory. The path is compared as is, so links must
+// already be resolved.
+func (sandbox *Sandbox) Contains(path string) bool {
+	for _, directory := range sandbox.excluded {
+		if within(path, directory) {
+			return false
+		}
+	}
+
+	for _, root := range sandbox.roots {
+		if within(path, root) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// within reports whether path is directory or lies under it
+func within(path string, directory string) bool {
+	return path == directory ||
+		strings.HasPrefix(path, directory+string(filepath.Separator)) ||
+		directory == string(filepath.Separator)
+}
+
+// evalSymlinks resolves the symbolic links of the longest part of the path
+// that exists, so that paths yet to be created are resolved too. It reports
+// whether the whole path exists.
+func evalSymlinks(path string) (string, bool, error) {
+	existing := path
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			parts := append([]string{resolved}, missing...)
+			return filepath.Join(parts...), len(missing) == 0, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", false, err
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, false, nil
+		}
+
+		missing = append([]string{filepath.Base(existing)}, missing...)
+		existing = parent
+	}
+}
@@ -0,0 +1,110 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+// newRoots creates a root with a repository directory in it, and a directory
+// outside of the root
+func newRoots(t *testing.T) (root string, outside string, cleanup func()) {
+	directory, err := ioutil.TempDir("", "gitserver-sandbox")
+	assert.NoError(t, err)
+
+	// The temporary directory may itself be behind a link
+	directory, err = filepath.EvalSymlinks(directory)
+	assert.NoError(t, err)
+
+	root = filepath.Join(directory, "root")
+	outside = filepath.Join(directory, "outside")
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "team", "project"), 0755))
+	assert.NoError(t, os.MkdirAll(outside, 0755))
+
+	return root, outside, func() { os.RemoveAll(directory) }
+}
+
+func TestSandboxResolvesPathsWithinTheRoot(t *testing.T) {
+	assert := assert.New(t)
+	root, _, cleanup := newRoots(t)
+	defer cleanup()
+
+	sandbox, err := git.NewSandbox(root)
+	assert.NoError(err)
+
+	resolved, err := sandbox.Resolve("team/project")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(root, "team", "project"), resolved)
+
+	resolved, err = sandbox.Resolve(filepath.Join(root, "team", "project"))
+	assert.NoError(err)
+	assert.Equal(filepath.Join(root, "team", "project"), resolved)
+
+	resolved, err = sandbox.Resolve("team/new")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(root, "team", "new"), resolved)
+}
+
+func TestSandboxRejectsPathsOutsideTheRoot(t *testing.T) {
+	assert := assert.New(t)
+	root, outside, cleanup := newRoots(t)
+	defer cleanup()
+
+	assert.NoError(os.Symlink(outside, filepath.Join(root, "escape")))
+
+	sandbox, err := git.NewSandbox(root)
+	assert.NoError(err)
+
+	for _, path := range []string{
+		"../outside",
+		"team/../../outside",
+		outside,
+		filepath.Join(root, "..", "outside"),
+		"escape",
+		"escape/project",
+	} {
+		_, err := sandbox.Resolve(path)
+		assert.Equal(git.ErrOutsideRoot, err, path)
+	}
+}
+
+func TestSandboxedReaderRejectsPathsOutsideTheRoot(t *testing.T) {
+	assert := assert.New(t)
+	root, outside, cleanup := newRoots(t)
+	defer cleanup()
+
+	sandbox, err := git.NewSandbox(root)
+	assert.NoError(err)
+
+	reader := git.NewSandboxedReader(osfs.New("/"), sandbox)
+	_, err = reader.Open(outside)
+	assert.Equal(git.ErrOutsideRoot, err)
+}
+
+func TestSandboxRejectsPathsInExcludedDirectories(t *testing.T) {
+	assert := assert.New(t)
+	root, _, cleanup := newRoots(t)
+	defer cleanup()
+
+	sandbox, err := git.NewSandbox(root)
+	assert.NoError(err)
+	assert.NoError(sandbox.Exclude(filepath.Join(root, ".trash")))
+
+	for _, path := range []string{
+		".trash",
+		".trash/project.git",
+		filepath.Join(root, ".trash", "project.git"),
+	} {
+		_, err := sandbox.Resolve(path)
+		assert.Equal(git.ErrOutsideRoot, err, path)
+	}
+
+	resolved, err := sandbox.Resolve("team/project")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(root, "team", "project"), resolved)
+}
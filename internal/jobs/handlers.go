@@ -0,0 +1,117 @@
+package jobs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+)
+
+// List of background jobs
+// swagger:response GetJobsOkResponse
+type GetJobsOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Job `json:"data,omitempty"`
+	}
+}
+
+// The background job
+// swagger:response JobOkResponse
+type JobOkResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Job `json:"data,omitempty"`
+	}
+}
+
+// The job was started. Its progress can be followed at the URL in the
+// Location header.
+// swagger:response JobAcceptedResponse
+type JobAcceptedResponse struct {
+	// The URL of the job
+	Location string `json:"Location"`
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Job `json:"data,omitempty"`
+	}
+}
+
+// swagger:parameters getJob
+type JobParams struct {
+	// The job identifier
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+func writeJob(writer http.ResponseWriter, statusCode int, job Job) {
+	dataPayload := response.Payload{
+		Data: []interface{}{job},
+	}
+
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+		panic(err)
+	}
+}
+
+// WriteAccepted answers a request that started job with 202 Accepted
+func WriteAccepted(writer http.ResponseWriter, job Job) {
+	writer.Header().Set("Location", "/v1/jobs/"+job.ID)
+	writeJob(writer, http.StatusAccepted, job)
+}
+
+// NewGetJobsHandler lists the background jobs
+func NewGetJobsHandler(runner *Runner) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		jobs := runner.List()
+
+		data := make([]interface{}, len(jobs))
+		for i := range jobs {
+			data[i] = jobs[i]
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewGetJobHandler returns a background job
+func NewGetJobHandler(runner *Runner) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		job, ok := runner.Find(mux.Vars(request)["id"])
+		if !ok {
+			errorPayload := response.Payload{
+				Errors: map[string]interface{}{
+					"error": ErrJobNotFound.Error(),
+				},
+			}
+			writer.WriteHeader(http.StatusNotFound)
+			if err := json.NewEncoder(writer).Encode(&errorPayload); err != nil {
+				panic(err)
+			}
+			return
+		}
+
+		writeJob(writer, http.StatusOK, job)
+	}
+}
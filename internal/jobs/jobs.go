@@ -0,0 +1,232 @@
+// Package jobs runs long operations in the background and keeps track of
+// their progress, so that requests can return before they finish
+package jobs
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrJobNotFound is returned when no job has the requested identifier
+var ErrJobNotFound = errors.New("job does not exist")
+
+// maxFinished is how many finished jobs are remembered
+const maxFinished = 100
+
+type Status string
+
+const (
+	// Queued jobs wait for a worker
+	Queued Status = "queued"
+	// Running jobs are being worked on
+	Running Status = "running"
+	// Succeeded jobs finished without an error
+	Succeeded Status = "succeeded"
+	// Failed jobs finished with an error
+	Failed Status = "failed"
+)
+
+type Job struct {
+	// The job identifier
+	//
+	// required: true
+	// example: 0b9a0e5f-4f6d-4d7e-9a51-6f1c3c3c0c1e
+	ID string `json:"id"`
+
+	// What the job does
+	//
+	// required: true
+	// example: import
+	Kind string `json:"kind"`
+
+	// Whether the job is queued, running, succeeded or failed
+	//
+	// required: true
+	// example: running
+	Status Status `json:"status"`
+
+	// The last progress message of the job
+	//
+	// example: Receiving objects:  45% (450/1000)
+	Progress string `json:"progress,omitempty"`
+
+	// Why the job failed
+	Error string `json:"error,omitempty"`
+
+	// What the job produced once it succeeded
+	Result interface{} `json:"result,omitempty"`
+
+	// When the job was created
+	//
+	// required: true
+	// example: 2019-05-26T12:41:18-04:00
+	CreatedAt string `json:"createdAt"`
+
+	// When the job finished
+	//
+	// example: 2019-05-26T12:41:20-04:00
+	FinishedAt string `json:"finishedAt,omitempty"`
+
+	created  time.Time
+	finished time.Time
+}
+
+// Work is the work of a job. It reports its progress to progress, with
+// messages separated by carriage returns or new lines, as git reports it.
+type Work func(progress io.Writer) (interface{}, error)
+
+// Runner runs jobs on a limited number of workers
+type Runner struct {
+	mutex   sync.Mutex
+	jobs    map[string]*Job
+	workers chan struct{}
+}
+
+// NewRunner creates a runner that runs up to concurrency jobs at once
+func NewRunner(concurrency int) *Runner {
+	return &Runner{
+		jobs:    make(map[string]*Job),
+		workers: make(chan struct{}, concurrency),
+	}
+}
+
+// Start queues work and returns the job tracking it
+func (runner *Runner) Start(kind string, work Work) Job {
+	now := time.Now()
+	job := &Job{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		Status:    Queued,
+		CreatedAt: now.Format(time.RFC3339),
+		created:   now,
+	}
+
+	runner.mutex.Lock()
+	runner.jobs[job.ID] = job
+	snapshot := *job
+	runner.mutex.Unlock()
+
+	go runner.run(job, work)
+
+	return snapshot
+}
+
+func (runner *Runner) run(job *Job, work Work) {
+	runner.workers <- struct{}{}
+	defer func() { <-runner.workers }()
+
+	runner.update(func() { job.Status = Running })
+
+	result, err := work(&progressWriter{runner: runner, job: job})
+
+	runner.update(func() {
+		job.finished = time.Now()
+		job.FinishedAt = job.finished.Format(time.RFC3339)
+		if err != nil {
+			job.Status = Failed
+			job.Error = err.Error()
+			return
+		}
+
+		job.Status = Succeeded
+		job.Result = result
+	})
+	runner.forgetFinished()
+}
+
+func (runner *Runner) update(change func()) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	change()
+}
+
+// forgetFinished drops the oldest finished jobs beyond maxFinished
+func (runner *Runner) forgetFinished() {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	var finished []*Job
+	for _, job := range runner.jobs {
+		if !job.finished.IsZero() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinished {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].finished.Before(finished[j].finished)
+	})
+	for _, job := range finished[:len(finished)-maxFinished] {
+		delete(runner.jobs, job.ID)
+	}
+}
+
+// Find returns the job with the identifier
+func (runner *Runner) Find(id string) (Job, bool) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	job, ok := runner.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return *job, true
+}
+
+// List returns the jobs, most recently created first
+func (runner *Runner) List() []Job {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	jobs := make([]Job, 0, len(runner.jobs))
+	for _, job := range runner.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].created.After(jobs[j].created)
+	})
+
+	return jobs
+}
+
+// progressWriter records the last progress message written to it as the
+// progress of its job
+type progressWriter struct {
+	runner  *Runner
+	job     *Job
+	pending string
+}
+
+func (writer *progressWriter) Write(data []byte) (int, error) {
+	writer.pending += string(data)
+
+	messages := strings.FieldsFunc(writer.pending, func(char rune) bool {
+		return char == '\r' || char == '\n'
+	})
+	complete := strings.HasSuffix(writer.pending, "\r") ||
+		strings.HasSuffix(writer.pending, "\n")
+	if !complete && len(messages) > 0 {
+		writer.pending = messages[len(messages)-1]
+		messages = messages[:len(messages)-1]
+	} else {
+		writer.pending = ""
+	}
+
+	if len(messages) > 0 {
+		message := strings.TrimSpace(messages[len(messages)-1])
+		writer.runner.update(func() { writer.job.Progress = message })
+	}
+
+	return len(data), nil
+}
@@ -0,0 +1,74 @@
+package jobs_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/jobs"
+	"github.com/stretchr/testify/assert"
+)
+
+// wait polls the runner until the job finished
+func wait(t *testing.T, runner *jobs.Runner, id string) jobs.Job {
+	for i := 0; i < 100; i++ {
+		job, ok := runner.Find(id)
+		assert.True(t, ok)
+		if job.FinishedAt != "" {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("job did not finish")
+	return jobs.Job{}
+}
+
+func TestRunnerRecordsProgressAndResult(t *testing.T) {
+	assert := assert.New(t)
+
+	runner := jobs.NewRunner(1)
+	proceed := make(chan struct{})
+	job := runner.Start("import", func(progress io.Writer) (interface{}, error) {
+		fmt.Fprint(progress, "Counting objects: 50% (1/2)\rCounting objects: 100% (2/2), done.\n")
+		fmt.Fprint(progress, "Receiving objects:  10%")
+		<-proceed
+		return "imported", nil
+	})
+	assert.Equal("import", job.Kind)
+	assert.Equal(jobs.Queued, job.Status)
+
+	for i := 0; i < 100; i++ {
+		if job, _ = runner.Find(job.ID); job.Progress != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(jobs.Running, job.Status)
+	assert.Equal("Counting objects: 100% (2/2), done.", job.Progress)
+	close(proceed)
+
+	job = wait(t, runner, job.ID)
+	assert.Equal(jobs.Succeeded, job.Status)
+	assert.Equal("imported", job.Result)
+	assert.Empty(job.Error)
+}
+
+func TestRunnerRecordsFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	runner := jobs.NewRunner(1)
+	job := runner.Start("import", func(progress io.Writer) (interface{}, error) {
+		return nil, errors.New("repository not found")
+	})
+
+	job = wait(t, runner, job.ID)
+	assert.Equal(jobs.Failed, job.Status)
+	assert.Equal("repository not found", job.Error)
+
+	assert.Len(runner.List(), 1)
+	_, ok := runner.Find("missing")
+	assert.False(ok)
+}
@@ -0,0 +1,147 @@
+package key
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+)
+
+// List of registered public keys
+// swagger:response GetKeysOkResponse
+type GetKeysOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The request method
+		//
+		// required: true
+		// example: keys.get
+		Method string `json:"method,omitempty"`
+		// The response data
+		//
+		// required: true
+		Data []Key `json:"data,omitempty"`
+	}
+}
+
+// The registered public key
+// swagger:response CreateKeyCreatedResponse
+type CreateKeyCreatedResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The request method
+		//
+		// required: true
+		// example: keys.post
+		Method string `json:"method,omitempty"`
+		// The response data
+		//
+		// required: true
+		Data []Key `json:"data,omitempty"`
+	}
+}
+
+// The public key was removed
+// swagger:response DeleteKeyNoContentResponse
+type DeleteKeyNoContentResponse struct{}
+
+// swagger:parameters createKey
+type CreateKeyParams struct {
+	// in: body
+	// required: true
+	Body CreateKeyRequest
+}
+
+type CreateKeyRequest struct {
+	// A name to recognize the key by
+	//
+	// example: CI runner
+	Title string `json:"title"`
+
+	// The public key in authorized_keys format
+	//
+	// required: true
+	// example: ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGb0uYF0V8nFjQm3E3Vf1G4m1QGmC5kO4x2lVVyN6vJa ci@example.com
+	Key string `json:"key"`
+}
+
+// swagger:parameters deleteKey
+type DeleteKeyParams struct {
+	// The identifier of the key
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// NewGetKeysHandler lists the registered public keys
+func NewGetKeysHandler(store *Store) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		keys := store.List()
+
+		data := make([]interface{}, len(keys))
+		for i := range keys {
+			data[i] = keys[i]
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewCreateKeyHandler registers a public key
+func NewCreateKeyHandler(store *Store) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body CreateKeyRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		key, err := store.Add(body.Title, body.Key)
+		if err == ErrKeyExists {
+			response.WriteError(writer, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		dataPayload := response.Payload{
+			Data: []interface{}{key},
+		}
+
+		writer.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewDeleteKeyHandler removes a registered public key
+func NewDeleteKeyHandler(store *Store) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+
+		err := store.Remove(vars["id"])
+		if err == ErrKeyNotFound {
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,32 @@
+package key
+
+type Key struct {
+	// The identifier of the key
+	//
+	// required: true
+	// example: 6f1c2a5e-0b8e-4c55-a2a8-3a1d2c3c9d41
+	ID string `json:"id,omitempty"`
+
+	// A name to recognize the key by
+	//
+	// example: CI runner
+	Title string `json:"title,omitempty"`
+
+	// The public key in authorized_keys format
+	//
+	// required: true
+	// example: ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGb0uYF0V8nFjQm3E3Vf1G4m1QGmC5kO4x2lVVyN6vJa
+	Key string `json:"key,omitempty"`
+
+	// The SHA256 fingerprint of the key
+	//
+	// required: true
+	// example: SHA256:wF9S0P1s8d9Yc4dkUQzOjP4fP3s8mE1b7m0c2QYQx0U
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// When the key was registered
+	//
+	// required: true
+	// example: 2019-05-26T12:41:18-04:00
+	CreatedAt string `json:"createdAt,omitempty"`
+}
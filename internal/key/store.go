@@ -0,0 +1,162 @@
+// Package key manages the SSH public keys that are allowed to use the
+// git transport
+package key
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrKeyNotFound is returned when no key has the requested identifier
+	ErrKeyNotFound = errors.New("key does not exist")
+	// ErrKeyExists is returned when the same public key is registered twice
+	ErrKeyExists = errors.New("key is already registered")
+)
+
+// Store holds the registered public keys, persisting them to a JSON file
+type Store struct {
+	path  string
+	mutex sync.RWMutex
+	keys  []Key
+}
+
+// NewStore loads the keys stored at path. An empty path keeps the keys in
+// memory only.
+func NewStore(path string) (*Store, error) {
+	store := &Store{path: path}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.keys); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// List returns every registered key
+func (store *Store) List() []Key {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	keys := make([]Key, len(store.keys))
+	copy(keys, store.keys)
+
+	return keys
+}
+
+// Add registers a public key given in authorized_keys format
+func (store *Store) Add(title string, authorizedKey string) (Key, error) {
+	publicKey, comment, _, _, err := gossh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return Key{}, err
+	}
+
+	if title == "" {
+		title = comment
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.find(publicKey); ok {
+		return Key{}, ErrKeyExists
+	}
+
+	key := Key{
+		ID:          uuid.New().String(),
+		Title:       title,
+		Key:         strings.TrimSpace(string(gossh.MarshalAuthorizedKey(publicKey))),
+		Fingerprint: gossh.FingerprintSHA256(publicKey),
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}
+	store.keys = append(store.keys, key)
+
+	if err := store.save(); err != nil {
+		store.keys = store.keys[:len(store.keys)-1]
+		return Key{}, err
+	}
+
+	return key, nil
+}
+
+// Remove deletes the key with the given identifier
+func (store *Store) Remove(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i, key := range store.keys {
+		if key.ID != id {
+			continue
+		}
+
+		keys := append(append([]Key{}, store.keys[:i]...), store.keys[i+1:]...)
+		previous := store.keys
+		store.keys = keys
+
+		if err := store.save(); err != nil {
+			store.keys = previous
+			return err
+		}
+
+		return nil
+	}
+
+	return ErrKeyNotFound
+}
+
+// Find returns the registered key matching the public key offered by a client
+func (store *Store) Find(publicKey gossh.PublicKey) (Key, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.find(publicKey)
+}
+
+func (store *Store) find(publicKey gossh.PublicKey) (Key, bool) {
+	marshaled := publicKey.Marshal()
+	for _, key := range store.keys {
+		registered, _, _, _, err := gossh.ParseAuthorizedKey([]byte(key.Key))
+		if err != nil {
+			continue
+		}
+
+		if bytes.Equal(registered.Marshal(), marshaled) {
+			return key, true
+		}
+	}
+
+	return Key{}, false
+}
+
+func (store *Store) save() error {
+	if store.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(store.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(store.path, data, 0600)
+}
@@ -0,0 +1,86 @@
+package key_test
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/key"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func newPublicKey(t *testing.T) gossh.PublicKey {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	publicKey, err := gossh.NewPublicKey(public)
+	assert.NoError(t, err)
+
+	return publicKey
+}
+
+func TestStoreFindsRegisteredKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := key.NewStore("")
+	assert.NoError(err)
+
+	publicKey := newPublicKey(t)
+	registered, err := store.Add("",
+		strings.TrimSpace(string(gossh.MarshalAuthorizedKey(publicKey)))+" ci@example.com")
+	assert.NoError(err)
+	assert.Equal("ci@example.com", registered.Title)
+	assert.Equal(gossh.FingerprintSHA256(publicKey), registered.Fingerprint)
+
+	found, ok := store.Find(publicKey)
+	assert.True(ok)
+	assert.Equal(registered, found)
+
+	_, ok = store.Find(newPublicKey(t))
+	assert.False(ok)
+
+	_, err = store.Add("again", string(gossh.MarshalAuthorizedKey(publicKey)))
+	assert.Equal(key.ErrKeyExists, err)
+
+	assert.NoError(store.Remove(registered.ID))
+	assert.Equal(key.ErrKeyNotFound, store.Remove(registered.ID))
+
+	_, ok = store.Find(publicKey)
+	assert.False(ok)
+}
+
+func TestStorePersistsKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "gitserver-keys")
+	assert.NoError(err)
+	defer os.RemoveAll(directory)
+
+	keysPath := path.Join(directory, "keys.json")
+	store, err := key.NewStore(keysPath)
+	assert.NoError(err)
+
+	publicKey := newPublicKey(t)
+	_, err = store.Add("laptop", string(gossh.MarshalAuthorizedKey(publicKey)))
+	assert.NoError(err)
+
+	reloaded, err := key.NewStore(keysPath)
+	assert.NoError(err)
+
+	found, ok := reloaded.Find(publicKey)
+	assert.True(ok)
+	assert.Equal("laptop", found.Title)
+}
+
+func TestStoreRejectsInvalidKeys(t *testing.T) {
+	store, err := key.NewStore("")
+	assert.NoError(t, err)
+
+	_, err = store.Add("", "not a key")
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+// Package lfs stores Git LFS objects and locks for a repository
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+var oidRegex = regexp.MustCompile("^[0-9a-f]{64}$")
+
+var (
+	// ErrObjectNotFound is returned when the backend does not hold an object
+	ErrObjectNotFound = errors.New("object does not exist")
+	// ErrInvalidObject is returned when uploaded content does not match its oid
+	ErrInvalidObject = errors.New("object content does not match its oid")
+)
+
+// ValidOID reports whether oid is a SHA-256 hash in hexadecimal
+func ValidOID(oid string) bool {
+	return oidRegex.MatchString(oid)
+}
+
+// Backend stores LFS objects by their oid
+type Backend interface {
+	// Size returns the size of a stored object
+	Size(oid string) (int64, error)
+	// Open opens a stored object for reading
+	Open(oid string) (io.ReadCloser, error)
+	// Put stores an object, verifying that its content hashes to oid
+	Put(oid string, content io.Reader) error
+}
+
+// NewBackend creates the backend LFS objects of a repository are stored in
+type NewBackend func(repository git.Repository) (Backend, error)
+
+// NewFilesystemBackend stores the LFS objects of a repository under
+// lfs/objects in its git directory, the same layout git-lfs uses locally
+func NewFilesystemBackend(repository git.Repository) (Backend, error) {
+	gitDirectory := repository.GitDirectory()
+	if gitDirectory == nil {
+		return nil, errors.New("repository is not stored on a filesystem")
+	}
+
+	objects, err := gitDirectory.Chroot(path.Join("lfs", "objects"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FilesystemBackend{fileSystem: objects}, nil
+}
+
+// FilesystemBackend stores LFS objects in a content addressed directory
+type FilesystemBackend struct {
+	fileSystem billy.Filesystem
+}
+
+func objectPath(oid string) string {
+	return path.Join(oid[0:2], oid[2:4], oid)
+}
+
+// Size returns the size of a stored object
+func (backend *FilesystemBackend) Size(oid string) (int64, error) {
+	info, err := backend.fileSystem.Stat(objectPath(oid))
+	if os.IsNotExist(err) {
+		return 0, ErrObjectNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// Open opens a stored object for reading
+func (backend *FilesystemBackend) Open(oid string) (io.ReadCloser, error) {
+	file, err := backend.fileSystem.Open(objectPath(oid))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+
+	return file, err
+}
+
+// Put writes the content to a temporary file and moves it into place once
+// its hash is verified, so that partial uploads are never visible
+func (backend *FilesystemBackend) Put(oid string, content io.Reader) error {
+	if err := backend.fileSystem.MkdirAll("tmp", 0755); err != nil {
+		return err
+	}
+
+	temporary, err := backend.fileSystem.TempFile("tmp", oid)
+	if err != nil {
+		return err
+	}
+	defer backend.fileSystem.Remove(temporary.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(temporary, hash), content)
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != oid {
+		return ErrInvalidObject
+	}
+
+	destination := objectPath(oid)
+	if err := backend.fileSystem.MkdirAll(path.Dir(destination), 0755); err != nil {
+		return err
+	}
+
+	if err := backend.fileSystem.Rename(temporary.Name(), destination); err != nil {
+		return fmt.Errorf("storing object %s: %s", oid, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package lfs_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/lfs"
+	"github.com/drdgvhbh/gitserver/internal/mock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func newRepository() *mock.Repository {
+	repository := new(mock.Repository)
+	repository.On("GitDirectory").Return(memfs.New())
+
+	return repository
+}
+
+func TestFilesystemBackendStoresObjectsByOID(t *testing.T) {
+	assert := assert.New(t)
+
+	backend, err := lfs.NewFilesystemBackend(newRepository())
+	assert.NoError(err)
+
+	content := []byte("a very large game asset")
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+
+	_, err = backend.Size(oid)
+	assert.Equal(lfs.ErrObjectNotFound, err)
+
+	assert.NoError(backend.Put(oid, bytes.NewReader(content)))
+
+	size, err := backend.Size(oid)
+	assert.NoError(err)
+	assert.Equal(int64(len(content)), size)
+
+	file, err := backend.Open(oid)
+	assert.NoError(err)
+	defer file.Close()
+
+	stored, err := ioutil.ReadAll(file)
+	assert.NoError(err)
+	assert.Equal(content, stored)
+}
+
+func TestFilesystemBackendRejectsMismatchedContent(t *testing.T) {
+	assert := assert.New(t)
+
+	backend, err := lfs.NewFilesystemBackend(newRepository())
+	assert.NoError(err)
+
+	sum := sha256.Sum256([]byte("expected"))
+	oid := hex.EncodeToString(sum[:])
+
+	err = backend.Put(oid, bytes.NewReader([]byte("actual")))
+	assert.Equal(lfs.ErrInvalidObject, err)
+
+	_, err = backend.Size(oid)
+	assert.Equal(lfs.ErrObjectNotFound, err)
+}
+
+func TestLockStoreOnlyLetsOwnersUnlock(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := lfs.NewLockStore(newRepository())
+	assert.NoError(err)
+
+	lock, err := store.Create("assets/level.bin", "alice")
+	assert.NoError(err)
+
+	existing, err := store.Create("assets/level.bin", "bob")
+	assert.Equal(lfs.ErrLockExists, err)
+	assert.Equal(lock.ID, existing.ID)
+
+	_, err = store.Delete(lock.ID, "bob", false)
+	assert.Equal(lfs.ErrLockNotOwned, err)
+
+	_, err = store.Delete(lock.ID, "bob", true)
+	assert.NoError(err)
+
+	locks, err := store.List()
+	assert.NoError(err)
+	assert.Empty(locks)
+}
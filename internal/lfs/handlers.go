@@ -0,0 +1,484 @@
+package lfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/request"
+	"github.com/gorilla/mux"
+)
+
+const mediaType = "application/vnd.git-lfs+json"
+
+// errNoOwner is returned to clients that cannot own locks, because the API key
+// they authenticated with has no name
+var errNoOwner = errors.New("locks can only be used with an API key that has a name")
+
+type batchObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type batchRequest struct {
+	Operation string        `json:"operation"`
+	Transfers []string      `json:"transfers,omitempty"`
+	Objects   []batchObject `json:"objects"`
+}
+
+type action struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+type objectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type batchObjectResponse struct {
+	OID           string            `json:"oid"`
+	Size          int64             `json:"size"`
+	Authenticated bool              `json:"authenticated,omitempty"`
+	Actions       map[string]action `json:"actions,omitempty"`
+	Error         *objectError      `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Transfer string                `json:"transfer"`
+	Objects  []batchObjectResponse `json:"objects"`
+	HashAlgo string                `json:"hash_algo"`
+}
+
+type lockRequest struct {
+	Path   string `json:"path"`
+	Force  bool   `json:"force"`
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+func writeJSON(writer http.ResponseWriter, statusCode int, body interface{}) {
+	writer.Header().Set("Content-Type", mediaType)
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(body); err != nil {
+		log.Printf("lfs: writing response: %s\n", err)
+	}
+}
+
+func writeError(writer http.ResponseWriter, statusCode int, err error) {
+	writeJSON(writer, statusCode, map[string]string{"message": err.Error()})
+}
+
+// baseURL returns the URL of the LFS server the request was sent to
+func baseURL(request *http.Request, suffix string) string {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := request.Header.Get("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+
+	return fmt.Sprintf("%s://%s%s",
+		scheme, request.Host, strings.TrimSuffix(request.URL.Path, suffix))
+}
+
+// owner identifies who is locking files by the name of the API key they
+// authenticated with. Credentials are never used, since they may be the key
+// itself.
+func owner(r *http.Request) (string, bool) {
+	return request.Identity(r)
+}
+
+// NewBatchHandler tells clients where to upload or download the objects they
+// ask for
+func NewBatchHandler(reader git.Reader, newBackend NewBackend) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		backend, err := newBackend(repository)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		var batch batchRequest
+		if err := json.NewDecoder(request.Body).Decode(&batch); err != nil {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		if batch.Operation != "download" && batch.Operation != "upload" {
+			writeError(writer, http.StatusUnprocessableEntity,
+				fmt.Errorf("unsupported operation %q", batch.Operation))
+			return
+		}
+
+		base := baseURL(request, "/objects/batch")
+		header := map[string]string{}
+		if authorization := request.Header.Get("Authorization"); authorization != "" {
+			header["Authorization"] = authorization
+		}
+
+		objects := make([]batchObjectResponse, len(batch.Objects))
+		for i, object := range batch.Objects {
+			objects[i] = batchObjectResponse{
+				OID:           object.OID,
+				Size:          object.Size,
+				Authenticated: true,
+			}
+
+			if !ValidOID(object.OID) || object.Size < 0 {
+				objects[i].Error = &objectError{
+					Code:    http.StatusUnprocessableEntity,
+					Message: "invalid object",
+				}
+				continue
+			}
+
+			href := fmt.Sprintf("%s/objects/%s", base, object.OID)
+			size, err := backend.Size(object.OID)
+			switch {
+			case err != nil && err != ErrObjectNotFound:
+				objects[i].Error = &objectError{
+					Code:    http.StatusInternalServerError,
+					Message: err.Error(),
+				}
+			case batch.Operation == "download" && err == ErrObjectNotFound:
+				objects[i].Error = &objectError{
+					Code:    http.StatusNotFound,
+					Message: ErrObjectNotFound.Error(),
+				}
+			case batch.Operation == "download":
+				objects[i].Actions = map[string]action{
+					"download": {Href: href, Header: header},
+				}
+			case err == ErrObjectNotFound || size != object.Size:
+				objects[i].Actions = map[string]action{
+					"upload": {Href: href, Header: header},
+					"verify": {Href: href + "/verify", Header: header},
+				}
+			}
+		}
+
+		writeJSON(writer, http.StatusOK, batchResponse{
+			Transfer: "basic",
+			Objects:  objects,
+			HashAlgo: "sha256",
+		})
+	}
+}
+
+// NewDownloadHandler streams an object to the client
+func NewDownloadHandler(reader git.Reader, newBackend NewBackend) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		backend, err := newBackend(repository)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		oid := vars["oid"]
+		size, err := backend.Size(oid)
+		if err == ErrObjectNotFound {
+			writeError(writer, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		content, err := backend.Open(oid)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		defer content.Close()
+
+		writer.Header().Set("Content-Type", "application/octet-stream")
+		writer.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		if _, err := io.Copy(writer, content); err != nil {
+			log.Printf("lfs: downloading %s: %s\n", oid, err)
+		}
+	}
+}
+
+// NewUploadHandler stores an object sent by the client
+func NewUploadHandler(reader git.Reader, newBackend NewBackend) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		backend, err := newBackend(repository)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		err = backend.Put(vars["oid"], request.Body)
+		if err == ErrInvalidObject {
+			writeError(writer, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writer.WriteHeader(http.StatusOK)
+	}
+}
+
+// NewVerifyHandler confirms that an uploaded object was stored in full
+func NewVerifyHandler(reader git.Reader, newBackend NewBackend) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		backend, err := newBackend(repository)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		var object batchObject
+		if err := json.NewDecoder(request.Body).Decode(&object); err != nil {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		size, err := backend.Size(vars["oid"])
+		if err == ErrObjectNotFound {
+			writeError(writer, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		if size != object.Size {
+			writeError(writer, http.StatusUnprocessableEntity,
+				fmt.Errorf("expected %d bytes, stored %d", object.Size, size))
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, map[string]string{})
+	}
+}
+
+func openLockStore(
+	writer http.ResponseWriter,
+	request *http.Request,
+	reader git.Reader,
+) (*LockStore, bool) {
+	vars := mux.Vars(request)
+	repository, _ := reader.Open(vars["directory"])
+
+	store, err := NewLockStore(repository)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return store, true
+}
+
+// paginate returns the locks starting at the lock identified by cursor, and
+// the cursor of the next page. A cursor no lock is identified by is an error,
+// rather than starting over from the first page.
+func paginate(locks []Lock, cursor string, limit int) ([]Lock, string, error) {
+	start := 0
+	if cursor != "" {
+		start = -1
+		for i, lock := range locks {
+			if lock.ID == cursor {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return nil, "", fmt.Errorf("unknown cursor %q", cursor)
+		}
+	}
+
+	locks = locks[start:]
+	if limit <= 0 || limit >= len(locks) {
+		return locks, "", nil
+	}
+
+	return locks[:limit], locks[limit].ID, nil
+}
+
+// NewCreateLockHandler locks a path
+func NewCreateLockHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		name, ok := owner(request)
+		if !ok {
+			writeError(writer, http.StatusForbidden, errNoOwner)
+			return
+		}
+
+		store, ok := openLockStore(writer, request, reader)
+		if !ok {
+			return
+		}
+
+		var body lockRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.Path == "" {
+			writeError(writer, http.StatusBadRequest, fmt.Errorf("a path is required"))
+			return
+		}
+
+		lock, err := store.Create(body.Path, name)
+		if err == ErrLockExists {
+			writeJSON(writer, http.StatusConflict, map[string]interface{}{
+				"lock":    lock,
+				"message": err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeJSON(writer, http.StatusCreated, map[string]interface{}{"lock": lock})
+	}
+}
+
+// NewListLocksHandler lists locks, optionally filtered by path or identifier
+func NewListLocksHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		store, ok := openLockStore(writer, request, reader)
+		if !ok {
+			return
+		}
+
+		locks, err := store.List()
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		query := request.URL.Query()
+		filtered := make([]Lock, 0, len(locks))
+		for _, lock := range locks {
+			if path := query.Get("path"); path != "" && lock.Path != path {
+				continue
+			}
+			if id := query.Get("id"); id != "" && lock.ID != id {
+				continue
+			}
+
+			filtered = append(filtered, lock)
+		}
+
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		page, next, err := paginate(filtered, query.Get("cursor"), limit)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		writeJSON(writer, http.StatusOK, map[string]interface{}{
+			"locks":       page,
+			"next_cursor": next,
+		})
+	}
+}
+
+// NewVerifyLocksHandler splits the locks into the ones owned by the client
+// and the ones owned by others, which git-lfs checks before pushing
+func NewVerifyLocksHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		name, ok := owner(request)
+		if !ok {
+			writeError(writer, http.StatusForbidden, errNoOwner)
+			return
+		}
+
+		store, ok := openLockStore(writer, request, reader)
+		if !ok {
+			return
+		}
+
+		var body lockRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil && err != io.EOF {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		locks, err := store.List()
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		page, next, err := paginate(locks, body.Cursor, body.Limit)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		ours, theirs := make([]Lock, 0), make([]Lock, 0)
+		for _, lock := range page {
+			if lock.Owner.Name == name {
+				ours = append(ours, lock)
+			} else {
+				theirs = append(theirs, lock)
+			}
+		}
+
+		writeJSON(writer, http.StatusOK, map[string]interface{}{
+			"ours":        ours,
+			"theirs":      theirs,
+			"next_cursor": next,
+		})
+	}
+}
+
+// NewUnlockHandler removes a lock
+func NewUnlockHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		name, ok := owner(request)
+		if !ok {
+			writeError(writer, http.StatusForbidden, errNoOwner)
+			return
+		}
+
+		store, ok := openLockStore(writer, request, reader)
+		if !ok {
+			return
+		}
+
+		var body lockRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil && err != io.EOF {
+			writeError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		lock, err := store.Delete(mux.Vars(request)["id"], name, body.Force)
+		switch err {
+		case nil:
+			writeJSON(writer, http.StatusOK, map[string]interface{}{"lock": lock})
+		case ErrLockNotFound:
+			writeError(writer, http.StatusNotFound, err)
+		case ErrLockNotOwned:
+			writeError(writer, http.StatusForbidden, err)
+		default:
+			writeError(writer, http.StatusInternalServerError, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package lfs_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/lfs"
+	"github.com/drdgvhbh/gitserver/internal/mock"
+	"github.com/drdgvhbh/gitserver/internal/request"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const repositoryPath = "/srv/project.git"
+
+func newReader() *mock.Reader {
+	reader := new(mock.Reader)
+	reader.On("Open", repositoryPath).Return(newRepository(), nil)
+
+	return reader
+}
+
+// newLockRequest creates a request on the repository sent by name, or by no
+// one in particular when name is empty
+func newLockRequest(method string, target string, body string, name string) *http.Request {
+	req, _ := http.NewRequest(method, target, strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"directory": repositoryPath})
+	if name != "" {
+		req = req.WithContext(request.WithIdentity(req.Context(), name))
+	}
+
+	return req
+}
+
+func createLock(t *testing.T, handler http.HandlerFunc, path string, name string) lfs.Lock {
+	res := httptest.NewRecorder()
+	handler(res, newLockRequest("POST", "/locks", `{"path":"`+path+`"}`, name))
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var body struct {
+		Lock lfs.Lock `json:"lock"`
+	}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+
+	return body.Lock
+}
+
+func TestCreateLockOwnsLocksByTheNameOfTheKey(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := newReader()
+	create := lfs.NewCreateLockHandler(reader)
+
+	req := newLockRequest("POST", "/locks", `{"path":"assets/model.fbx"}`, "alice")
+	req.SetBasicAuth("git", "e8b8dc29-d1d9-495d-b509-4dde3701018b")
+	res := httptest.NewRecorder()
+	create(res, req)
+	assert.Equal(http.StatusCreated, res.Code)
+	assert.Contains(res.Body.String(), `"name":"alice"`)
+	assert.NotContains(res.Body.String(), "e8b8dc29")
+}
+
+func TestLockHandlersRefuseClientsWithoutAName(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := newReader()
+	create := lfs.NewCreateLockHandler(reader)
+	lock := createLock(t, create, "assets/model.fbx", "alice")
+
+	for _, test := range []struct {
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+	}{
+		{create, "POST", "/locks", `{"path":"assets/logo.png"}`},
+		{lfs.NewVerifyLocksHandler(reader), "POST", "/locks/verify", `{}`},
+		{lfs.NewUnlockHandler(reader), "POST", "/locks/" + lock.ID + "/unlock", `{"force":true}`},
+	} {
+		res := httptest.NewRecorder()
+		test.handler(res, newLockRequest(test.method, test.target, test.body, ""))
+		assert.Equal(http.StatusForbidden, res.Code, test.target)
+	}
+
+	res := httptest.NewRecorder()
+	lfs.NewListLocksHandler(reader)(res, newLockRequest("GET", "/locks", "", ""))
+	assert.Equal(http.StatusOK, res.Code)
+	assert.Contains(res.Body.String(), lock.ID)
+}
+
+func TestVerifyLocksSplitsOursFromTheirs(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := newReader()
+	create := lfs.NewCreateLockHandler(reader)
+	ours := createLock(t, create, "assets/model.fbx", "alice")
+	theirs := createLock(t, create, "assets/logo.png", "bob")
+
+	res := httptest.NewRecorder()
+	lfs.NewVerifyLocksHandler(reader)(res,
+		newLockRequest("POST", "/locks/verify", `{}`, "alice"))
+	assert.Equal(http.StatusOK, res.Code)
+
+	var body struct {
+		Ours   []lfs.Lock `json:"ours"`
+		Theirs []lfs.Lock `json:"theirs"`
+	}
+	assert.NoError(json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal([]lfs.Lock{ours}, body.Ours)
+	assert.Equal([]lfs.Lock{theirs}, body.Theirs)
+}
+
+func TestUnlockOnlyRemovesLocksOfOthersWhenForced(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := newReader()
+	lock := createLock(t, lfs.NewCreateLockHandler(reader), "assets/model.fbx", "alice")
+	unlock := lfs.NewUnlockHandler(reader)
+	target := "/locks/" + lock.ID + "/unlock"
+
+	req := newLockRequest("POST", target, `{}`, "bob")
+	req = mux.SetURLVars(req, map[string]string{"directory": repositoryPath, "id": lock.ID})
+	res := httptest.NewRecorder()
+	unlock(res, req)
+	assert.Equal(http.StatusForbidden, res.Code)
+
+	req = newLockRequest("POST", target, `{"force":true}`, "bob")
+	req = mux.SetURLVars(req, map[string]string{"directory": repositoryPath, "id": lock.ID})
+	res = httptest.NewRecorder()
+	unlock(res, req)
+	assert.Equal(http.StatusOK, res.Code)
+}
+
+func TestListLocksPages(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := newReader()
+	create := lfs.NewCreateLockHandler(reader)
+	first := createLock(t, create, "a.bin", "alice")
+	second := createLock(t, create, "b.bin", "alice")
+	third := createLock(t, create, "c.bin", "alice")
+
+	type page struct {
+		Locks      []lfs.Lock `json:"locks"`
+		NextCursor string     `json:"next_cursor"`
+	}
+	list := func(query string) (int, page) {
+		res := httptest.NewRecorder()
+		lfs.NewListLocksHandler(reader)(res, newLockRequest("GET", "/locks?"+query, "", ""))
+
+		var body page
+		if res.Code == http.StatusOK {
+			assert.NoError(json.NewDecoder(res.Body).Decode(&body))
+		}
+
+		return res.Code, body
+	}
+
+	code, body := list("limit=2")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal([]lfs.Lock{first, second}, body.Locks)
+	assert.Equal(third.ID, body.NextCursor)
+
+	code, body = list("limit=2&cursor=" + body.NextCursor)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal([]lfs.Lock{third}, body.Locks)
+	assert.Empty(body.NextCursor)
+
+	code, _ = list("cursor=unknown")
+	assert.Equal(http.StatusBadRequest, code)
+}
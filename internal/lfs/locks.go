@@ -0,0 +1,174 @@
+package lfs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/google/uuid"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+const locksFile = "lfs/locks.json"
+
+var (
+	// ErrLockNotFound is returned when no lock has the requested identifier
+	ErrLockNotFound = errors.New("lock does not exist")
+	// ErrLockExists is returned when a path is already locked
+	ErrLockExists = errors.New("path is already locked")
+	// ErrLockNotOwned is returned when unlocking someone else's lock without force
+	ErrLockNotOwned = errors.New("lock is owned by someone else")
+)
+
+// locksMutex serializes every read-modify-write of a locks file
+var locksMutex sync.Mutex
+
+type Owner struct {
+	Name string `json:"name"`
+}
+
+type Lock struct {
+	ID       string `json:"id"`
+	Path     string `json:"path"`
+	LockedAt string `json:"locked_at"`
+	Owner    Owner  `json:"owner"`
+}
+
+// LockStore keeps the file locks of a repository in its git directory
+type LockStore struct {
+	fileSystem billy.Filesystem
+}
+
+// NewLockStore creates the lock store of a repository
+func NewLockStore(repository git.Repository) (*LockStore, error) {
+	gitDirectory := repository.GitDirectory()
+	if gitDirectory == nil {
+		return nil, errors.New("repository is not stored on a filesystem")
+	}
+
+	return &LockStore{fileSystem: gitDirectory}, nil
+}
+
+func (store *LockStore) load() ([]Lock, error) {
+	file, err := store.fileSystem.Open(locksFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var locks []Lock
+	if err := json.Unmarshal(data, &locks); err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+func (store *LockStore) save(locks []Lock) error {
+	data, err := json.MarshalIndent(locks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := store.fileSystem.MkdirAll(path.Dir(locksFile), 0755); err != nil {
+		return err
+	}
+
+	file, err := store.fileSystem.Create(locksFile)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// List returns the locks sorted by path
+func (store *LockStore) List() ([]Lock, error) {
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	locks, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Path < locks[j].Path
+	})
+
+	return locks, nil
+}
+
+// Create locks a path for owner. If the path is already locked, the existing
+// lock is returned along with ErrLockExists.
+func (store *LockStore) Create(lockPath string, owner string) (Lock, error) {
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	locks, err := store.load()
+	if err != nil {
+		return Lock{}, err
+	}
+
+	for _, lock := range locks {
+		if lock.Path == lockPath {
+			return lock, ErrLockExists
+		}
+	}
+
+	lock := Lock{
+		ID:       uuid.New().String(),
+		Path:     lockPath,
+		LockedAt: time.Now().Format(time.RFC3339),
+		Owner:    Owner{Name: owner},
+	}
+
+	return lock, store.save(append(locks, lock))
+}
+
+// Delete removes a lock. Locks owned by someone else are only removed when
+// forced.
+func (store *LockStore) Delete(id string, owner string, force bool) (Lock, error) {
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	locks, err := store.load()
+	if err != nil {
+		return Lock{}, err
+	}
+
+	for i, lock := range locks {
+		if lock.ID != id {
+			continue
+		}
+
+		if lock.Owner.Name != owner && !force {
+			return lock, ErrLockNotOwned
+		}
+
+		remaining := append(append([]Lock{}, locks[:i]...), locks[i+1:]...)
+
+		return lock, store.save(remaining)
+	}
+
+	return Lock{}, ErrLockNotFound
+}
@@ -0,0 +1,57 @@
+package lfs_test
+
+import (
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/lfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockStoreLocksEachPathOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := lfs.NewLockStore(newRepository())
+	assert.NoError(err)
+
+	lock, err := store.Create("assets/model.fbx", "alice")
+	assert.NoError(err)
+	assert.Equal("alice", lock.Owner.Name)
+
+	existing, err := store.Create("assets/model.fbx", "bob")
+	assert.Equal(lfs.ErrLockExists, err)
+	assert.Equal(lock, existing)
+
+	_, err = store.Create("assets/logo.png", "bob")
+	assert.NoError(err)
+
+	locks, err := store.List()
+	assert.NoError(err)
+	if assert.Len(locks, 2) {
+		assert.Equal("assets/logo.png", locks[0].Path)
+		assert.Equal("assets/model.fbx", locks[1].Path)
+	}
+}
+
+func TestLockStoreOnlyDeletesLocksOfOthersWhenForced(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := lfs.NewLockStore(newRepository())
+	assert.NoError(err)
+
+	lock, err := store.Create("assets/model.fbx", "alice")
+	assert.NoError(err)
+
+	_, err = store.Delete(lock.ID, "bob", false)
+	assert.Equal(lfs.ErrLockNotOwned, err)
+
+	deleted, err := store.Delete(lock.ID, "bob", true)
+	assert.NoError(err)
+	assert.Equal(lock, deleted)
+
+	_, err = store.Delete(lock.ID, "alice", false)
+	assert.Equal(lfs.ErrLockNotFound, err)
+
+	locks, err := store.List()
+	assert.NoError(err)
+	assert.Empty(locks)
+}
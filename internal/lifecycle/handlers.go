@@ -0,0 +1,309 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/discovery"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/jobs"
+	"github.com/drdgvhbh/gitserver/internal/registry"
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+var (
+	// errNoRoot is returned when there is no root to create repositories in
+	errNoRoot = errors.New("repositories can only be created under a repository root")
+	// errNoTrash is returned when there is no trash to delete repositories to
+	errNoTrash = errors.New("repositories can only be deleted to a trash")
+	// errDeleteRoot is returned when deleting a repository root
+	errDeleteRoot = errors.New("repository roots cannot be deleted")
+)
+
+// The created repository
+// swagger:response CreateRepositoryCreatedResponse
+type CreateRepositoryCreatedResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []discovery.Repository `json:"data,omitempty"`
+	}
+}
+
+// swagger:parameters createRepository
+type CreateRepositoryParams struct {
+	// in: body
+	// required: true
+	Body CreateRepositoryRequest
+}
+
+type CreateRepositoryRequest struct {
+	// The path of the repository, relative to the repository root
+	//
+	// required: true
+	// example: team/project.git
+	Name string `json:"name"`
+
+	// Whether the repository has no worktree
+	//
+	// example: true
+	Bare bool `json:"bare"`
+
+	// The branch HEAD points to. It defaults to master.
+	//
+	// example: main
+	DefaultBranch string `json:"defaultBranch"`
+
+	// What the repository is for
+	//
+	// example: The project scaffolding tool
+	Description string `json:"description"`
+
+	// Whether the initial commit has a README.md
+	//
+	// example: true
+	Readme bool `json:"readme"`
+
+	// The .gitignore template of the initial commit: go, java, node or python
+	//
+	// example: go
+	Gitignore string `json:"gitignore"`
+}
+
+// checkNewName makes sure a repository can be created by the name. It
+// reports whether it can, and writes the error response otherwise.
+func checkNewName(
+	writer http.ResponseWriter,
+	fileSystem billy.Filesystem,
+	roots []string,
+	name string,
+) bool {
+	if !registry.ValidName(name) {
+		response.WriteError(writer, http.StatusBadRequest, registry.ErrInvalidName)
+		return false
+	}
+	if len(roots) == 0 {
+		response.WriteError(writer, http.StatusNotImplemented, errNoRoot)
+		return false
+	}
+
+	for _, root := range roots {
+		if _, err := fileSystem.Stat(filepath.Join(root, name)); err == nil {
+			response.WriteError(writer, http.StatusConflict, ErrRepositoryExists)
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewCreateRepositoryHandler initializes a repository in the first of the
+// roots. The name must not be taken in any of the roots, since relative paths
+// are looked up in each of them.
+func NewCreateRepositoryHandler(
+	fileSystem billy.Filesystem,
+	roots []string,
+) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body CreateRepositoryRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		if !checkNewName(writer, fileSystem, roots, body.Name) {
+			return
+		}
+
+		repositoryPath := filepath.Join(roots[0], body.Name)
+		err := Init(fileSystem, repositoryPath, &InitOptions{
+			Bare:          body.Bare,
+			DefaultBranch: body.DefaultBranch,
+			Description:   body.Description,
+			Readme:        body.Readme,
+			Gitignore:     body.Gitignore,
+		})
+		switch err {
+		case nil:
+		case ErrRepositoryExists:
+			response.WriteError(writer, http.StatusConflict, err)
+			return
+		case ErrInvalidBranchName, ErrUnknownTemplate:
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		default:
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		repository, err := discovery.Describe(fileSystem, repositoryPath)
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		repository.Name = body.Name
+
+		dataPayload := response.Payload{
+			Data: []interface{}{repository},
+		}
+		writer.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// The repository was moved to the trash
+// swagger:response DeleteRepositoryNoContentResponse
+type DeleteRepositoryNoContentResponse struct{}
+
+// The repository was archived or made writable again
+// swagger:response ArchiveRepositoryNoContentResponse
+type ArchiveRepositoryNoContentResponse struct{}
+
+// NewDeleteRepositoryHandler moves a repository to the trash, and
+// unregisters the names it was registered by. The roots themselves cannot be
+// deleted.
+func NewDeleteRepositoryHandler(
+	locator git.Locator,
+	names *registry.Store,
+	trash *Trash,
+	roots []string,
+) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if trash == nil {
+			response.WriteError(writer, http.StatusNotImplemented, errNoTrash)
+			return
+		}
+
+		name := mux.Vars(request)["directory"]
+		repositoryPath, err := locator.Locate(name)
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		for _, root := range roots {
+			if filepath.Clean(repositoryPath) == filepath.Clean(root) {
+				response.WriteError(writer, http.StatusForbidden, errDeleteRoot)
+				return
+			}
+		}
+
+		// The names can only be located before the repository is moved
+		var registered []string
+		for _, entry := range names.List() {
+			if location, err := locator.Locate(entry.Name); err == nil && location == repositoryPath {
+				registered = append(registered, entry.Name)
+			}
+		}
+
+		trashedPath, err := trash.Move(repositoryPath, name, time.Now())
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		log.Printf("%s: moved to %s\n", repositoryPath, trashedPath)
+
+		for _, registeredName := range registered {
+			if err := names.Remove(registeredName); err != nil {
+				log.Printf("%s: %s\n", registeredName, err)
+			}
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewArchiveRepositoryHandler archives a repository, or makes it writable
+// again when archived is false
+func NewArchiveRepositoryHandler(
+	reader git.Reader,
+	archived bool,
+) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		repository, _ := reader.Open(mux.Vars(request)["directory"])
+
+		if err := git.SetArchived(repository, archived); err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// swagger:parameters importRepository
+type ImportRepositoryParams struct {
+	// in: body
+	// required: true
+	Body ImportRepositoryRequest
+}
+
+type ImportRepositoryRequest struct {
+	// The file:// URL or absolute path of the repository to import
+	//
+	// required: true
+	// example: file:///mnt/build-01/src/project
+	URL string `json:"url"`
+
+	// The path of the imported repository, relative to the repository root
+	//
+	// required: true
+	// example: team/project.git
+	Name string `json:"name"`
+
+	// Whether the imported repository has no worktree
+	//
+	// example: true
+	Bare bool `json:"bare"`
+}
+
+// NewImportRepositoryHandler starts a job that imports a repository into the
+// first of the roots. The job's result is the imported repository.
+func NewImportRepositoryHandler(
+	fileSystem billy.Filesystem,
+	roots []string,
+	runner *jobs.Runner,
+) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body ImportRepositoryRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := CheckImportURL(body.URL); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+		if !checkNewName(writer, fileSystem, roots, body.Name) {
+			return
+		}
+
+		repositoryPath := filepath.Join(roots[0], body.Name)
+		job := runner.Start("import", func(progress io.Writer) (interface{}, error) {
+			err := Import(fileSystem, repositoryPath, body.URL, body.Bare, progress)
+			if err != nil {
+				return nil, err
+			}
+
+			repository, err := discovery.Describe(fileSystem, repositoryPath)
+			repository.Name = body.Name
+
+			return repository, err
+		})
+
+		jobs.WriteAccepted(writer, job)
+	}
+}
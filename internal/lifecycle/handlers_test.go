@@ -0,0 +1,47 @@
+package lifecycle_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/lifecycle"
+	"github.com/drdgvhbh/gitserver/internal/registry"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestDeleteRepositoryUnregistersItsNames(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	assert.NoError(lifecycle.Init(fileSystem, "/srv/team/project", &lifecycle.InitOptions{Readme: true}))
+	assert.NoError(lifecycle.Init(fileSystem, "/srv/team/other", &lifecycle.InitOptions{Readme: true}))
+
+	names, err := registry.NewStore("")
+	assert.NoError(err)
+	_, err = names.Add("project", "/srv/team/project")
+	assert.NoError(err)
+	_, err = names.Add("other", "/srv/team/other")
+	assert.NoError(err)
+
+	reader := registry.NewReader(names, git.NewReader(fileSystem))
+	trash := lifecycle.NewTrash(fileSystem, "/srv/.trash", time.Hour)
+	handler := lifecycle.NewDeleteRepositoryHandler(reader, names, trash, []string{"/srv"})
+
+	req, _ := http.NewRequest("DELETE", "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"directory": "project"})
+	res := httptest.NewRecorder()
+	handler(res, req)
+
+	assert.Equal(http.StatusNoContent, res.Code)
+	_, ok := names.Find("project")
+	assert.False(ok)
+	_, ok = names.Find("other")
+	assert.True(ok)
+	_, err = fileSystem.Stat("/srv/team/project")
+	assert.Error(err)
+}
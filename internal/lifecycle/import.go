@@ -0,0 +1,139 @@
+package lifecycle
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// ErrUnsupportedURL is returned for sources that are neither file URLs nor
+// absolute paths
+var ErrUnsupportedURL = errors.New("only file:// URLs and absolute paths can be imported")
+
+// importRemote is the name of the remote the source is fetched through. It
+// is removed once the import is done, since the source is usually a path on
+// another machine.
+const importRemote = "import"
+
+// CheckImportURL makes sure rawURL names a repository on the local
+// filesystem
+func CheckImportURL(rawURL string) error {
+	if filepath.IsAbs(rawURL) {
+		return nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "file" || parsed.Path == "" {
+		return ErrUnsupportedURL
+	}
+
+	return nil
+}
+
+// Import copies every reference of the repository at sourceURL into a new
+// repository at repositoryPath, and reports the progress of the copy to
+// progress. HEAD points to the same branch as it does in the source.
+func Import(
+	fileSystem billy.Filesystem,
+	repositoryPath string,
+	sourceURL string,
+	bare bool,
+	progress io.Writer,
+) error {
+	if err := CheckImportURL(sourceURL); err != nil {
+		return err
+	}
+
+	release, err := reserve(fileSystem, repositoryPath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = importRepository(fileSystem, repositoryPath, sourceURL, bare, progress)
+	if err != nil {
+		_ = util.RemoveAll(fileSystem, repositoryPath)
+	}
+
+	return err
+}
+
+func importRepository(
+	fileSystem billy.Filesystem,
+	repositoryPath string,
+	sourceURL string,
+	bare bool,
+	progress io.Writer,
+) error {
+	repository, _, err := initStorage(fileSystem, repositoryPath, bare)
+	if err != nil {
+		return err
+	}
+
+	unlock := git.LockReferences(repository.Storer)
+	defer unlock()
+
+	remote, err := repository.CreateRemote(&config.RemoteConfig{
+		Name:  importRemote,
+		URLs:  []string{sourceURL},
+		Fetch: []config.RefSpec{git.MirrorRefSpec},
+	})
+	if err != nil {
+		return err
+	}
+
+	references, err := remote.List(&gogit.ListOptions{})
+	if err == transport.ErrEmptyRemoteRepository {
+		return repository.DeleteRemote(importRemote)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = remote.Fetch(&gogit.FetchOptions{
+		RemoteName: importRemote,
+		Progress:   progress,
+		Tags:       gogit.NoTags,
+	})
+	if err != nil && err != gogit.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	if err := repository.DeleteRemote(importRemote); err != nil {
+		return err
+	}
+
+	head := git.RemoteHead(references)
+	if head == "" {
+		return nil
+	}
+	err = repository.Storer.SetReference(
+		plumbing.NewSymbolicReference(plumbing.HEAD, head))
+	if err != nil {
+		return err
+	}
+
+	if bare {
+		return nil
+	}
+
+	commit, err := repository.ResolveRevision(plumbing.Revision(plumbing.HEAD))
+	if err != nil {
+		return err
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return worktree.Reset(&gogit.ResetOptions{Commit: *commit, Mode: gogit.HardReset})
+}
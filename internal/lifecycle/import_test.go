@@ -0,0 +1,77 @@
+package lifecycle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+func TestImportCopiesEveryReference(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "gitserver-import")
+	assert.NoError(err)
+	defer os.RemoveAll(directory)
+	fileSystem := osfs.New("/")
+
+	source := filepath.Join(directory, "source")
+	assert.NoError(lifecycle.Init(fileSystem, source, &lifecycle.InitOptions{
+		DefaultBranch: "main",
+		Readme:        true,
+	}))
+
+	for _, bare := range []bool{true, false} {
+		destination := filepath.Join(directory, "bare")
+		if !bare {
+			destination = filepath.Join(directory, "worktree")
+		}
+
+		err = lifecycle.Import(fileSystem, destination, "file://"+source, bare, ioutil.Discard)
+		assert.NoError(err)
+
+		repository, err := git.NewReader(fileSystem).Open(destination)
+		assert.NoError(err)
+		assert.Equal(bare, repository.IsBare())
+
+		head, err := repository.Head()
+		assert.NoError(err)
+		assert.EqualValues("refs/heads/main", head.Name())
+
+		_, err = repository.Reference("refs/remotes/import/main")
+		assert.Error(err)
+	}
+
+	_, err = os.Stat(filepath.Join(directory, "worktree", "README.md"))
+	assert.NoError(err)
+}
+
+func TestImportRejectsRemoteURLs(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, url := range []string{"https://example.com/project.git", "relative/path", "file://"} {
+		assert.Equal(lifecycle.ErrUnsupportedURL, lifecycle.CheckImportURL(url), url)
+	}
+	assert.NoError(lifecycle.CheckImportURL("/srv/project.git"))
+}
+
+func TestImportCleansUpAfterFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "gitserver-import")
+	assert.NoError(err)
+	defer os.RemoveAll(directory)
+
+	destination := filepath.Join(directory, "project")
+	err = lifecycle.Import(osfs.New("/"), destination,
+		filepath.Join(directory, "missing"), true, ioutil.Discard)
+	assert.Error(err)
+
+	_, err = os.Stat(destination)
+	assert.True(os.IsNotExist(err))
+}
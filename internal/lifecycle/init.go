@@ -0,0 +1,293 @@
+// Package lifecycle creates repositories and manages them until they are
+// removed
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+var (
+	// ErrRepositoryExists is returned when creating a repository where
+	// something already exists
+	ErrRepositoryExists = errors.New("repository already exists")
+	// ErrInvalidBranchName is returned for default branches git would refuse
+	ErrInvalidBranchName = errors.New("invalid branch name")
+	// ErrUnknownTemplate is returned for .gitignore templates that do not exist
+	ErrUnknownTemplate = errors.New("unknown .gitignore template")
+)
+
+var (
+	// reservedMutex guards reserved
+	reservedMutex sync.Mutex
+	// reserved holds the paths of the repositories being created, so that
+	// two requests cannot create the same repository at once
+	reserved = make(map[string]bool)
+)
+
+// signature is who the initial commit is authored by
+var signature = object.Signature{
+	Name:  "gitserver",
+	Email: "gitserver@localhost",
+}
+
+// InitOptions describe a new repository
+type InitOptions struct {
+	// Bare repositories have no worktree
+	Bare bool
+	// DefaultBranch is the branch HEAD points to. It defaults to master.
+	DefaultBranch string
+	// Description is written to the description file of the git directory
+	Description string
+	// Readme adds a README.md to the initial commit
+	Readme bool
+	// Gitignore names the template of the .gitignore of the initial commit
+	Gitignore string
+}
+
+// validBranchName reports whether git accepts name as the name of a branch
+func validBranchName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") ||
+		strings.Contains(name, "//") || name == "@" {
+		return false
+	}
+
+	for _, char := range name {
+		if char <= ' ' || char == 0x7f || strings.ContainsRune(`~^:?*[\`, char) {
+			return false
+		}
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// initialFiles returns the files of the initial commit, by path
+func initialFiles(name string, options *InitOptions) (map[string]string, error) {
+	files := make(map[string]string)
+
+	if options.Readme {
+		files["README.md"] = readme(name, options.Description)
+	}
+
+	if options.Gitignore != "" {
+		template, ok := gitignoreTemplates[strings.ToLower(options.Gitignore)]
+		if !ok {
+			return nil, ErrUnknownTemplate
+		}
+		files[".gitignore"] = template
+	}
+
+	return files, nil
+}
+
+// Init creates a repository at repositoryPath, which must not exist yet. Its
+// README is titled after the last element of the path.
+func Init(fileSystem billy.Filesystem, repositoryPath string, options *InitOptions) error {
+	defaultBranch := options.DefaultBranch
+	if defaultBranch == "" {
+		defaultBranch = "master"
+	}
+	if !validBranchName(defaultBranch) {
+		return ErrInvalidBranchName
+	}
+
+	name := strings.TrimSuffix(path.Base(repositoryPath), ".git")
+	files, err := initialFiles(name, options)
+	if err != nil {
+		return err
+	}
+
+	release, err := reserve(fileSystem, repositoryPath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = initRepository(fileSystem, repositoryPath, defaultBranch, options, files)
+	if err != nil {
+		_ = util.RemoveAll(fileSystem, repositoryPath)
+	}
+
+	return err
+}
+
+// reserve claims repositoryPath for a new repository until release is
+// called. It fails when something is already there, or is being created there.
+func reserve(fileSystem billy.Filesystem, repositoryPath string) (func(), error) {
+	reservedMutex.Lock()
+	defer reservedMutex.Unlock()
+
+	if _, err := fileSystem.Stat(repositoryPath); err == nil || reserved[repositoryPath] {
+		return nil, ErrRepositoryExists
+	}
+	reserved[repositoryPath] = true
+
+	return func() {
+		reservedMutex.Lock()
+		defer reservedMutex.Unlock()
+
+		delete(reserved, repositoryPath)
+	}, nil
+}
+
+// initStorage initializes an empty repository at repositoryPath
+func initStorage(
+	fileSystem billy.Filesystem,
+	repositoryPath string,
+	bare bool,
+) (*gogit.Repository, *filesystem.Storage, error) {
+	gitDirectory := repositoryPath
+	var worktreeFolder billy.Filesystem
+	if !bare {
+		gitDirectory = fmt.Sprintf("%s/.git", repositoryPath)
+
+		var err error
+		worktreeFolder, err = fileSystem.Chroot(repositoryPath)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	dotgitFolder, err := fileSystem.Chroot(gitDirectory)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := filesystem.NewStorage(dotgitFolder, cache.NewObjectLRUDefault())
+	repository, err := gogit.Init(s, worktreeFolder)
+
+	return repository, s, err
+}
+
+func initRepository(
+	fileSystem billy.Filesystem,
+	repositoryPath string,
+	defaultBranch string,
+	options *InitOptions,
+	files map[string]string,
+) error {
+	repository, s, err := initStorage(fileSystem, repositoryPath, options.Bare)
+	if err != nil {
+		return err
+	}
+
+	branch := plumbing.NewBranchReferenceName(defaultBranch)
+	err = s.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch))
+	if err != nil {
+		return err
+	}
+
+	if options.Description != "" {
+		err = util.WriteFile(s.Filesystem(), "description", []byte(options.Description+"\n"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	hash, err := commitFiles(s, files)
+	if err != nil {
+		return err
+	}
+	if err := s.SetReference(plumbing.NewHashReference(branch, hash)); err != nil {
+		return err
+	}
+
+	if options.Bare {
+		return nil
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return worktree.Reset(&gogit.ResetOptions{Commit: hash, Mode: gogit.HardReset})
+}
+
+// commitFiles stores a root commit of the files and returns its hash
+func commitFiles(s *filesystem.Storage, files map[string]string) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	for name, contents := range files {
+		blob := s.NewEncodedObject()
+		blob.SetType(plumbing.BlobObject)
+		writer, err := blob.Writer()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if _, err := writer.Write([]byte(contents)); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if err := writer.Close(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		hash, err := s.SetEncodedObject(blob)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		tree.Entries = append(tree.Entries, object.TreeEntry{
+			Name: name,
+			Mode: filemode.Regular,
+			Hash: hash,
+		})
+	}
+
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return tree.Entries[i].Name < tree.Entries[j].Name
+	})
+
+	treeHash, err := storeObject(s, tree)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	now := signature
+	now.When = time.Now()
+
+	return storeObject(s, &object.Commit{
+		Author:    now,
+		Committer: now,
+		Message:   "Initial commit\n",
+		TreeHash:  treeHash,
+	})
+}
+
+type encoder interface {
+	Encode(plumbing.EncodedObject) error
+}
+
+func storeObject(s *filesystem.Storage, value encoder) (plumbing.Hash, error) {
+	encoded := s.NewEncodedObject()
+	if err := value.Encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.SetEncodedObject(encoded)
+}
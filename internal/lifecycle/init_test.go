@@ -0,0 +1,101 @@
+package lifecycle_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func readFile(t *testing.T, fileSystem billy.Filesystem, filename string) string {
+	file, err := fileSystem.Open(filename)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	contents, err := ioutil.ReadAll(file)
+	assert.NoError(t, err)
+
+	return string(contents)
+}
+
+func TestInitCreatesARepositoryWithAnInitialCommit(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	err := lifecycle.Init(fileSystem, "/srv/team/project", &lifecycle.InitOptions{
+		DefaultBranch: "main",
+		Description:   "Scaffolded",
+		Readme:        true,
+		Gitignore:     "Go",
+	})
+	assert.NoError(err)
+
+	assert.Equal("# project\n\nScaffolded\n",
+		readFile(t, fileSystem, "/srv/team/project/README.md"))
+	assert.Equal("Scaffolded\n",
+		readFile(t, fileSystem, "/srv/team/project/.git/description"))
+
+	repository, err := git.NewReader(fileSystem).Open("/srv/team/project")
+	assert.NoError(err)
+	assert.False(repository.IsBare())
+
+	head, err := repository.Head()
+	assert.NoError(err)
+	assert.EqualValues("refs/heads/main", head.Name())
+}
+
+func TestInitCreatesBareRepositories(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	err := lifecycle.Init(fileSystem, "/srv/project.git", &lifecycle.InitOptions{
+		Bare:   true,
+		Readme: true,
+	})
+	assert.NoError(err)
+
+	repository, err := git.NewReader(fileSystem).Open("/srv/project.git")
+	assert.NoError(err)
+	assert.True(repository.IsBare())
+
+	_, err = repository.ResolveRevision("master:README.md")
+	assert.NoError(err)
+}
+
+func TestInitLeavesTheHistoryEmptyWithoutFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	assert.NoError(lifecycle.Init(fileSystem, "/srv/project", &lifecycle.InitOptions{}))
+
+	repository, err := git.NewReader(fileSystem).Open("/srv/project")
+	assert.NoError(err)
+
+	_, err = repository.Head()
+	assert.Error(err)
+}
+
+func TestInitRejectsInvalidRepositories(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	assert.NoError(fileSystem.MkdirAll("/srv/taken", 0755))
+
+	err := lifecycle.Init(fileSystem, "/srv/taken", &lifecycle.InitOptions{})
+	assert.Equal(lifecycle.ErrRepositoryExists, err)
+
+	for _, branch := range []string{"a..b", "-main", "main.lock", "feature/", "a b", ".hidden"} {
+		err = lifecycle.Init(fileSystem, "/srv/project", &lifecycle.InitOptions{DefaultBranch: branch})
+		assert.Equal(lifecycle.ErrInvalidBranchName, err, branch)
+	}
+
+	err = lifecycle.Init(fileSystem, "/srv/project", &lifecycle.InitOptions{Gitignore: "cobol"})
+	assert.Equal(lifecycle.ErrUnknownTemplate, err)
+
+	_, err = fileSystem.Stat("/srv/project")
+	assert.Error(err)
+}
@@ -0,0 +1,51 @@
+package lifecycle
+
+// gitignoreTemplates are the .gitignore files a new repository can start with
+var gitignoreTemplates = map[string]string{
+	"go": `# Binaries
+*.exe
+*.dll
+*.so
+*.dylib
+*.test
+
+# Coverage
+*.out
+
+vendor/
+`,
+	"node": `node_modules/
+npm-debug.log*
+yarn-debug.log*
+yarn-error.log*
+coverage/
+dist/
+.env
+`,
+	"python": `__pycache__/
+*.py[cod]
+*.egg-info/
+.eggs/
+build/
+dist/
+.venv/
+.pytest_cache/
+`,
+	"java": `*.class
+*.jar
+*.war
+target/
+build/
+.gradle/
+`,
+}
+
+// readme returns the contents of the README of a new repository
+func readme(name string, description string) string {
+	contents := "# " + name + "\n"
+	if description != "" {
+		contents += "\n" + description + "\n"
+	}
+
+	return contents
+}
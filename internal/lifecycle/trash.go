@@ -0,0 +1,92 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+// trashedAtLayout timestamps the repositories in the trash, so that they sort
+// by when they were deleted
+const trashedAtLayout = "20060102T150405.000000000Z"
+
+// Trash keeps deleted repositories for a retention period before removing
+// them for good
+type Trash struct {
+	fileSystem billy.Filesystem
+	directory  string
+	retention  time.Duration
+}
+
+// NewTrash creates a trash in directory. The directory must be on the same
+// device as the repositories, since they are moved rather than copied.
+func NewTrash(fileSystem billy.Filesystem, directory string, retention time.Duration) *Trash {
+	return &Trash{
+		fileSystem: fileSystem,
+		directory:  directory,
+		retention:  retention,
+	}
+}
+
+// Move moves the repository at repositoryPath into the trash and returns
+// where it was moved to. The name of the repository is kept in the name of
+// its directory in the trash, with '|' in place of '/'.
+func (trash *Trash) Move(repositoryPath string, name string, now time.Time) (string, error) {
+	if err := trash.fileSystem.MkdirAll(trash.directory, 0755); err != nil {
+		return "", err
+	}
+
+	trashedPath := filepath.Join(trash.directory, fmt.Sprintf("%s-%s",
+		now.UTC().Format(trashedAtLayout),
+		strings.ReplaceAll(strings.Trim(name, "/"), "/", "|")))
+
+	return trashedPath, trash.fileSystem.Rename(repositoryPath, trashedPath)
+}
+
+// Purge removes the repositories that were moved into the trash longer than
+// the retention period before now, and returns their paths
+func (trash *Trash) Purge(now time.Time) ([]string, error) {
+	entries, err := trash.fileSystem.ReadDir(trash.directory)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	for _, entry := range entries {
+		trashedAt, err := time.Parse(
+			trashedAtLayout, strings.SplitN(entry.Name(), "-", 2)[0])
+		if err != nil || now.Sub(trashedAt) < trash.retention {
+			continue
+		}
+
+		trashedPath := filepath.Join(trash.directory, entry.Name())
+		if err := util.RemoveAll(trash.fileSystem, trashedPath); err != nil {
+			return purged, err
+		}
+		purged = append(purged, trashedPath)
+	}
+
+	return purged, nil
+}
+
+// PurgeEvery purges the trash at every interval, forever
+func (trash *Trash) PurgeEvery(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		purged, err := trash.Purge(now)
+		for _, trashedPath := range purged {
+			log.Printf("trash: purged %s\n", trashedPath)
+		}
+		if err != nil {
+			log.Printf("trash: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package lifecycle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestTrashKeepsRepositoriesForTheRetentionPeriod(t *testing.T) {
+	assert := assert.New(t)
+
+	fileSystem := memfs.New()
+	assert.NoError(lifecycle.Init(fileSystem, "/srv/team/project", &lifecycle.InitOptions{Readme: true}))
+
+	trash := lifecycle.NewTrash(fileSystem, "/srv/.trash", 24*time.Hour)
+	deletedAt := time.Date(2019, 5, 26, 12, 41, 18, 0, time.UTC)
+
+	trashedPath, err := trash.Move("/srv/team/project", "team/project", deletedAt)
+	assert.NoError(err)
+	assert.Equal("/srv/.trash/20190526T124118.000000000Z-team|project", trashedPath)
+
+	_, err = fileSystem.Stat("/srv/team/project")
+	assert.Error(err)
+	_, err = fileSystem.Stat(trashedPath + "/README.md")
+	assert.NoError(err)
+
+	purged, err := trash.Purge(deletedAt.Add(23 * time.Hour))
+	assert.NoError(err)
+	assert.Empty(purged)
+
+	purged, err = trash.Purge(deletedAt.Add(24 * time.Hour))
+	assert.NoError(err)
+	assert.Equal([]string{trashedPath}, purged)
+
+	_, err = fileSystem.Stat(trashedPath)
+	assert.Error(err)
+}
+
+func TestTrashPurgesNothingBeforeAnythingIsDeleted(t *testing.T) {
+	assert := assert.New(t)
+
+	trash := lifecycle.NewTrash(memfs.New(), "/srv/.trash", time.Hour)
+
+	purged, err := trash.Purge(time.Now())
+	assert.NoError(err)
+	assert.Empty(purged)
+}
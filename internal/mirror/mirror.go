@@ -0,0 +1,318 @@
+// Package mirror keeps repositories in sync with the upstream repository they
+// mirror, by fetching every reference of the upstream periodically
+package mirror
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+var (
+	// ErrNotMirror is returned for repositories that do not mirror an upstream
+	ErrNotMirror = errors.New("repository is not a mirror")
+	// ErrUnsupportedURL is returned for URLs mirrors cannot be synced with
+	ErrUnsupportedURL = errors.New("mirror URLs must be absolute paths or file, git, http or https URLs")
+	// ErrWorktree is returned when configuring a repository with a worktree as
+	// a mirror, since syncing would leave its worktree behind
+	ErrWorktree = errors.New("only bare repositories can be mirrors")
+	// ErrInterval is returned for intervals shorter than MinInterval
+	ErrInterval = errors.New("mirrors cannot be synced more often than every minute")
+)
+
+const (
+	// MinInterval is the shortest interval mirrors can be synced at
+	MinInterval = time.Minute
+	// DefaultInterval is the interval mirrors are synced at unless configured
+	// otherwise
+	DefaultInterval = time.Hour
+)
+
+// configSubsection is the subsection of git.ConfigSection mirrors are
+// configured in
+const configSubsection = "mirror"
+
+// remoteName is the name of the remote the upstream is fetched through.
+// Anonymous remotes are never stored in the repository config.
+const remoteName = "anonymous"
+
+type Mirror struct {
+	// The URL of the upstream repository
+	//
+	// required: true
+	// example: https://github.com/src-d/go-git.git
+	URL string `json:"url"`
+
+	// How often the mirror is synced
+	//
+	// required: true
+	// example: 1h0m0s
+	Interval string `json:"interval"`
+
+	// When the mirror was last synced successfully
+	//
+	// example: 2019-05-26T12:41:18-04:00
+	LastSuccessAt string `json:"lastSuccessAt,omitempty"`
+
+	// When syncing the mirror last failed
+	//
+	// example: 2019-05-26T11:41:18-04:00
+	LastFailureAt string `json:"lastFailureAt,omitempty"`
+
+	// Why syncing the mirror last failed
+	LastError string `json:"lastError,omitempty"`
+
+	interval    time.Duration
+	lastAttempt time.Time
+}
+
+// due reports whether the mirror should be synced at now
+func (mirror *Mirror) due(now time.Time) bool {
+	return mirror.lastAttempt.IsZero() || now.Sub(mirror.lastAttempt) >= mirror.interval
+}
+
+// Read returns the mirror configuration and status of the repository
+func Read(repository git.Repository) (*Mirror, error) {
+	cfg, err := repository.Storer().Config()
+	if err != nil {
+		return nil, err
+	}
+
+	section := cfg.Raw.Section(git.ConfigSection)
+	if !section.HasSubsection(configSubsection) {
+		return nil, ErrNotMirror
+	}
+	subsection := section.Subsection(configSubsection)
+	if subsection.Option("url") == "" {
+		return nil, ErrNotMirror
+	}
+
+	mirror := &Mirror{
+		URL:           subsection.Option("url"),
+		LastSuccessAt: subsection.Option("lastSuccessAt"),
+		LastFailureAt: subsection.Option("lastFailureAt"),
+		LastError:     subsection.Option("lastError"),
+	}
+
+	mirror.interval, err = time.ParseDuration(subsection.Option("interval"))
+	if err != nil {
+		mirror.interval = DefaultInterval
+	}
+	mirror.Interval = mirror.interval.String()
+
+	for _, attempt := range []string{mirror.LastSuccessAt, mirror.LastFailureAt} {
+		attemptedAt, err := time.Parse(time.RFC3339, attempt)
+		if err == nil && attemptedAt.After(mirror.lastAttempt) {
+			mirror.lastAttempt = attemptedAt
+		}
+	}
+
+	return mirror, nil
+}
+
+// CheckURL makes sure mirrors can be synced with the repository at rawURL.
+// Repositories on the local filesystem must lie within the sandbox, unless
+// it is nil.
+func CheckURL(rawURL string, sandbox *git.Sandbox) error {
+	endpoint, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return ErrUnsupportedURL
+	}
+
+	switch endpoint.Protocol {
+	case "file":
+		if !filepath.IsAbs(endpoint.Path) {
+			return ErrUnsupportedURL
+		}
+		if sandbox != nil {
+			if _, err := sandbox.Resolve(endpoint.Path); err != nil {
+				return git.ErrOutsideRoot
+			}
+		}
+	case "git", "http", "https":
+	default:
+		return ErrUnsupportedURL
+	}
+
+	return nil
+}
+
+// Configure makes the repository mirror the upstream at rawURL, synced every
+// interval. Reconfiguring a mirror keeps its status.
+func Configure(
+	repository git.Repository,
+	rawURL string,
+	interval time.Duration,
+	sandbox *git.Sandbox,
+) error {
+	if err := CheckURL(rawURL, sandbox); err != nil {
+		return err
+	}
+	if interval < MinInterval {
+		return ErrInterval
+	}
+	if !repository.IsBare() {
+		return ErrWorktree
+	}
+
+	s := repository.Storer()
+	cfg, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	subsection := cfg.Raw.Section(git.ConfigSection).Subsection(configSubsection)
+	if subsection.Option("url") != rawURL {
+		// The status of another upstream says nothing about this one
+		subsection.Options = nil
+	}
+	subsection.SetOption("url", rawURL)
+	subsection.SetOption("interval", interval.String())
+
+	return s.SetConfig(cfg)
+}
+
+// Remove stops the repository from mirroring its upstream. The references
+// it already has are kept.
+func Remove(repository git.Repository) error {
+	if _, err := Read(repository); err != nil {
+		return err
+	}
+
+	s := repository.Storer()
+	cfg, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Raw.RemoveSubsection(git.ConfigSection, configSubsection)
+	section := cfg.Raw.Section(git.ConfigSection)
+	if len(section.Options) == 0 && len(section.Subsections) == 0 {
+		cfg.Raw.RemoveSection(git.ConfigSection)
+	}
+
+	return s.SetConfig(cfg)
+}
+
+// Sync makes the references of the repository match those of its upstream,
+// reports the progress of the fetch to progress, and records the outcome in
+// the status of the mirror
+func Sync(repository git.Repository, progress io.Writer) error {
+	mirror, err := Read(repository)
+	if err != nil {
+		return err
+	}
+
+	syncErr := fetch(repository, mirror.URL, progress)
+	if err := record(repository, time.Now(), syncErr); err != nil {
+		return err
+	}
+
+	return syncErr
+}
+
+func fetch(repository git.Repository, rawURL string, progress io.Writer) error {
+	unlock := git.LockReferences(repository.Storer())
+	defer unlock()
+
+	wrapee, err := gogit.Open(repository.Storer(), nil)
+	if err != nil {
+		return err
+	}
+	remote, err := wrapee.CreateRemoteAnonymous(&config.RemoteConfig{
+		Name:  remoteName,
+		URLs:  []string{rawURL},
+		Fetch: []config.RefSpec{git.MirrorRefSpec},
+	})
+	if err != nil {
+		return err
+	}
+
+	references, err := remote.List(&gogit.ListOptions{})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return err
+	}
+
+	if len(references) > 0 {
+		err = remote.Fetch(&gogit.FetchOptions{
+			RemoteName: remoteName,
+			Progress:   progress,
+			Tags:       gogit.NoTags,
+		})
+		if err != nil && err != gogit.NoErrAlreadyUpToDate {
+			return err
+		}
+	}
+
+	if err := prune(repository.Storer(), references); err != nil {
+		return err
+	}
+
+	head := git.RemoteHead(references)
+	if head == "" {
+		return nil
+	}
+
+	return repository.Storer().SetReference(
+		plumbing.NewSymbolicReference(plumbing.HEAD, head))
+}
+
+// prune removes the references the upstream no longer has
+func prune(s storer.ReferenceStorer, references []*plumbing.Reference) error {
+	upstream := make(map[plumbing.ReferenceName]bool)
+	for _, reference := range references {
+		upstream[reference.Name()] = true
+	}
+
+	iter, err := s.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var stale []plumbing.ReferenceName
+	err = iter.ForEach(func(reference *plumbing.Reference) error {
+		if reference.Name() != plumbing.HEAD && !upstream[reference.Name()] {
+			stale = append(stale, reference.Name())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range stale {
+		if err := s.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// record stores the outcome of a sync at now in the status of the mirror
+func record(repository git.Repository, now time.Time, syncErr error) error {
+	s := repository.Storer()
+	cfg, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	subsection := cfg.Raw.Section(git.ConfigSection).Subsection(configSubsection)
+	if syncErr == nil {
+		subsection.SetOption("lastSuccessAt", now.Format(time.RFC3339))
+	} else {
+		subsection.SetOption("lastFailureAt", now.Format(time.RFC3339))
+		subsection.SetOption("lastError", syncErr.Error())
+	}
+
+	return s.SetConfig(cfg)
+}
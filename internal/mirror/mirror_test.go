@@ -0,0 +1,172 @@
+package mirror_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/discovery"
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/jobs"
+	"github.com/drdgvhbh/gitserver/internal/lifecycle"
+	"github.com/drdgvhbh/gitserver/internal/mirror"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// setup creates an upstream with a main branch and an empty bare repository
+// to mirror it in, under a temporary root
+func setup(t *testing.T) (root string, upstream string, repository git.Repository) {
+	root, upstream = testutil.NewRepository(t, "upstream")
+
+	fileSystem := osfs.New("/")
+	replica := filepath.Join(root, "replica.git")
+	err := lifecycle.Init(fileSystem, replica, &lifecycle.InitOptions{Bare: true})
+	if err == nil {
+		repository, err = git.NewReader(fileSystem).Open(replica)
+	}
+	if err != nil {
+		_ = os.RemoveAll(root)
+		t.Fatal(err)
+	}
+
+	return root, upstream, repository
+}
+
+func TestConfigureValidatesMirrors(t *testing.T) {
+	assert := assert.New(t)
+
+	root, upstream, repository := setup(t)
+	defer os.RemoveAll(root)
+
+	_, err := mirror.Read(repository)
+	assert.Equal(mirror.ErrNotMirror, err)
+
+	assert.Equal(mirror.ErrUnsupportedURL, mirror.Configure(repository, "relative/path", time.Hour, nil))
+	assert.Equal(mirror.ErrUnsupportedURL, mirror.Configure(repository, "ssh://git@example.com/project.git", time.Hour, nil))
+	assert.Equal(mirror.ErrInterval, mirror.Configure(repository, upstream, time.Second, nil))
+
+	worktree, err := git.NewReader(osfs.New("/")).Open(upstream)
+	assert.NoError(err)
+	assert.Equal(mirror.ErrWorktree, mirror.Configure(worktree, "https://example.com/project.git", time.Hour, nil))
+
+	assert.NoError(mirror.Configure(repository, "https://example.com/project.git", 30*time.Minute, nil))
+	configured, err := mirror.Read(repository)
+	assert.NoError(err)
+	assert.Equal("https://example.com/project.git", configured.URL)
+	assert.Equal("30m0s", configured.Interval)
+
+	assert.NoError(git.SetArchived(repository, true))
+	assert.NoError(git.SetArchived(repository, false))
+	assert.NoError(mirror.Remove(repository))
+	_, err = mirror.Read(repository)
+	assert.Equal(mirror.ErrNotMirror, err)
+	assert.Equal(mirror.ErrNotMirror, mirror.Remove(repository))
+}
+
+func TestCheckURLConfinesLocalURLsToTheSandbox(t *testing.T) {
+	assert := assert.New(t)
+
+	root, upstream, _ := setup(t)
+	defer os.RemoveAll(root)
+
+	sandbox, err := git.NewSandbox(upstream)
+	assert.NoError(err)
+
+	assert.NoError(mirror.CheckURL(upstream, sandbox))
+	assert.NoError(mirror.CheckURL("file://"+upstream, sandbox))
+	assert.NoError(mirror.CheckURL("https://example.com/project.git", sandbox))
+	for _, rawURL := range []string{
+		filepath.Join(root, "replica.git"),
+		"file://" + filepath.Join(root, "replica.git"),
+		"file://" + filepath.Join(upstream, "..", "replica.git"),
+		"/etc",
+	} {
+		assert.Equal(git.ErrOutsideRoot, mirror.CheckURL(rawURL, sandbox), rawURL)
+	}
+}
+
+func TestSyncReplacesReferencesWithThoseOfTheUpstream(t *testing.T) {
+	assert := assert.New(t)
+
+	root, upstream, repository := setup(t)
+	defer os.RemoveAll(root)
+
+	assert.NoError(mirror.Configure(repository, "file://"+upstream, time.Hour, nil))
+
+	stale := plumbing.NewHashReference("refs/heads/stale", plumbing.NewHash("0123456789012345678901234567890123456789"))
+	assert.NoError(repository.Storer().SetReference(stale))
+
+	assert.NoError(mirror.Sync(repository, ioutil.Discard))
+
+	head, err := repository.Head()
+	assert.NoError(err)
+	assert.EqualValues("refs/heads/main", head.Name())
+
+	_, err = repository.Reference("refs/heads/stale")
+	assert.Error(err)
+
+	status, err := mirror.Read(repository)
+	assert.NoError(err)
+	assert.NotEmpty(status.LastSuccessAt)
+	assert.Empty(status.LastFailureAt)
+}
+
+func TestSyncRecordsFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	root, _, repository := setup(t)
+	defer os.RemoveAll(root)
+
+	assert.NoError(mirror.Configure(repository, filepath.Join(root, "missing"), time.Hour, nil))
+	assert.Error(mirror.Sync(repository, ioutil.Discard))
+
+	status, err := mirror.Read(repository)
+	assert.NoError(err)
+	assert.NotEmpty(status.LastFailureAt)
+	assert.NotEmpty(status.LastError)
+	assert.Empty(status.LastSuccessAt)
+}
+
+func TestSchedulerSyncsDueMirrors(t *testing.T) {
+	assert := assert.New(t)
+
+	root, upstream, repository := setup(t)
+	defer os.RemoveAll(root)
+	assert.NoError(mirror.Configure(repository, upstream, time.Hour, nil))
+
+	fileSystem := osfs.New("/")
+	sandbox, err := git.NewSandbox(root)
+	assert.NoError(err)
+	runner := jobs.NewRunner(1)
+	scheduler := mirror.NewScheduler(
+		git.NewSandboxedReader(fileSystem, sandbox),
+		discovery.NewScanner(fileSystem, []string{root}, nil),
+		runner,
+		event.NewBus())
+
+	now := time.Now()
+	assert.NoError(scheduler.Schedule(now))
+	started := runner.List()
+	assert.Len(started, 1)
+
+	for i := 0; i < 100; i++ {
+		if job, _ := runner.Find(started[0].ID); job.FinishedAt != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	job, _ := runner.Find(started[0].ID)
+	assert.Equal(jobs.Succeeded, job.Status)
+
+	// Synced mirrors are not due until their interval passed
+	assert.NoError(scheduler.Schedule(now.Add(time.Minute)))
+	assert.Len(runner.List(), 1)
+	assert.NoError(scheduler.Schedule(now.Add(2 * time.Hour)))
+	assert.Len(runner.List(), 2)
+}
@@ -0,0 +1,138 @@
+package mirror
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/discovery"
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/jobs"
+)
+
+// Scheduler syncs the mirrors found under the repository roots as background
+// jobs, once they are due
+type Scheduler struct {
+	reader  git.Reader
+	scanner *discovery.Scanner
+	runner  *jobs.Runner
+	bus     *event.Bus
+
+	mutex sync.Mutex
+	// syncing maps repository names to the job that last synced them
+	syncing map[string]string
+}
+
+// NewScheduler creates a scheduler that syncs the mirrors scanner finds on
+// runner, and publishes the references syncing changed to bus
+func NewScheduler(
+	reader git.Reader,
+	scanner *discovery.Scanner,
+	runner *jobs.Runner,
+	bus *event.Bus,
+) *Scheduler {
+	return &Scheduler{
+		reader:  reader,
+		scanner: scanner,
+		runner:  runner,
+		bus:     bus,
+		syncing: make(map[string]string),
+	}
+}
+
+// Start starts syncing the mirror with the name. When the mirror is already
+// being synced, the job syncing it is returned instead.
+func (scheduler *Scheduler) Start(name string) (jobs.Job, error) {
+	repository, err := scheduler.reader.Open(name)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if _, err := Read(repository); err != nil {
+		return jobs.Job{}, err
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if id, ok := scheduler.syncing[name]; ok {
+		if job, ok := scheduler.runner.Find(id); ok && job.FinishedAt == "" {
+			return job, nil
+		}
+	}
+
+	job := scheduler.runner.Start("mirror", func(progress io.Writer) (interface{}, error) {
+		repositoryPath := git.Locate(scheduler.reader, name)
+		err := scheduler.bus.Watch(repositoryPath, repository.Storer(), func() error {
+			return Sync(repository, progress)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return Read(repository)
+	})
+	scheduler.syncing[name] = job.ID
+
+	return job, nil
+}
+
+// Schedule starts syncing the mirrors that are due at now. Archived mirrors
+// are left as they are.
+func (scheduler *Scheduler) Schedule(now time.Time) error {
+	locations, err := scheduler.scanner.Scan()
+	if err != nil {
+		return err
+	}
+
+	for _, location := range locations {
+		// Shadowed repositories cannot be opened by their name
+		name := location.Name
+		if location.Shadowed {
+			name = location.Path
+		}
+
+		if err := scheduler.scheduleRepository(name, now); err != nil {
+			log.Printf("mirror: %s: %s\n", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (scheduler *Scheduler) scheduleRepository(name string, now time.Time) error {
+	repository, err := scheduler.reader.Open(name)
+	if err != nil {
+		return err
+	}
+
+	mirror, err := Read(repository)
+	if err == ErrNotMirror {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	archived, err := git.IsArchived(repository)
+	if err != nil {
+		return err
+	}
+	if archived || !mirror.due(now) {
+		return nil
+	}
+
+	_, err = scheduler.Start(name)
+	return err
+}
+
+// ScheduleEvery starts the mirrors that are due every interval. It never
+// returns, so it is meant to run on its own goroutine.
+func (scheduler *Scheduler) ScheduleEvery(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		if err := scheduler.Schedule(now); err != nil {
+			log.Printf("mirror: %s\n", err)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package mock
 import (
 	"github.com/drdgvhbh/gitserver/internal/git"
 	"github.com/stretchr/testify/mock"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/storage"
 )
 
 type CommitIter struct {
@@ -68,6 +70,42 @@ func (r *Repository) Reference(name git.ReferenceName) (git.Reference, error) {
 	return args.Get(0).(git.Reference), args.Error(1)
 }
 
+func (r *Repository) ReferencesContaining(hash git.Hash) ([]git.Reference, error) {
+	args := r.Called(hash)
+
+	return args.Get(0).([]git.Reference), args.Error(1)
+}
+
+func (r *Repository) ResolveRevision(revision string) (git.Hash, error) {
+	args := r.Called(revision)
+
+	return args.Get(0).(git.Hash), args.Error(1)
+}
+
+func (r *Repository) Storer() storage.Storer {
+	args := r.Called()
+
+	return args.Get(0).(storage.Storer)
+}
+
+func (r *Repository) GitDirectory() billy.Filesystem {
+	args := r.Called()
+
+	return args.Get(0).(billy.Filesystem)
+}
+
+func (r *Repository) Worktree() billy.Filesystem {
+	args := r.Called()
+
+	return args.Get(0).(billy.Filesystem)
+}
+
+func (r *Repository) IsBare() bool {
+	args := r.Called()
+
+	return args.Bool(0)
+}
+
 type Reader struct {
 	mock.Mock
 }
@@ -75,5 +113,9 @@ type Reader struct {
 func (m *Reader) Open(path string) (git.Repository, error) {
 	args := m.Called(path)
 
+	if repository, ok := args.Get(0).(git.Repository); ok {
+		return repository, args.Error(1)
+	}
+
 	return &Repository{}, args.Error(1)
 }
@@ -0,0 +1,222 @@
+package pack
+
+import (
+	"container/heap"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// walkSlop is how many more commits are walked once only commits reachable
+// from the haves are left, in case commit dates are skewed
+const walkSlop = 5
+
+// commitQueue orders commits newest first
+type commitQueue []*object.Commit
+
+func (queue commitQueue) Len() int { return len(queue) }
+
+func (queue commitQueue) Less(i, j int) bool {
+	return queue[i].Committer.When.After(queue[j].Committer.When)
+}
+
+func (queue commitQueue) Swap(i, j int) { queue[i], queue[j] = queue[j], queue[i] }
+
+func (queue *commitQueue) Push(commit interface{}) {
+	*queue = append(*queue, commit.(*object.Commit))
+}
+
+func (queue *commitQueue) Pop() interface{} {
+	old := *queue
+	commit := old[len(old)-1]
+	*queue = old[:len(old)-1]
+
+	return commit
+}
+
+// commitWalk finds the commits reachable from wants that are not reachable
+// from haves, as git rev-list does. Commits are visited newest first, and the
+// walk ends once every queued commit is reachable from the haves, so the
+// history both sides share is not walked.
+type commitWalk struct {
+	storer  storer.EncodedObjectStorer
+	commits map[plumbing.Hash]*object.Commit
+	// uninteresting holds the commits reachable from the haves
+	uninteresting map[plumbing.Hash]bool
+	popped        map[plumbing.Hash]bool
+	queue         commitQueue
+	// interesting counts the queued commits not known to be reachable from
+	// the haves
+	interesting int
+	order       []*object.Commit
+	// haveStop and wantStop hold the commits whose parents are not walked
+	// from the haves and from the wants respectively
+	haveStop map[plumbing.Hash]bool
+	wantStop map[plumbing.Hash]bool
+}
+
+// walkCommits returns the commits reachable from wants but not from haves,
+// newest first, along with the commits reachable from haves that the walk
+// came across
+func walkCommits(
+	s storer.EncodedObjectStorer,
+	wants []plumbing.Hash,
+	haves []plumbing.Hash,
+	options *Options,
+) (missing []*object.Commit, common []*object.Commit, err error) {
+	w := &commitWalk{
+		storer:        s,
+		commits:       make(map[plumbing.Hash]*object.Commit),
+		uninteresting: make(map[plumbing.Hash]bool),
+		popped:        make(map[plumbing.Hash]bool),
+		haveStop:      hashSet(options.ClientShallow),
+		wantStop:      hashSet(options.Shallow),
+	}
+
+	for _, have := range haves {
+		if err := w.markUninteresting(have); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, want := range wants {
+		if err := w.push(want); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	slop := walkSlop
+	for w.queue.Len() > 0 {
+		if w.interesting > 0 {
+			slop = walkSlop
+		} else if slop--; slop < 0 {
+			break
+		}
+
+		commit := heap.Pop(&w.queue).(*object.Commit)
+		w.popped[commit.Hash] = true
+
+		if w.uninteresting[commit.Hash] {
+			if w.haveStop[commit.Hash] {
+				continue
+			}
+			for _, parent := range commit.ParentHashes {
+				if err := w.markUninteresting(parent); err != nil {
+					return nil, nil, err
+				}
+			}
+			continue
+		}
+
+		w.interesting--
+		w.order = append(w.order, commit)
+		if w.wantStop[commit.Hash] {
+			continue
+		}
+		for _, parent := range commit.ParentHashes {
+			if err := w.push(parent); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Commits walked before a later one showed them to be reachable from the
+	// haves are not missing after all
+	for _, commit := range w.order {
+		if !w.uninteresting[commit.Hash] {
+			missing = append(missing, commit)
+		}
+	}
+	for hash := range w.uninteresting {
+		if commit, ok := w.commits[hash]; ok {
+			common = append(common, commit)
+		}
+	}
+
+	return missing, common, nil
+}
+
+// push queues a commit reachable from the wants, unless it was already
+func (w *commitWalk) push(hash plumbing.Hash) error {
+	if _, ok := w.commits[hash]; ok {
+		return nil
+	}
+
+	commit, err := object.GetCommit(w.storer, hash)
+	if err != nil {
+		return err
+	}
+
+	w.commits[hash] = commit
+	heap.Push(&w.queue, commit)
+	if !w.uninteresting[hash] {
+		w.interesting++
+	}
+
+	return nil
+}
+
+// markUninteresting marks a commit and, when it was already walked, its
+// ancestors as reachable from the haves
+func (w *commitWalk) markUninteresting(hash plumbing.Hash) error {
+	pending := []plumbing.Hash{hash}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if w.uninteresting[hash] {
+			continue
+		}
+		w.uninteresting[hash] = true
+
+		commit, known := w.commits[hash]
+		switch {
+		case !known:
+			// The client may have history the server lacks
+			err := w.push(hash)
+			if err != nil && err != plumbing.ErrObjectNotFound {
+				return err
+			}
+		case !w.popped[hash]:
+			w.interesting--
+		case !w.haveStop[hash]:
+			pending = append(pending, commit.ParentHashes...)
+		}
+	}
+
+	return nil
+}
+
+// Unreachable returns the commits that cannot be reached from tips. Like
+// Objects, it only walks the history down to where the tips' history starts.
+func Unreachable(
+	s storer.EncodedObjectStorer,
+	commits []plumbing.Hash,
+	tips []plumbing.Hash,
+) ([]plumbing.Hash, error) {
+	var tipCommits []plumbing.Hash
+	for _, tip := range tips {
+		if commit, err := peelToCommit(s, tip); err == nil {
+			tipCommits = append(tipCommits, commit.Hash)
+		}
+	}
+
+	missing, _, err := walkCommits(s, commits, tipCommits, &Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	unreachable := make(map[plumbing.Hash]bool, len(missing))
+	for _, commit := range missing {
+		unreachable[commit.Hash] = true
+	}
+
+	var result []plumbing.Hash
+	for _, commit := range commits {
+		if unreachable[commit] {
+			result = append(result, commit)
+		}
+	}
+
+	return result, nil
+}
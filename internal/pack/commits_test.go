@@ -0,0 +1,87 @@
+package pack_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/pack"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// readCounter records the objects that are read from a storage
+type readCounter struct {
+	*memory.Storage
+	reads map[plumbing.Hash]int
+}
+
+func (counter *readCounter) EncodedObject(
+	kind plumbing.ObjectType,
+	hash plumbing.Hash,
+) (plumbing.EncodedObject, error) {
+	counter.reads[hash]++
+
+	return counter.Storage.EncodedObject(kind, hash)
+}
+
+func TestObjectsOnlyWalksTheHistorySinceTheHaves(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := &readCounter{Storage: memory.NewStorage(), reads: make(map[plumbing.Hash]int)}
+	history := newHistory(t, storage.Storage, 20)
+	tip := history[len(history)-1]
+	have := history[len(history)-2]
+
+	hashes, err := pack.Objects(storage, []plumbing.Hash{tip}, []plumbing.Hash{have}, nil)
+	assert.NoError(err)
+	assert.Equal([]plumbing.Hash{tip}, hashes)
+
+	for _, commit := range history[:10] {
+		assert.Zero(storage.reads[commit], "%s was read", commit)
+	}
+}
+
+func TestObjectsLeavesOutMergedHistoryTheClientHas(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	history := newHistory(t, storage, 5)
+	side := testutil.StoreCommit(t, storage, "side", history[1])
+	signature := object.Signature{
+		Name:  "Ryan Lee",
+		Email: "ryanleecode@gmail.com",
+		When:  time.Date(2019, 6, 25, 12, 0, 0, 0, time.UTC),
+	}
+	tree := testutil.StoreObject(t, storage, &object.Tree{})
+	merge := testutil.StoreObject(t, storage, &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      "Merge side",
+		TreeHash:     tree,
+		ParentHashes: []plumbing.Hash{history[4], side},
+	})
+
+	hashes, err := pack.Objects(storage, []plumbing.Hash{merge}, []plumbing.Hash{history[4]}, nil)
+	assert.NoError(err)
+
+	sideCommit, err := object.GetCommit(storage, side)
+	assert.NoError(err)
+	readme := testutil.StoreBlob(t, storage, "side")
+	assert.ElementsMatch([]plumbing.Hash{merge, side, sideCommit.TreeHash, readme}, hashes)
+}
+
+func TestUnreachable(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	history := newHistory(t, storage, 5)
+	dangling := testutil.StoreCommit(t, storage, "dangling", history[1])
+
+	unreachable, err := pack.Unreachable(storage,
+		[]plumbing.Hash{history[0], dangling, history[3]}, []plumbing.Hash{history[4]})
+	assert.NoError(err)
+	assert.Equal([]plumbing.Hash{dangling}, unreachable)
+}
@@ -0,0 +1,92 @@
+package pack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter omits objects from a pack, as requested by partial clones
+type Filter struct {
+	// blobLimit omits blobs of at least this many bytes, unless it is negative
+	blobLimit int64
+	// treeDepth omits trees and blobs this deep or deeper below the root tree,
+	// unless it is negative
+	treeDepth int
+}
+
+// ParseFilter parses a filter specification such as blob:none,
+// blob:limit=1m or tree:1
+func ParseFilter(spec string) (*Filter, error) {
+	filter := &Filter{blobLimit: -1, treeDepth: -1}
+
+	switch {
+	case spec == "blob:none":
+		filter.blobLimit = 0
+	case strings.HasPrefix(spec, "blob:limit="):
+		limit, err := parseSize(strings.TrimPrefix(spec, "blob:limit="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %s", spec, err)
+		}
+		filter.blobLimit = limit
+	case strings.HasPrefix(spec, "tree:"):
+		depth, err := strconv.Atoi(strings.TrimPrefix(spec, "tree:"))
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid filter %q", spec)
+		}
+		filter.treeDepth = depth
+	default:
+		return nil, fmt.Errorf("unsupported filter %q", spec)
+	}
+
+	return filter, nil
+}
+
+func parseSize(size string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(size, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(size, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(size, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		size = size[:len(size)-1]
+	}
+
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	return value * multiplier, nil
+}
+
+// limitsTreeDepth reports whether trees can be omitted depending on where
+// they are reached from
+func (filter *Filter) limitsTreeDepth() bool {
+	return filter != nil && filter.treeDepth >= 0
+}
+
+// omitsTree reports whether a tree at the given depth below the root tree is
+// left out
+func (filter *Filter) omitsTree(depth int) bool {
+	return filter.limitsTreeDepth() && depth >= filter.treeDepth
+}
+
+// omitsBlobs reports whether blobs at the given depth can be left out
+// without knowing their size
+func (filter *Filter) omitsBlobs(depth int) bool {
+	if filter == nil {
+		return false
+	}
+
+	return filter.blobLimit == 0 || filter.omitsTree(depth)
+}
+
+// omitsBlob reports whether a blob of the given size is left out
+func (filter *Filter) omitsBlob(size int64) bool {
+	return filter != nil && filter.blobLimit >= 0 && size >= filter.blobLimit
+}
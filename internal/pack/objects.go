@@ -0,0 +1,280 @@
+// Package pack computes the objects a client is missing and encodes them
+// as packfiles
+package pack
+
+import (
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+const packWindow = 10
+
+// Options narrow down the objects that are packed
+type Options struct {
+	// Filter leaves out objects the client does not want, as in a partial
+	// clone. Objects that are wanted explicitly are always packed.
+	Filter *Filter
+	// ClientShallow holds the client's shallow commits, whose parents it does
+	// not have
+	ClientShallow []plumbing.Hash
+	// Shallow holds the commits whose parents are not sent to the client
+	Shallow []plumbing.Hash
+}
+
+func hashSet(hashes []plumbing.Hash) map[plumbing.Hash]bool {
+	set := make(map[plumbing.Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		set[hash] = true
+	}
+
+	return set
+}
+
+// Objects returns the hashes of every object reachable from wants that is not
+// reachable from haves. Only the history between the wants and the haves is
+// walked: objects the client has are recognized from the trees of the
+// commits where that history meets the haves'.
+func Objects(
+	s storer.EncodedObjectStorer,
+	wants []plumbing.Hash,
+	haves []plumbing.Hash,
+	options *Options,
+) ([]plumbing.Hash, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	w := &walker{
+		storer:     s,
+		seen:       make(map[plumbing.Hash]bool),
+		treeDepths: make(map[plumbing.Hash]int),
+	}
+
+	var haveCommits []plumbing.Hash
+	for _, have := range haves {
+		_, target, kind, err := peel(s, have)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if kind == plumbing.CommitObject {
+			haveCommits = append(haveCommits, target)
+		} else if err := w.walk(target, kind); err != nil && err != plumbing.ErrObjectNotFound {
+			return nil, err
+		}
+	}
+
+	var tags, wantCommits, others []plumbing.Hash
+	var otherKinds []plumbing.ObjectType
+	for _, want := range wants {
+		peeled, target, kind, err := peel(s, want)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, peeled...)
+		if kind == plumbing.CommitObject {
+			wantCommits = append(wantCommits, target)
+		} else {
+			others = append(others, target)
+			otherKinds = append(otherKinds, kind)
+		}
+	}
+
+	missing, common, err := walkCommits(s, wantCommits, haveCommits, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, commit := range common {
+		w.seen[commit.Hash] = true
+		if err := w.walkTree(commit.TreeHash, 0); err != nil && err != plumbing.ErrObjectNotFound {
+			return nil, err
+		}
+	}
+
+	w.collect = true
+	w.filter = options.Filter
+	for _, tag := range tags {
+		w.add(tag)
+	}
+	for _, commit := range missing {
+		w.add(commit.Hash)
+		if err := w.walkTree(commit.TreeHash, 0); err != nil {
+			return nil, err
+		}
+	}
+	for i, hash := range others {
+		if err := w.walk(hash, otherKinds[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return w.objects, nil
+}
+
+// Connected checks that every object reachable from wants that is not
+// reachable from haves is stored, like git does before accepting a push. It
+// returns plumbing.ErrObjectNotFound when one is missing.
+func Connected(s storer.EncodedObjectStorer, wants []plumbing.Hash, haves []plumbing.Hash) error {
+	hashes, err := Objects(s, wants, haves, nil)
+	if err != nil {
+		return err
+	}
+
+	// Blobs are listed without being read
+	for _, hash := range hashes {
+		if err := s.HasEncodedObject(hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// peel follows tags to the object they point to, returning the tags along
+// the way and the object's type
+func peel(
+	s storer.EncodedObjectStorer,
+	hash plumbing.Hash,
+) ([]plumbing.Hash, plumbing.Hash, plumbing.ObjectType, error) {
+	var tags []plumbing.Hash
+	for {
+		encoded, err := s.EncodedObject(plumbing.AnyObject, hash)
+		if err != nil {
+			return nil, hash, plumbing.InvalidObject, err
+		}
+
+		if encoded.Type() != plumbing.TagObject {
+			return tags, hash, encoded.Type(), nil
+		}
+
+		tag, err := object.DecodeTag(s, encoded)
+		if err != nil {
+			return nil, hash, plumbing.InvalidObject, err
+		}
+
+		tags = append(tags, hash)
+		hash = tag.Target
+	}
+}
+
+// Encode writes a packfile containing the specified objects
+func Encode(
+	writer io.Writer,
+	s storer.EncodedObjectStorer,
+	hashes []plumbing.Hash,
+	useRefDeltas bool,
+) error {
+	encoder := packfile.NewEncoder(writer, s, useRefDeltas)
+	_, err := encoder.Encode(hashes, packWindow)
+
+	return err
+}
+
+type walker struct {
+	storer  storer.EncodedObjectStorer
+	seen    map[plumbing.Hash]bool
+	objects []plumbing.Hash
+	collect bool
+	filter  *Filter
+	// treeDepths holds the shallowest depth each tree was reached at, since a
+	// tree omitted for being too deep may be reached again closer to the root
+	treeDepths map[plumbing.Hash]int
+}
+
+func (w *walker) add(hash plumbing.Hash) bool {
+	if w.seen[hash] {
+		return false
+	}
+
+	w.seen[hash] = true
+	if w.collect {
+		w.objects = append(w.objects, hash)
+	}
+
+	return true
+}
+
+// walk adds a tree or a blob that was asked for by its hash
+func (w *walker) walk(hash plumbing.Hash, kind plumbing.ObjectType) error {
+	if w.seen[hash] {
+		return nil
+	}
+
+	if kind == plumbing.TreeObject && !w.filter.omitsTree(0) {
+		return w.walkTree(hash, 0)
+	}
+
+	w.add(hash)
+
+	return nil
+}
+
+func (w *walker) walkTree(hash plumbing.Hash, depth int) error {
+	if w.filter.omitsTree(depth) {
+		return nil
+	}
+
+	if w.filter.limitsTreeDepth() {
+		if previous, ok := w.treeDepths[hash]; ok && previous <= depth {
+			return nil
+		}
+
+		w.treeDepths[hash] = depth
+		w.add(hash)
+	} else if !w.add(hash) {
+		return nil
+	}
+
+	tree, err := object.GetTree(w.storer, hash)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range tree.Entries {
+		switch entry.Mode {
+		case filemode.Submodule:
+			continue
+		case filemode.Dir:
+			if err := w.walkTree(entry.Hash, depth+1); err != nil {
+				return err
+			}
+		default:
+			if err := w.walkBlob(entry.Hash, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *walker) walkBlob(hash plumbing.Hash, depth int) error {
+	if w.seen[hash] || w.filter.omitsBlobs(depth) {
+		return nil
+	}
+
+	if w.filter != nil && w.filter.blobLimit > 0 {
+		blob, err := w.storer.EncodedObject(plumbing.BlobObject, hash)
+		if err != nil {
+			return err
+		}
+
+		if w.filter.omitsBlob(blob.Size()) {
+			return nil
+		}
+	}
+
+	w.add(hash)
+
+	return nil
+}
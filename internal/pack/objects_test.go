@@ -0,0 +1,152 @@
+package pack_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/pack"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+type fixture struct {
+	storage   *memory.Storage
+	commit    plumbing.Hash
+	root      plumbing.Hash
+	directory plumbing.Hash
+	small     plumbing.Hash
+	large     plumbing.Hash
+	nested    plumbing.Hash
+}
+
+// newFixture stores a commit whose tree holds a small and a large blob at the
+// root and another blob in a subdirectory
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{storage: memory.NewStorage()}
+
+	f.small = testutil.StoreBlob(t, f.storage, "small")
+	f.large = testutil.StoreBlob(t, f.storage, strings.Repeat("large", 100))
+	f.nested = testutil.StoreBlob(t, f.storage, "nested")
+
+	f.directory = testutil.StoreObject(t, f.storage, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "nested.txt", Mode: filemode.Regular, Hash: f.nested},
+	}})
+	f.root = testutil.StoreObject(t, f.storage, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "directory", Mode: filemode.Dir, Hash: f.directory},
+		{Name: "large.txt", Mode: filemode.Regular, Hash: f.large},
+		{Name: "small.txt", Mode: filemode.Regular, Hash: f.small},
+	}})
+
+	signature := object.Signature{Name: "Ryan Lee", Email: "ryanleecode@gmail.com", When: time.Now()}
+	f.commit = testutil.StoreObject(t, f.storage, &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   "Initial commit",
+		TreeHash:  f.root,
+	})
+
+	return f
+}
+
+func objects(t *testing.T, f *fixture, spec string) []plumbing.Hash {
+	var options *pack.Options
+	if spec != "" {
+		filter, err := pack.ParseFilter(spec)
+		assert.NoError(t, err)
+		options = &pack.Options{Filter: filter}
+	}
+
+	hashes, err := pack.Objects(f.storage, []plumbing.Hash{f.commit}, nil, options)
+	assert.NoError(t, err)
+
+	return hashes
+}
+
+func TestObjectsWithoutFilter(t *testing.T) {
+	f := newFixture(t)
+
+	assert.ElementsMatch(t, []plumbing.Hash{
+		f.commit, f.root, f.directory, f.small, f.large, f.nested,
+	}, objects(t, f, ""))
+}
+
+func TestObjectsExcludesHaves(t *testing.T) {
+	f := newFixture(t)
+
+	hashes, err := pack.Objects(
+		f.storage, []plumbing.Hash{f.commit}, []plumbing.Hash{f.directory}, nil)
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []plumbing.Hash{
+		f.commit, f.root, f.small, f.large,
+	}, hashes)
+}
+
+func TestObjectsWithBlobNoneFilter(t *testing.T) {
+	f := newFixture(t)
+
+	assert.ElementsMatch(t, []plumbing.Hash{
+		f.commit, f.root, f.directory,
+	}, objects(t, f, "blob:none"))
+}
+
+func TestObjectsWithBlobLimitFilter(t *testing.T) {
+	f := newFixture(t)
+
+	assert.ElementsMatch(t, []plumbing.Hash{
+		f.commit, f.root, f.directory, f.small, f.nested,
+	}, objects(t, f, "blob:limit=100"))
+}
+
+func TestObjectsWithTreeDepthFilter(t *testing.T) {
+	f := newFixture(t)
+
+	assert.ElementsMatch(t, []plumbing.Hash{f.commit}, objects(t, f, "tree:0"))
+	assert.ElementsMatch(t, []plumbing.Hash{f.commit, f.root}, objects(t, f, "tree:1"))
+	assert.ElementsMatch(t, []plumbing.Hash{
+		f.commit, f.root, f.directory, f.small, f.large,
+	}, objects(t, f, "tree:2"))
+}
+
+func TestObjectsAlwaysIncludesWantedObjects(t *testing.T) {
+	f := newFixture(t)
+
+	filter, err := pack.ParseFilter("blob:none")
+	assert.NoError(t, err)
+
+	hashes, err := pack.Objects(
+		f.storage, []plumbing.Hash{f.large}, nil, &pack.Options{Filter: filter})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []plumbing.Hash{f.large}, hashes)
+}
+
+func TestParseFilterRejectsUnknownFilters(t *testing.T) {
+	for _, spec := range []string{"sparse:oid=HEAD", "blob:limit=x", "tree:-1"} {
+		_, err := pack.ParseFilter(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestConnectedFindsMissingObjects(t *testing.T) {
+	assert := assert.New(t)
+	f := newFixture(t)
+
+	assert.NoError(pack.Connected(f.storage, []plumbing.Hash{f.commit}, nil))
+
+	orphan := testutil.StoreCommit(t, f.storage, "Orphan", plumbing.NewHash("1111111111111111111111111111111111111111"))
+	assert.Equal(plumbing.ErrObjectNotFound, pack.Connected(f.storage, []plumbing.Hash{orphan}, nil))
+
+	delete(f.storage.Objects, f.nested)
+	delete(f.storage.Blobs, f.nested)
+	assert.Equal(plumbing.ErrObjectNotFound, pack.Connected(f.storage, []plumbing.Hash{f.commit}, nil))
+
+	// Objects reachable from the haves are not checked
+	child := testutil.StoreCommit(t, f.storage, "Child", f.commit)
+	assert.NoError(pack.Connected(f.storage, []plumbing.Hash{child}, []plumbing.Hash{f.commit}))
+}
@@ -0,0 +1,178 @@
+package pack
+
+import (
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// Deepen limits the history sent to a shallow clone. Depth cannot be
+// combined with Since or Not.
+type Deepen struct {
+	// Depth is the number of commits sent along each line of history
+	Depth int
+	// Relative counts Depth from the commits that are shallow on the client,
+	// which Shallow is then given instead of the wants, rather than from the
+	// wants. Those commits are not counted as they are already on the client.
+	Relative bool
+	// Since leaves out commits committed before it
+	Since time.Time
+	// Not leaves out commits reachable from these commits
+	Not []plumbing.Hash
+}
+
+// ShallowHistory is the part of the history sent to a shallow clone
+type ShallowHistory struct {
+	// Commits holds every commit that is sent
+	Commits map[plumbing.Hash]bool
+	// Boundary holds the sent commits whose parents are not sent
+	Boundary map[plumbing.Hash]bool
+}
+
+type pendingCommit struct {
+	hash  plumbing.Hash
+	depth int
+}
+
+// Shallow walks the history of wants as limited by deepen
+func Shallow(
+	s storer.EncodedObjectStorer,
+	wants []plumbing.Hash,
+	deepen *Deepen,
+) (*ShallowHistory, error) {
+	excluded, err := reachableCommits(s, deepen.Not)
+	if err != nil {
+		return nil, err
+	}
+
+	depth := deepen.Depth
+	if deepen.Relative && depth > 0 {
+		depth++
+	}
+
+	history := &ShallowHistory{
+		Commits:  make(map[plumbing.Hash]bool),
+		Boundary: make(map[plumbing.Hash]bool),
+	}
+
+	var pending []pendingCommit
+	for _, want := range wants {
+		if commit, err := peelToCommit(s, want); err == nil {
+			pending = append(pending, pendingCommit{hash: commit.Hash, depth: 1})
+		}
+	}
+
+	// Breadth first, so that each commit is reached at its shallowest depth
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		if history.Commits[current.hash] {
+			continue
+		}
+
+		commit, err := object.GetCommit(s, current.hash)
+		if err != nil {
+			return nil, err
+		}
+		history.Commits[current.hash] = true
+
+		if len(commit.ParentHashes) == 0 {
+			continue
+		}
+
+		if depth > 0 && current.depth >= depth {
+			history.Boundary[current.hash] = true
+			continue
+		}
+
+		parents, cut := includedParents(s, commit, deepen, excluded)
+		if cut {
+			history.Boundary[current.hash] = true
+			continue
+		}
+
+		for _, parent := range parents {
+			pending = append(pending, pendingCommit{hash: parent, depth: current.depth + 1})
+		}
+	}
+
+	return history, nil
+}
+
+// includedParents returns the parents of a commit that are within the
+// requested history, and whether any parent was cut off
+func includedParents(
+	s storer.EncodedObjectStorer,
+	commit *object.Commit,
+	deepen *Deepen,
+	excluded map[plumbing.Hash]bool,
+) ([]plumbing.Hash, bool) {
+	for _, parent := range commit.ParentHashes {
+		if excluded[parent] {
+			return nil, true
+		}
+
+		if !deepen.Since.IsZero() {
+			parentCommit, err := object.GetCommit(s, parent)
+			if err != nil || parentCommit.Committer.When.Before(deepen.Since) {
+				return nil, true
+			}
+		}
+	}
+
+	return commit.ParentHashes, false
+}
+
+func reachableCommits(
+	s storer.EncodedObjectStorer,
+	tips []plumbing.Hash,
+) (map[plumbing.Hash]bool, error) {
+	reachable := make(map[plumbing.Hash]bool)
+
+	var pending []plumbing.Hash
+	for _, tip := range tips {
+		commit, err := peelToCommit(s, tip)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, commit.Hash)
+	}
+
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if reachable[hash] {
+			continue
+		}
+		reachable[hash] = true
+
+		commit, err := object.GetCommit(s, hash)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, commit.ParentHashes...)
+	}
+
+	return reachable, nil
+}
+
+func peelToCommit(s storer.EncodedObjectStorer, hash plumbing.Hash) (*object.Commit, error) {
+	for {
+		tag, err := object.GetTag(s, hash)
+		if err != nil {
+			break
+		}
+
+		hash = tag.Target
+	}
+
+	return object.GetCommit(s, hash)
+}
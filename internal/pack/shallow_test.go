@@ -0,0 +1,123 @@
+package pack_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/pack"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// newHistory stores a line of commits, one day apart, and returns them from
+// oldest to newest
+func newHistory(t *testing.T, storage *memory.Storage, length int) []plumbing.Hash {
+	tree := testutil.StoreObject(t, storage, &object.Tree{})
+	start := time.Date(2019, 5, 25, 12, 0, 0, 0, time.UTC)
+
+	var commits []plumbing.Hash
+	for i := 0; i < length; i++ {
+		signature := object.Signature{
+			Name:  "Ryan Lee",
+			Email: "ryanleecode@gmail.com",
+			When:  start.AddDate(0, 0, i),
+		}
+
+		commit := &object.Commit{
+			Author:    signature,
+			Committer: signature,
+			Message:   "Commit",
+			TreeHash:  tree,
+		}
+		if i > 0 {
+			commit.ParentHashes = []plumbing.Hash{commits[i-1]}
+		}
+
+		commits = append(commits, testutil.StoreObject(t, storage, commit))
+	}
+
+	return commits
+}
+
+func TestShallowWithDepth(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	commits := newHistory(t, storage, 4)
+	tip := commits[3]
+
+	history, err := pack.Shallow(storage, []plumbing.Hash{tip}, &pack.Deepen{Depth: 1})
+	assert.NoError(err)
+	assert.Equal(map[plumbing.Hash]bool{tip: true}, history.Commits)
+	assert.Equal(map[plumbing.Hash]bool{tip: true}, history.Boundary)
+
+	history, err = pack.Shallow(storage, []plumbing.Hash{tip}, &pack.Deepen{Depth: 2})
+	assert.NoError(err)
+	assert.Equal(map[plumbing.Hash]bool{tip: true, commits[2]: true}, history.Commits)
+	assert.Equal(map[plumbing.Hash]bool{commits[2]: true}, history.Boundary)
+
+	history, err = pack.Shallow(storage, []plumbing.Hash{tip}, &pack.Deepen{Depth: 10})
+	assert.NoError(err)
+	assert.Len(history.Commits, 4)
+	assert.Empty(history.Boundary)
+}
+
+func TestShallowSince(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	commits := newHistory(t, storage, 4)
+
+	history, err := pack.Shallow(storage, []plumbing.Hash{commits[3]}, &pack.Deepen{
+		Since: time.Date(2019, 5, 27, 0, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(err)
+	assert.Equal(map[plumbing.Hash]bool{commits[3]: true, commits[2]: true}, history.Commits)
+	assert.Equal(map[plumbing.Hash]bool{commits[2]: true}, history.Boundary)
+}
+
+func TestShallowNot(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	commits := newHistory(t, storage, 4)
+
+	history, err := pack.Shallow(storage, []plumbing.Hash{commits[3]}, &pack.Deepen{
+		Not: []plumbing.Hash{commits[1]},
+	})
+	assert.NoError(err)
+	assert.Equal(map[plumbing.Hash]bool{commits[3]: true, commits[2]: true}, history.Commits)
+	assert.Equal(map[plumbing.Hash]bool{commits[2]: true}, history.Boundary)
+}
+
+func TestShallowRelative(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	commits := newHistory(t, storage, 5)
+
+	// The client is shallow at commits[3], and wants one more commit
+	history, err := pack.Shallow(storage, []plumbing.Hash{commits[3]}, &pack.Deepen{
+		Depth:    1,
+		Relative: true,
+	})
+	assert.NoError(err)
+	assert.Equal(map[plumbing.Hash]bool{commits[3]: true, commits[2]: true}, history.Commits)
+	assert.Equal(map[plumbing.Hash]bool{commits[2]: true}, history.Boundary)
+}
+
+func TestObjectsStopsAtShallowCommits(t *testing.T) {
+	storage := memory.NewStorage()
+	commits := newHistory(t, storage, 3)
+
+	hashes, err := pack.Objects(storage, []plumbing.Hash{commits[2]}, nil, &pack.Options{
+		Shallow: []plumbing.Hash{commits[2]},
+	})
+	assert.NoError(t, err)
+
+	tree := testutil.StoreObject(t, storage, &object.Tree{})
+	assert.ElementsMatch(t, []plumbing.Hash{commits[2], tree}, hashes)
+}
@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+const (
+	// UploadPackService is the service used to fetch from a repository
+	UploadPackService = "git-upload-pack"
+	// ReceivePackService is the service used to push to a repository
+	ReceivePackService = "git-receive-pack"
+)
+
+// WriteServiceHeader writes the preamble smart HTTP clients expect before
+// the reference advertisement
+func WriteServiceHeader(packets *PacketWriter, service string) error {
+	if err := packets.WriteLine("# service=%s", service); err != nil {
+		return err
+	}
+
+	return packets.Flush()
+}
+
+// advertisedReference is a reference as it is presented to clients
+type advertisedReference struct {
+	name   plumbing.ReferenceName
+	hash   plumbing.Hash
+	peeled plumbing.Hash
+}
+
+// listReferences resolves HEAD and every reference of the repository. HEAD
+// comes first, the remaining references are sorted by name.
+func listReferences(s storer.Storer) ([]advertisedReference, *plumbing.Reference, error) {
+	return listMatchingReferences(s, nil)
+}
+
+// listMatchingReferences is listReferences limited to the references whose
+// name starts with one of prefixes, or to all of them when there are none.
+// The other references are not resolved.
+func listMatchingReferences(
+	s storer.Storer,
+	prefixes []string,
+) ([]advertisedReference, *plumbing.Reference, error) {
+	refIter, err := s.IterReferences()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer refIter.Close()
+
+	var references []advertisedReference
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() == plumbing.HEAD || !hasAnyPrefix(ref.Name().String(), prefixes) {
+			return nil
+		}
+
+		resolved, err := storer.ResolveReference(s, ref.Name())
+		if err != nil || resolved.Hash().IsZero() {
+			return nil
+		}
+
+		references = append(references, advertisedReference{
+			name:   ref.Name(),
+			hash:   resolved.Hash(),
+			peeled: peel(s, resolved.Hash()),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(references, func(i, j int) bool {
+		return references[i].name < references[j].name
+	})
+
+	head, err := s.Reference(plumbing.HEAD)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return nil, nil, err
+	}
+
+	if !hasAnyPrefix(plumbing.HEAD.String(), prefixes) {
+		return references, head, nil
+	}
+
+	resolvedHead, err := storer.ResolveReference(s, plumbing.HEAD)
+	if err == nil && !resolvedHead.Hash().IsZero() {
+		references = append([]advertisedReference{{
+			name: plumbing.HEAD,
+			hash: resolvedHead.Hash(),
+		}}, references...)
+	}
+
+	return references, head, nil
+}
+
+func hasAnyPrefix(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// peel returns the object an annotated tag ultimately points to, or the zero
+// hash if the object is not a tag
+func peel(s storer.EncodedObjectStorer, hash plumbing.Hash) plumbing.Hash {
+	peeled := plumbing.ZeroHash
+	for {
+		tag, err := object.GetTag(s, hash)
+		if err != nil {
+			return peeled
+		}
+
+		hash = tag.Target
+		peeled = hash
+	}
+}
+
+// addSymrefCapability describes where HEAD points to, if it is symbolic
+func addSymrefCapability(capabilities Capabilities, head *plumbing.Reference) {
+	if head != nil && head.Type() == plumbing.SymbolicReference {
+		capabilities["symref"] = "HEAD:" + head.Target().String()
+	}
+}
+
+// writeReferenceAdvertisement writes the protocol v0 reference advertisement
+func writeReferenceAdvertisement(
+	packets *PacketWriter,
+	references []advertisedReference,
+	capabilities Capabilities,
+) error {
+	if len(references) == 0 {
+		err := packets.WriteLine("%s capabilities^{}\x00%s",
+			plumbing.ZeroHash, capabilities)
+		if err != nil {
+			return err
+		}
+
+		return packets.Flush()
+	}
+
+	for i, ref := range references {
+		var err error
+		if i == 0 {
+			err = packets.WriteLine("%s %s\x00%s", ref.hash, ref.name, capabilities)
+		} else {
+			err = packets.WriteLine("%s %s", ref.hash, ref.name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !ref.peeled.IsZero() {
+			if err := packets.WriteLine("%s %s^{}", ref.peeled, ref.name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return packets.Flush()
+}
@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"sort"
+	"strings"
+)
+
+// Agent identifies the server to clients
+const Agent = "gitserver/0.0.1"
+
+// Capabilities is a set of protocol capabilities, some of which carry a value
+type Capabilities map[string]string
+
+// ParseCapabilities parses a space separated capability list
+func ParseCapabilities(list string) Capabilities {
+	capabilities := make(Capabilities)
+	for _, capability := range strings.Fields(list) {
+		parts := strings.SplitN(capability, "=", 2)
+		if len(parts) == 2 {
+			capabilities[parts[0]] = parts[1]
+		} else {
+			capabilities[parts[0]] = ""
+		}
+	}
+
+	return capabilities
+}
+
+// Has reports whether the capability is present
+func (capabilities Capabilities) Has(name string) bool {
+	_, ok := capabilities[name]
+
+	return ok
+}
+
+// String formats the capabilities as a space separated list
+func (capabilities Capabilities) String() string {
+	names := make([]string, 0, len(capabilities))
+	for name := range capabilities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]string, len(names))
+	for i, name := range names {
+		if value := capabilities[name]; value != "" {
+			list[i] = name + "=" + value
+		} else {
+			list[i] = name
+		}
+	}
+
+	return strings.Join(list, " ")
+}
@@ -0,0 +1,39 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// WriteInfoRefs writes the references of the repository the way
+// `git update-server-info` does, which is what dumb HTTP clients read
+// instead of a reference advertisement
+func WriteInfoRefs(writer io.Writer, s storer.Storer) error {
+	references, _, err := listReferences(s)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range references {
+		// Dumb clients request HEAD on its own
+		if ref.name == plumbing.HEAD {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(writer, "%s\t%s\n", ref.hash, ref.name); err != nil {
+			return err
+		}
+
+		if !ref.peeled.IsZero() {
+			_, err := fmt.Fprintf(writer, "%s\t%s^{}\n", ref.peeled, ref.name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
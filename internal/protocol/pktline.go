@@ -0,0 +1,144 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	pktLengthSize = 4
+	// MaxPayloadSize is the largest payload a single pkt-line can carry
+	MaxPayloadSize = 65516
+)
+
+// ErrInvalidPacketLength is returned when a pkt-line header cannot be parsed
+var ErrInvalidPacketLength = errors.New("invalid pkt-line length")
+
+// PacketType distinguishes data packets from the special zero-length ones
+type PacketType int
+
+const (
+	// DataPacket is a packet that carries a payload
+	DataPacket PacketType = iota
+	// FlushPacket (0000) terminates a message
+	FlushPacket
+	// DelimPacket (0001) separates sections of a protocol v2 message
+	DelimPacket
+	// ResponseEndPacket (0002) terminates a stateless protocol v2 response
+	ResponseEndPacket
+)
+
+// Packet is a single decoded pkt-line
+type Packet struct {
+	Type    PacketType
+	Payload []byte
+}
+
+// Line returns the payload without its trailing line feed
+func (packet Packet) Line() string {
+	payload := packet.Payload
+	if len(payload) > 0 && payload[len(payload)-1] == '\n' {
+		payload = payload[:len(payload)-1]
+	}
+
+	return string(payload)
+}
+
+// PacketReader reads pkt-lines from an underlying reader
+type PacketReader struct {
+	reader io.Reader
+	header [pktLengthSize]byte
+}
+
+// NewPacketReader creates a PacketReader
+func NewPacketReader(reader io.Reader) *PacketReader {
+	return &PacketReader{reader: reader}
+}
+
+// Read reads the next packet. io.EOF is only returned at a packet boundary.
+func (reader *PacketReader) Read() (Packet, error) {
+	if _, err := io.ReadFull(reader.reader, reader.header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Packet{}, ErrInvalidPacketLength
+		}
+		return Packet{}, err
+	}
+
+	var length [2]byte
+	if _, err := hex.Decode(length[:], reader.header[:]); err != nil {
+		return Packet{}, ErrInvalidPacketLength
+	}
+
+	size := int(length[0])<<8 | int(length[1])
+	switch {
+	case size == 0:
+		return Packet{Type: FlushPacket}, nil
+	case size == 1:
+		return Packet{Type: DelimPacket}, nil
+	case size == 2:
+		return Packet{Type: ResponseEndPacket}, nil
+	case size < pktLengthSize:
+		return Packet{}, ErrInvalidPacketLength
+	}
+
+	payload := make([]byte, size-pktLengthSize)
+	if _, err := io.ReadFull(reader.reader, payload); err != nil {
+		return Packet{}, ErrInvalidPacketLength
+	}
+
+	return Packet{Type: DataPacket, Payload: payload}, nil
+}
+
+// PacketWriter writes pkt-lines to an underlying writer
+type PacketWriter struct {
+	writer io.Writer
+}
+
+// NewPacketWriter creates a PacketWriter
+func NewPacketWriter(writer io.Writer) *PacketWriter {
+	return &PacketWriter{writer: writer}
+}
+
+// Write writes a payload as a single data packet
+func (writer *PacketWriter) Write(payload []byte) (int, error) {
+	if len(payload) > MaxPayloadSize {
+		return 0, fmt.Errorf("pkt-line payload of %d bytes is too large", len(payload))
+	}
+
+	header := fmt.Sprintf("%04x", len(payload)+pktLengthSize)
+	if _, err := io.WriteString(writer.writer, header); err != nil {
+		return 0, err
+	}
+
+	return writer.writer.Write(payload)
+}
+
+// WriteLine writes a formatted line terminated by a line feed
+func (writer *PacketWriter) WriteLine(format string, args ...interface{}) error {
+	_, err := writer.Write([]byte(fmt.Sprintf(format, args...) + "\n"))
+
+	return err
+}
+
+// WriteError writes an ERR packet, which aborts the conversation on the client
+func (writer *PacketWriter) WriteError(format string, args ...interface{}) error {
+	return writer.WriteLine("ERR "+format, args...)
+}
+
+// Flush writes a flush packet
+func (writer *PacketWriter) Flush() error {
+	return writer.writeSpecial(0)
+}
+
+// Delim writes a delimiter packet
+func (writer *PacketWriter) Delim() error {
+	return writer.writeSpecial(1)
+}
+
+func (writer *PacketWriter) writeSpecial(size int) error {
+	_, err := io.WriteString(writer.writer, fmt.Sprintf("%04x", size))
+
+	return err
+}
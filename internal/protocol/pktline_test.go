@@ -0,0 +1,61 @@
+package protocol_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacketWriterEncodesLines(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := new(bytes.Buffer)
+	packets := protocol.NewPacketWriter(buffer)
+
+	assert.NoError(packets.WriteLine("# service=%s", protocol.UploadPackService))
+	assert.NoError(packets.Flush())
+	assert.NoError(packets.Delim())
+
+	assert.Equal("001e# service=git-upload-pack\n00000001", buffer.String())
+}
+
+func TestPacketReaderDecodesPackets(t *testing.T) {
+	assert := assert.New(t)
+
+	packets := protocol.NewPacketReader(
+		bytes.NewBufferString("0009done\n000000010002"))
+
+	packet, err := packets.Read()
+	assert.NoError(err)
+	assert.Equal(protocol.DataPacket, packet.Type)
+	assert.Equal("done", packet.Line())
+
+	for _, packetType := range []protocol.PacketType{
+		protocol.FlushPacket,
+		protocol.DelimPacket,
+		protocol.ResponseEndPacket,
+	} {
+		packet, err = packets.Read()
+		assert.NoError(err)
+		assert.Equal(packetType, packet.Type)
+	}
+
+	_, err = packets.Read()
+	assert.Equal(io.EOF, err)
+}
+
+func TestPacketReaderRejectsInvalidLengths(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := protocol.NewPacketReader(bytes.NewBufferString("zzzz")).Read()
+	assert.Equal(protocol.ErrInvalidPacketLength, err)
+
+	_, err = protocol.NewPacketReader(bytes.NewBufferString("0003")).Read()
+	assert.Equal(protocol.ErrInvalidPacketLength, err)
+
+	_, err = protocol.NewPacketReader(bytes.NewBufferString("0010short")).Read()
+	assert.Equal(protocol.ErrInvalidPacketLength, err)
+}
@@ -0,0 +1,284 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/pack"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+// ReceivePack serves git-receive-pack, which clients use to push
+type ReceivePack struct {
+	// Storer holds the objects, references and configuration of the repository
+	Storer storage.Storer
+}
+
+// ReferenceUpdate is a command sent by the client to change a reference
+type ReferenceUpdate struct {
+	Name plumbing.ReferenceName
+	Old  plumbing.Hash
+	New  plumbing.Hash
+}
+
+// IsCreate reports whether the reference did not exist before
+func (update ReferenceUpdate) IsCreate() bool {
+	return update.Old.IsZero()
+}
+
+// IsDelete reports whether the reference is being removed
+func (update ReferenceUpdate) IsDelete() bool {
+	return update.New.IsZero()
+}
+
+func (r *ReceivePack) capabilities() Capabilities {
+	return Capabilities{
+		"report-status": "",
+		"delete-refs":   "",
+		"ofs-delta":     "",
+		"no-thin":       "",
+		"agent":         Agent,
+	}
+}
+
+// AdvertiseReferences writes the references of the repository along with
+// the supported capabilities
+func (r *ReceivePack) AdvertiseReferences(writer io.Writer) error {
+	references, _, err := listReferences(r.Storer)
+	if err != nil {
+		return err
+	}
+
+	// Only HEAD's target is of interest to pushing clients, not HEAD itself
+	if len(references) > 0 && references[0].name == plumbing.HEAD {
+		references = references[1:]
+	}
+
+	return writeReferenceAdvertisement(
+		NewPacketWriter(writer), references, r.capabilities())
+}
+
+// Serve reads the client's reference update commands and packfile, applies
+// the updates that are valid and reports the status of each one. It returns
+// the updates that were applied.
+func (r *ReceivePack) Serve(reader io.Reader, writer io.Writer) ([]ReferenceUpdate, error) {
+	packets := NewPacketReader(reader)
+
+	updates, capabilities, err := readReferenceUpdates(packets)
+	if err != nil || len(updates) == 0 {
+		return nil, err
+	}
+
+	unpackErr := r.unpack(reader, updates)
+
+	results := make([]string, len(updates))
+	var applied []ReferenceUpdate
+	for i, update := range updates {
+		if unpackErr != nil {
+			results[i] = "unpacker error"
+			continue
+		}
+
+		if reason := r.apply(update); reason != "" {
+			results[i] = reason
+			continue
+		}
+
+		applied = append(applied, update)
+	}
+
+	if !capabilities.Has("report-status") {
+		return applied, unpackErr
+	}
+
+	out := NewPacketWriter(writer)
+	err = func() error {
+		if unpackErr != nil {
+			return out.WriteLine("unpack %s", unpackErr)
+		}
+		return out.WriteLine("unpack ok")
+	}()
+	if err != nil {
+		return applied, err
+	}
+
+	for i, update := range updates {
+		if results[i] == "" {
+			err = out.WriteLine("ok %s", update.Name)
+		} else {
+			err = out.WriteLine("ng %s %s", update.Name, results[i])
+		}
+		if err != nil {
+			return applied, err
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		return applied, err
+	}
+
+	return applied, unpackErr
+}
+
+func readReferenceUpdates(packets *PacketReader) ([]ReferenceUpdate, Capabilities, error) {
+	var updates []ReferenceUpdate
+	capabilities := make(Capabilities)
+
+	for {
+		packet, err := packets.Read()
+		if err == io.EOF && len(updates) == 0 {
+			return nil, capabilities, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if packet.Type == FlushPacket {
+			return updates, capabilities, nil
+		}
+
+		line := packet.Line()
+		if nul := strings.IndexByte(line, 0); nul >= 0 {
+			if len(updates) == 0 {
+				capabilities = ParseCapabilities(line[nul+1:])
+			}
+			line = line[:nul]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, nil, fmt.Errorf("invalid reference update: %q", line)
+		}
+
+		oldHash, err := parseHash(fields[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		newHash, err := parseHash(fields[1])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		updates = append(updates, ReferenceUpdate{
+			Name: plumbing.ReferenceName(fields[2]),
+			Old:  oldHash,
+			New:  newHash,
+		})
+	}
+}
+
+// unpack stores the packfile that follows the commands. Clients do not send
+// one when they only delete references.
+func (r *ReceivePack) unpack(reader io.Reader, updates []ReferenceUpdate) error {
+	for _, update := range updates {
+		if !update.IsDelete() {
+			return packfile.UpdateObjectStorage(r.Storer, reader)
+		}
+	}
+
+	return nil
+}
+
+// apply validates and performs a single update. It returns the reason the
+// update was rejected, or an empty string if it succeeded.
+func (r *ReceivePack) apply(update ReferenceUpdate) string {
+	if !strings.HasPrefix(update.Name.String(), "refs/") {
+		return "funny refname"
+	}
+
+	if !update.IsDelete() {
+		object, err := r.Storer.EncodedObject(plumbing.AnyObject, update.New)
+		if err != nil {
+			return "missing necessary objects"
+		}
+		if update.Name.IsBranch() && object.Type() != plumbing.CommitObject {
+			return "branches must point to commits"
+		}
+		if err := r.checkConnected(update.New); err != nil {
+			return "missing necessary objects"
+		}
+	}
+
+	if reason := r.checkCurrentBranch(update); reason != "" {
+		return reason
+	}
+
+	unlock := git.LockReferences(r.Storer)
+	defer unlock()
+
+	current, err := r.Storer.Reference(update.Name)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return "failed to lock"
+	}
+
+	exists := err == nil
+	if update.IsCreate() && exists {
+		return "already exists"
+	}
+	if !update.IsCreate() && (!exists || current.Hash() != update.Old) {
+		return "stale info"
+	}
+
+	if update.IsDelete() {
+		err = r.Storer.RemoveReference(update.Name)
+	} else {
+		err = r.Storer.SetReference(
+			plumbing.NewHashReference(update.Name, update.New))
+	}
+	if err != nil {
+		return "failed to update ref"
+	}
+
+	return ""
+}
+
+// checkConnected makes sure every object the new value of a reference needs
+// is stored, walking its history until it meets that of the existing
+// references
+func (r *ReceivePack) checkConnected(hash plumbing.Hash) error {
+	refIter, err := r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+	defer refIter.Close()
+
+	var tips []plumbing.Hash
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return pack.Connected(r.Storer, []plumbing.Hash{hash}, tips)
+}
+
+// checkCurrentBranch refuses to delete the branch HEAD points to and, in
+// repositories with a worktree, to update it behind the worktree's back
+func (r *ReceivePack) checkCurrentBranch(update ReferenceUpdate) string {
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil || head.Type() != plumbing.SymbolicReference ||
+		head.Target() != update.Name {
+		return ""
+	}
+
+	if update.IsDelete() {
+		return "deletion of the current branch prohibited"
+	}
+
+	config, err := r.Storer.Config()
+	if err != nil {
+		return "failed to read config"
+	}
+	if !config.Core.IsBare {
+		return "branch is currently checked out"
+	}
+
+	return ""
+}
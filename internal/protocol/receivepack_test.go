@@ -0,0 +1,86 @@
+package protocol_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestReceivePackUpdatesPackedReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "receive-pack")
+	assert.NoError(err)
+	defer os.RemoveAll(directory)
+
+	storage := filesystem.NewStorage(osfs.New(directory), cache.NewObjectLRUDefault())
+	first := testutil.StoreCommit(t, storage, "first")
+	second := testutil.StoreCommit(t, storage, "second", first)
+
+	// Only packed-refs knows about the branch, as after git gc
+	assert.NoError(ioutil.WriteFile(filepath.Join(directory, "packed-refs"),
+		[]byte(fmt.Sprintf("%s refs/heads/master\n", first)), 0644))
+	assert.NoError(storage.SetReference(
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master")))
+	config, err := storage.Config()
+	assert.NoError(err)
+	config.Core.IsBare = true
+	assert.NoError(storage.SetConfig(config))
+
+	request := new(bytes.Buffer)
+	packets := protocol.NewPacketWriter(request)
+	assert.NoError(packets.WriteLine("%s %s refs/heads/master\x00report-status", first, second))
+	assert.NoError(packets.Flush())
+	// The client already has every object, so the packfile is empty
+	_, err = packfile.NewEncoder(request, storage, false).Encode(nil, 0)
+	assert.NoError(err)
+
+	receivePack := &protocol.ReceivePack{Storer: storage}
+	response := new(bytes.Buffer)
+	applied, err := receivePack.Serve(request, response)
+	assert.NoError(err)
+	assert.Len(applied, 1)
+	assert.Contains(response.String(), "ok refs/heads/master")
+
+	master, err := storage.Reference("refs/heads/master")
+	assert.NoError(err)
+	assert.Equal(second, master.Hash())
+}
+
+func TestReceivePackRefusesHistoriesWithMissingObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	missingParent := plumbing.NewHash("1111111111111111111111111111111111111111")
+	orphan := testutil.StoreCommit(t, storage, "orphan", missingParent)
+
+	request := new(bytes.Buffer)
+	packets := protocol.NewPacketWriter(request)
+	assert.NoError(packets.WriteLine("%s %s refs/heads/feature\x00report-status", plumbing.ZeroHash, orphan))
+	assert.NoError(packets.Flush())
+	_, err := packfile.NewEncoder(request, storage, false).Encode(nil, 0)
+	assert.NoError(err)
+
+	receivePack := &protocol.ReceivePack{Storer: storage}
+	response := new(bytes.Buffer)
+	applied, err := receivePack.Serve(request, response)
+	assert.NoError(err)
+	assert.Empty(applied)
+	assert.Contains(response.String(), "ng refs/heads/feature missing necessary objects")
+
+	_, err = storage.Reference("refs/heads/feature")
+	assert.Equal(plumbing.ErrReferenceNotFound, err)
+}
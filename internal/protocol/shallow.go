@@ -0,0 +1,179 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/pack"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+var errDeepenConflict = errors.New(
+	"deepen and deepen-since (or deepen-not) cannot be used together")
+
+var errRelativeWithoutDepth = errors.New("deepen-relative requires deepen")
+
+// shallowRequest is what a shallow client asked for and what it is sent
+type shallowRequest struct {
+	// client holds the commits that are shallow on the client
+	client []plumbing.Hash
+	deepen *pack.Deepen
+
+	// shallow holds the newly shallow commits reported to the client
+	shallow []plumbing.Hash
+	// unshallow holds client shallow commits whose parents are now sent
+	unshallow []plumbing.Hash
+	// boundary holds every commit whose parents are not sent
+	boundary []plumbing.Hash
+	// parents holds the parents of unshallowed commits, which are sent along
+	// with the wants
+	parents []plumbing.Hash
+}
+
+// parseShallowLine handles the shallow and deepen lines of an upload request.
+// It reports whether the line was one of them.
+func (request *shallowRequest) parseShallowLine(s storer.Storer, line string) (bool, error) {
+	if line == "deepen-relative" {
+		request.deepening().Relative = true
+		return true, nil
+	}
+
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) != 2 {
+		return false, nil
+	}
+
+	argument := fields[1]
+	switch fields[0] {
+	case "shallow":
+		hash, err := parseHash(argument)
+		if err != nil {
+			return true, err
+		}
+		request.client = append(request.client, hash)
+	case "deepen":
+		depth, err := strconv.Atoi(argument)
+		if err != nil || depth <= 0 {
+			return true, fmt.Errorf("invalid depth %q", argument)
+		}
+		request.deepening().Depth = depth
+	case "deepen-since":
+		timestamp, err := strconv.ParseInt(argument, 10, 64)
+		if err != nil {
+			return true, fmt.Errorf("invalid deepen-since %q", argument)
+		}
+		request.deepening().Since = time.Unix(timestamp, 0)
+	case "deepen-not":
+		hash, err := resolveRevision(s, argument)
+		if err != nil {
+			return true, fmt.Errorf("invalid deepen-not %q", argument)
+		}
+		request.deepening().Not = append(request.deepening().Not, hash)
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (request *shallowRequest) deepening() *pack.Deepen {
+	if request.deepen == nil {
+		request.deepen = &pack.Deepen{}
+	}
+
+	return request.deepen
+}
+
+// resolveRevision resolves a reference name the way a user would type it
+func resolveRevision(s storer.Storer, name string) (plumbing.Hash, error) {
+	candidates := []string{name, "refs/" + name, "refs/tags/" + name, "refs/heads/" + name}
+	for _, candidate := range candidates {
+		ref, err := storer.ResolveReference(s, plumbing.ReferenceName(candidate))
+		if err == nil {
+			return ref.Hash(), nil
+		}
+	}
+
+	return plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+}
+
+// compute works out which commits become shallow and which stop being
+// shallow on the client
+func (request *shallowRequest) compute(s storer.Storer, wants []plumbing.Hash) error {
+	request.boundary = request.client
+	if request.deepen == nil {
+		return nil
+	}
+
+	deepen := request.deepen
+	if deepen.Depth > 0 && (!deepen.Since.IsZero() || len(deepen.Not) > 0) {
+		return errDeepenConflict
+	}
+
+	// Relative deepening extends the history the client already has, from
+	// its shallow commits down
+	tips := wants
+	if deepen.Relative {
+		if deepen.Depth == 0 {
+			return errRelativeWithoutDepth
+		}
+		tips = request.client
+	}
+
+	history, err := pack.Shallow(s, tips, deepen)
+	if err != nil {
+		return err
+	}
+
+	client := make(map[plumbing.Hash]bool, len(request.client))
+	for _, hash := range request.client {
+		client[hash] = true
+	}
+
+	request.boundary = nil
+	for hash := range history.Boundary {
+		request.boundary = append(request.boundary, hash)
+		if !client[hash] {
+			request.shallow = append(request.shallow, hash)
+		}
+	}
+
+	for _, hash := range request.client {
+		if !history.Commits[hash] || history.Boundary[hash] {
+			request.boundary = append(request.boundary, hash)
+			continue
+		}
+
+		commit, err := object.GetCommit(s, hash)
+		if err != nil {
+			return err
+		}
+
+		request.unshallow = append(request.unshallow, hash)
+		request.parents = append(request.parents, commit.ParentHashes...)
+	}
+
+	return nil
+}
+
+// writeShallowLines reports the shallow and unshallowed commits
+func (request *shallowRequest) writeShallowLines(out *PacketWriter) error {
+	for _, hash := range request.shallow {
+		if err := out.WriteLine("shallow %s", hash); err != nil {
+			return err
+		}
+	}
+
+	for _, hash := range request.unshallow {
+		if err := out.WriteLine("unshallow %s", hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package protocol
+
+import "io"
+
+// Band is a side-band channel
+type Band byte
+
+const (
+	// PackBand carries packfile data
+	PackBand Band = 1
+	// ProgressBand carries progress messages shown to the user
+	ProgressBand Band = 2
+	// ErrorBand carries a fatal error message
+	ErrorBand Band = 3
+)
+
+// Side-band packets are at most 1000 bytes long and side-band-64k ones as
+// long as any pkt-line. The band byte leaves one byte less for the data.
+const (
+	sideBandPayloadSize    = 1000 - pktLengthSize - 1
+	sideBand64kPayloadSize = MaxPayloadSize - 1
+)
+
+// SideBandWriter multiplexes data onto a single band of a side-band stream
+type SideBandWriter struct {
+	packets *PacketWriter
+	band    Band
+	size    int
+}
+
+// NewSideBandWriter creates a SideBandWriter. large selects side-band-64k
+// framing instead of side-band.
+func NewSideBandWriter(packets *PacketWriter, band Band, large bool) *SideBandWriter {
+	size := sideBandPayloadSize
+	if large {
+		size = sideBand64kPayloadSize
+	}
+
+	return &SideBandWriter{
+		packets: packets,
+		band:    band,
+		size:    size,
+	}
+}
+
+// Write splits data into side-band packets
+func (writer *SideBandWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > writer.size {
+			chunk = chunk[:writer.size]
+		}
+
+		payload := append([]byte{byte(writer.band)}, chunk...)
+		if _, err := writer.packets.Write(payload); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		data = data[len(chunk):]
+	}
+
+	return written, nil
+}
+
+var _ io.Writer = &SideBandWriter{}
@@ -0,0 +1,431 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/pack"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// UploadPack serves git-upload-pack, which clients use to clone and fetch
+type UploadPack struct {
+	// Storer holds the objects and references of the repository
+	Storer storer.Storer
+	// StatelessRPC is set when each request is a self-contained exchange,
+	// as it is for smart HTTP
+	StatelessRPC bool
+}
+
+type uploadRequest struct {
+	wants        []plumbing.Hash
+	capabilities Capabilities
+	common       []plumbing.Hash
+	filter       *pack.Filter
+	shallowRequest
+}
+
+func (u *UploadPack) capabilities() Capabilities {
+	return Capabilities{
+		"multi_ack_detailed":           "",
+		"side-band":                    "",
+		"side-band-64k":                "",
+		"ofs-delta":                    "",
+		"include-tag":                  "",
+		"no-progress":                  "",
+		"allow-tip-sha1-in-want":       "",
+		"allow-reachable-sha1-in-want": "",
+		"filter":                       "",
+		"shallow":                      "",
+		"deepen-since":                 "",
+		"deepen-not":                   "",
+		"deepen-relative":              "",
+		"agent":                        Agent,
+	}
+}
+
+// AdvertiseReferences writes the references of the repository along with
+// the supported capabilities
+func (u *UploadPack) AdvertiseReferences(writer io.Writer) error {
+	references, head, err := listReferences(u.Storer)
+	if err != nil {
+		return err
+	}
+
+	capabilities := u.capabilities()
+	addSymrefCapability(capabilities, head)
+
+	return writeReferenceAdvertisement(
+		NewPacketWriter(writer), references, capabilities)
+}
+
+// Serve reads the objects the client wants, negotiates the objects both
+// sides have in common and sends a packfile with the rest
+func (u *UploadPack) Serve(reader io.Reader, writer io.Writer) error {
+	packets := NewPacketReader(reader)
+	out := NewPacketWriter(writer)
+
+	request, err := u.readUploadRequest(packets)
+	if err != nil {
+		_ = out.WriteError("upload-pack: %s", err)
+		return err
+	}
+
+	// A client that only wanted the advertisement hangs up without wants
+	if len(request.wants) == 0 {
+		return nil
+	}
+
+	if err := u.validateWants(out, request.wants); err != nil {
+		return err
+	}
+
+	if err := request.compute(u.Storer, request.wants); err != nil {
+		_ = out.WriteError("upload-pack: %s", err)
+		return err
+	}
+
+	// Shallow clients read the shallow lines before negotiating
+	if request.deepen != nil {
+		if err := request.writeShallowLines(out); err != nil {
+			return err
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+	}
+
+	done, err := u.negotiate(packets, out, request)
+	if err != nil || !done {
+		return err
+	}
+
+	return u.sendPack(out, request)
+}
+
+// validateWants makes sure the client only asks for objects that are
+// reachable from the advertised references, as allow-reachable-sha1-in-want
+// promises
+func (u *UploadPack) validateWants(out *PacketWriter, wants []plumbing.Hash) error {
+	for _, want := range wants {
+		_, err := u.Storer.EncodedObject(plumbing.AnyObject, want)
+		if err == plumbing.ErrObjectNotFound {
+			_ = out.WriteError("upload-pack: not our ref %s", want)
+			return fmt.Errorf("not our ref %s", want)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	unreachable, err := u.unreachable(wants)
+	if err != nil {
+		return err
+	}
+	if len(unreachable) > 0 {
+		_ = out.WriteError("upload-pack: not our ref %s", unreachable[0])
+		return fmt.Errorf("not our ref %s", unreachable[0])
+	}
+
+	return nil
+}
+
+// unreachable returns the wants that are not reachable from the advertised
+// references. Wanted commits that are not tips are looked for in the history
+// down to where the tips' history starts. Other objects can only be found by
+// walking every tree of the history, which only clients fetching what a
+// partial clone left out ask for.
+func (u *UploadPack) unreachable(wants []plumbing.Hash) ([]plumbing.Hash, error) {
+	references, _, err := listReferences(u.Storer)
+	if err != nil {
+		return nil, err
+	}
+
+	tips := make(map[plumbing.Hash]bool)
+	var hashes []plumbing.Hash
+	for _, ref := range references {
+		tips[ref.hash] = true
+		if !ref.peeled.IsZero() {
+			tips[ref.peeled] = true
+		}
+		hashes = append(hashes, ref.hash)
+	}
+
+	var commits, others []plumbing.Hash
+	for _, want := range wants {
+		if tips[want] {
+			continue
+		}
+
+		encoded, err := u.Storer.EncodedObject(plumbing.AnyObject, want)
+		if err != nil {
+			return nil, err
+		}
+		if encoded.Type() == plumbing.CommitObject {
+			commits = append(commits, want)
+		} else {
+			others = append(others, want)
+		}
+	}
+
+	var unreachable []plumbing.Hash
+	if len(commits) > 0 {
+		unreachable, err = pack.Unreachable(u.Storer, commits, hashes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(others) > 0 {
+		objects, err := pack.Objects(u.Storer, hashes, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		reachable := make(map[plumbing.Hash]bool, len(objects))
+		for _, hash := range objects {
+			reachable[hash] = true
+		}
+
+		for _, want := range others {
+			if !reachable[want] {
+				unreachable = append(unreachable, want)
+			}
+		}
+	}
+
+	return unreachable, nil
+}
+
+func (u *UploadPack) readUploadRequest(packets *PacketReader) (*uploadRequest, error) {
+	request := &uploadRequest{capabilities: make(Capabilities)}
+
+	for {
+		packet, err := packets.Read()
+		if err == io.EOF && len(request.wants) == 0 {
+			return request, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if packet.Type == FlushPacket {
+			return request, nil
+		}
+
+		line := packet.Line()
+		switch {
+		case strings.HasPrefix(line, "want "):
+			fields := strings.SplitN(strings.TrimPrefix(line, "want "), " ", 2)
+			hash, err := parseHash(fields[0])
+			if err != nil {
+				return nil, err
+			}
+
+			if len(request.wants) == 0 && len(fields) == 2 {
+				request.capabilities = ParseCapabilities(fields[1])
+			}
+			request.wants = append(request.wants, hash)
+		case strings.HasPrefix(line, "filter "):
+			filter, err := pack.ParseFilter(strings.TrimPrefix(line, "filter "))
+			if err != nil {
+				return nil, err
+			}
+			request.filter = filter
+		default:
+			ok, err := request.parseShallowLine(u.Storer, line)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("unexpected line in upload request: %q", line)
+			}
+		}
+	}
+}
+
+// negotiate reads have lines and acknowledges the ones that are common,
+// following the rules of multi_ack_detailed or plain acknowledgements. It
+// reports whether the client is done and expects a packfile.
+func (u *UploadPack) negotiate(
+	packets *PacketReader,
+	out *PacketWriter,
+	request *uploadRequest,
+) (bool, error) {
+	multiAck := request.capabilities.Has("multi_ack_detailed")
+	common := make(map[plumbing.Hash]bool)
+	var last plumbing.Hash
+
+	for {
+		packet, err := packets.Read()
+		if err != nil {
+			return false, err
+		}
+
+		if packet.Type == FlushPacket {
+			if len(request.common) == 0 || multiAck {
+				if err := out.WriteLine("NAK"); err != nil {
+					return false, err
+				}
+			}
+			if u.StatelessRPC {
+				return false, nil
+			}
+			continue
+		}
+
+		line := packet.Line()
+		switch {
+		case strings.HasPrefix(line, "have "):
+			hash, err := parseHash(strings.TrimPrefix(line, "have "))
+			if err != nil {
+				return false, err
+			}
+
+			_, err = u.Storer.EncodedObject(plumbing.AnyObject, hash)
+			if err == plumbing.ErrObjectNotFound {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+
+			last = hash
+			if !common[hash] {
+				common[hash] = true
+				request.common = append(request.common, hash)
+			}
+
+			if multiAck {
+				err = out.WriteLine("ACK %s common", hash)
+			} else if len(request.common) == 1 {
+				err = out.WriteLine("ACK %s", hash)
+			}
+			if err != nil {
+				return false, err
+			}
+		case line == "done":
+			if len(request.common) == 0 {
+				return true, out.WriteLine("NAK")
+			}
+			if multiAck {
+				return true, out.WriteLine("ACK %s", last)
+			}
+
+			return true, nil
+		default:
+			return false, fmt.Errorf("unexpected line during negotiation: %q", line)
+		}
+	}
+}
+
+func (u *UploadPack) sendPack(out *PacketWriter, request *uploadRequest) error {
+	wants := append(append([]plumbing.Hash{}, request.wants...), request.parents...)
+	objects, err := pack.Objects(u.Storer, wants, request.common, &pack.Options{
+		Filter:        request.filter,
+		ClientShallow: request.client,
+		Shallow:       request.boundary,
+	})
+	if err != nil {
+		return err
+	}
+
+	if request.capabilities.Has("include-tag") {
+		tags, err := u.tagsPointingInto(objects)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, tags...)
+	}
+
+	return sendPackfile(out, u.Storer, objects, request.capabilities)
+}
+
+// tagsPointingInto returns the annotated tags whose targets are among the
+// objects being sent but that are not being sent themselves
+func (u *UploadPack) tagsPointingInto(objects []plumbing.Hash) ([]plumbing.Hash, error) {
+	sent := make(map[plumbing.Hash]bool, len(objects))
+	for _, hash := range objects {
+		sent[hash] = true
+	}
+
+	refIter, err := u.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	defer refIter.Close()
+
+	var tags []plumbing.Hash
+	err = refIter.ForEach(func(ref *plumbing.Reference) error {
+		if !ref.Name().IsTag() || sent[ref.Hash()] {
+			return nil
+		}
+
+		tag, err := object.GetTag(u.Storer, ref.Hash())
+		if err != nil {
+			return nil
+		}
+
+		if sent[tag.Target] {
+			sent[ref.Hash()] = true
+			tags = append(tags, ref.Hash())
+		}
+
+		return nil
+	})
+
+	return tags, err
+}
+
+// sendPackfile encodes the objects as a packfile, multiplexed over side-band
+// if the client asked for it
+func sendPackfile(
+	out *PacketWriter,
+	s storer.EncodedObjectStorer,
+	objects []plumbing.Hash,
+	capabilities Capabilities,
+) error {
+	sideBand64k := capabilities.Has("side-band-64k")
+	sideBand := sideBand64k || capabilities.Has("side-band")
+	useRefDeltas := !capabilities.Has("ofs-delta")
+
+	if !sideBand {
+		return pack.Encode(out.writer, s, objects, useRefDeltas)
+	}
+
+	var progress io.Writer = ioutil.Discard
+	if !capabilities.Has("no-progress") {
+		progress = NewSideBandWriter(out, ProgressBand, sideBand64k)
+	}
+
+	fmt.Fprintf(progress, "Enumerating objects: %d, done.\n", len(objects))
+
+	err := pack.Encode(
+		NewSideBandWriter(out, PackBand, sideBand64k), s, objects, useRefDeltas)
+	if err != nil {
+		errorBand := NewSideBandWriter(out, ErrorBand, sideBand64k)
+		fmt.Fprintf(errorBand, "upload-pack: %s\n", err)
+		return err
+	}
+
+	return out.Flush()
+}
+
+var errInvalidHash = errors.New("invalid object name")
+
+func parseHash(hex string) (plumbing.Hash, error) {
+	if len(hex) != 40 {
+		return plumbing.ZeroHash, errInvalidHash
+	}
+
+	hash := plumbing.NewHash(hex)
+	if hash.String() != strings.ToLower(hex) {
+		return plumbing.ZeroHash, errInvalidHash
+	}
+
+	return hash, nil
+}
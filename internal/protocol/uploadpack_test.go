@@ -0,0 +1,93 @@
+package protocol_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// storeIncompressible stores a master branch whose commit holds a blob of
+// random bytes, which is packed in chunks as large as a side-band allows
+func storeIncompressible(t *testing.T) (storage *memory.Storage, commit plumbing.Hash, blob plumbing.Hash) {
+	storage = memory.NewStorage()
+
+	content := make([]byte, 100*1024)
+	_, err := rand.Read(content)
+	assert.NoError(t, err)
+
+	blob = testutil.StoreBlob(t, storage, string(content))
+	tree := testutil.StoreObject(t, storage, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "random.bin", Mode: filemode.Regular, Hash: blob},
+	}})
+	signature := object.Signature{Name: "Jane Doe", Email: "jane@example.com"}
+	commit = testutil.StoreObject(t, storage, &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   "Add random bytes",
+		TreeHash:  tree,
+	})
+	assert.NoError(t, storage.SetReference(
+		plumbing.NewHashReference("refs/heads/master", commit)))
+
+	return storage, commit, blob
+}
+
+// unpack stores the objects of the packfile sent on the pack band of a
+// response
+func unpack(t *testing.T, response io.Reader) *memory.Storage {
+	var data bytes.Buffer
+	packets := protocol.NewPacketReader(response)
+	for {
+		packet, err := packets.Read()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+
+		if packet.Type != protocol.DataPacket || len(packet.Payload) == 0 {
+			continue
+		}
+		switch protocol.Band(packet.Payload[0]) {
+		case protocol.PackBand:
+			data.Write(packet.Payload[1:])
+		case protocol.ErrorBand:
+			t.Errorf("error band: %s", packet.Payload[1:])
+		}
+	}
+
+	storage := memory.NewStorage()
+	assert.NoError(t, packfile.UpdateObjectStorage(storage, &data))
+
+	return storage
+}
+
+func TestServeSendsLargeObjectsOverSideBand64k(t *testing.T) {
+	assert := assert.New(t)
+
+	storage, commit, blob := storeIncompressible(t)
+
+	request := new(bytes.Buffer)
+	packets := protocol.NewPacketWriter(request)
+	assert.NoError(packets.WriteLine("want %s side-band-64k no-progress", commit))
+	assert.NoError(packets.Flush())
+	assert.NoError(packets.WriteLine("done"))
+
+	uploadPack := &protocol.UploadPack{Storer: storage, StatelessRPC: true}
+	response := new(bytes.Buffer)
+	assert.NoError(uploadPack.Serve(request, response))
+
+	_, err := unpack(t, response).EncodedObject(plumbing.BlobObject, blob)
+	assert.NoError(err)
+}
@@ -0,0 +1,287 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/pack"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// RequestedVersion returns the protocol version a client asked for in its
+// Git-Protocol header or GIT_PROTOCOL environment variable
+func RequestedVersion(parameters string) int {
+	for _, parameter := range strings.Split(parameters, ":") {
+		if parameter == "version=2" {
+			return 2
+		}
+	}
+
+	return 0
+}
+
+// v2Command is a single protocol v2 request
+type v2Command struct {
+	name         string
+	capabilities Capabilities
+	arguments    []string
+}
+
+// readV2Command reads a command, its capabilities and its arguments. A nil
+// command means the client ended the session.
+func readV2Command(packets *PacketReader) (*v2Command, error) {
+	command := &v2Command{capabilities: make(Capabilities)}
+	inArguments := false
+
+	for {
+		packet, err := packets.Read()
+		if err == io.EOF && command.name == "" && !inArguments {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch packet.Type {
+		case FlushPacket:
+			if command.name == "" && !inArguments {
+				return nil, nil
+			}
+			return command, nil
+		case DelimPacket:
+			inArguments = true
+			continue
+		}
+
+		line := packet.Line()
+		switch {
+		case inArguments:
+			command.arguments = append(command.arguments, line)
+		case strings.HasPrefix(line, "command="):
+			command.name = strings.TrimPrefix(line, "command=")
+		default:
+			for name, value := range ParseCapabilities(line) {
+				command.capabilities[name] = value
+			}
+		}
+	}
+}
+
+// AdvertiseCapabilities writes the protocol v2 capability advertisement
+func (u *UploadPack) AdvertiseCapabilities(writer io.Writer) error {
+	packets := NewPacketWriter(writer)
+
+	lines := []string{
+		"version 2",
+		"agent=" + Agent,
+		"ls-refs",
+		"fetch=shallow filter",
+		"server-option",
+		"object-format=sha1",
+	}
+	for _, line := range lines {
+		if err := packets.WriteLine("%s", line); err != nil {
+			return err
+		}
+	}
+
+	return packets.Flush()
+}
+
+// ServeCommands serves protocol v2 commands until the client ends the
+// session, or a single command when the transport is stateless
+func (u *UploadPack) ServeCommands(reader io.Reader, writer io.Writer) error {
+	packets := NewPacketReader(reader)
+	out := NewPacketWriter(writer)
+
+	for {
+		command, err := readV2Command(packets)
+		if err != nil || command == nil {
+			return err
+		}
+
+		switch command.name {
+		case "ls-refs":
+			err = u.listReferences(out, command.arguments)
+		case "fetch":
+			err = u.fetch(out, command.arguments)
+		default:
+			_ = out.WriteError("unknown command %q", command.name)
+			err = fmt.Errorf("unknown command %q", command.name)
+		}
+		if err != nil || u.StatelessRPC {
+			return err
+		}
+	}
+}
+
+// listReferences implements ls-refs
+func (u *UploadPack) listReferences(out *PacketWriter, arguments []string) error {
+	symrefs, peeled := false, false
+	var prefixes []string
+	for _, argument := range arguments {
+		switch {
+		case argument == "symrefs":
+			symrefs = true
+		case argument == "peel":
+			peeled = true
+		case strings.HasPrefix(argument, "ref-prefix "):
+			prefixes = append(prefixes, strings.TrimPrefix(argument, "ref-prefix "))
+		}
+	}
+
+	references, head, err := listMatchingReferences(u.Storer, prefixes)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range references {
+		line := fmt.Sprintf("%s %s", ref.hash, ref.name)
+		if symrefs {
+			if target := u.symbolicTarget(ref.name, head); target != "" {
+				line += " symref-target:" + target.String()
+			}
+		}
+		if peeled && !ref.peeled.IsZero() {
+			line += " peeled:" + ref.peeled.String()
+		}
+
+		if err := out.WriteLine("%s", line); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
+
+func (u *UploadPack) symbolicTarget(
+	name plumbing.ReferenceName,
+	head *plumbing.Reference,
+) plumbing.ReferenceName {
+	ref := head
+	if name != plumbing.HEAD {
+		var err error
+		if ref, err = u.Storer.Reference(name); err != nil {
+			return ""
+		}
+	}
+
+	if ref == nil || ref.Type() != plumbing.SymbolicReference {
+		return ""
+	}
+
+	return ref.Target()
+}
+
+// fetch implements the fetch command. Until the client is done, it only
+// acknowledges the haves that are common. Once it is, it sends the packfile.
+func (u *UploadPack) fetch(out *PacketWriter, arguments []string) error {
+	request := &uploadRequest{
+		capabilities: Capabilities{"side-band-64k": ""},
+	}
+
+	done := false
+	var haves []plumbing.Hash
+	for _, argument := range arguments {
+		switch {
+		case strings.HasPrefix(argument, "want "):
+			hash, err := parseHash(strings.TrimPrefix(argument, "want "))
+			if err != nil {
+				return err
+			}
+			request.wants = append(request.wants, hash)
+		case strings.HasPrefix(argument, "have "):
+			hash, err := parseHash(strings.TrimPrefix(argument, "have "))
+			if err != nil {
+				return err
+			}
+			haves = append(haves, hash)
+		case strings.HasPrefix(argument, "filter "):
+			filter, err := pack.ParseFilter(strings.TrimPrefix(argument, "filter "))
+			if err != nil {
+				_ = out.WriteError("upload-pack: %s", err)
+				return err
+			}
+			request.filter = filter
+		case argument == "done":
+			done = true
+		case argument == "thin-pack", argument == "no-progress",
+			argument == "include-tag", argument == "ofs-delta":
+			request.capabilities[argument] = ""
+		default:
+			ok, err := request.parseShallowLine(u.Storer, argument)
+			if err == nil && !ok {
+				err = fmt.Errorf("unexpected fetch argument %q", argument)
+			}
+			if err != nil {
+				_ = out.WriteError("upload-pack: %s", err)
+				return err
+			}
+		}
+	}
+
+	if err := u.validateWants(out, request.wants); err != nil {
+		return err
+	}
+
+	for _, have := range haves {
+		_, err := u.Storer.EncodedObject(plumbing.AnyObject, have)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		request.common = append(request.common, have)
+	}
+
+	if !done {
+		return u.acknowledge(out, request.common)
+	}
+
+	if err := request.compute(u.Storer, request.wants); err != nil {
+		_ = out.WriteError("upload-pack: %s", err)
+		return err
+	}
+
+	if request.deepen != nil {
+		if err := out.WriteLine("shallow-info"); err != nil {
+			return err
+		}
+		if err := request.writeShallowLines(out); err != nil {
+			return err
+		}
+		if err := out.Delim(); err != nil {
+			return err
+		}
+	}
+
+	if err := out.WriteLine("packfile"); err != nil {
+		return err
+	}
+
+	return u.sendPack(out, request)
+}
+
+// acknowledge writes the acknowledgments section that ends a negotiation round
+func (u *UploadPack) acknowledge(out *PacketWriter, common []plumbing.Hash) error {
+	if err := out.WriteLine("acknowledgments"); err != nil {
+		return err
+	}
+
+	if len(common) == 0 {
+		if err := out.WriteLine("NAK"); err != nil {
+			return err
+		}
+	}
+
+	for _, hash := range common {
+		if err := out.WriteLine("ACK %s", hash); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,204 @@
+package protocol_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestRequestedVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(2, protocol.RequestedVersion("version=2"))
+	assert.Equal(2, protocol.RequestedVersion("object-format=sha1:version=2"))
+	assert.Equal(0, protocol.RequestedVersion("version=1"))
+	assert.Equal(0, protocol.RequestedVersion(""))
+}
+
+func TestListReferencesFiltersByPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	const master = "be50985852e7aadc4392fb4809f3f9e265a92694"
+	const branch = "a7170f7640bb9b9960fe8a20b4454f71f98c423d"
+
+	storage := memory.NewStorage()
+	assert.NoError(storage.SetReference(
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master")))
+	assert.NoError(storage.SetReference(
+		plumbing.NewHashReference("refs/heads/master", plumbing.NewHash(master))))
+	assert.NoError(storage.SetReference(
+		plumbing.NewHashReference("refs/heads/branch", plumbing.NewHash(branch))))
+	assert.NoError(storage.SetReference(
+		plumbing.NewHashReference("refs/tags/v1.0.0", plumbing.NewHash(branch))))
+
+	request := new(bytes.Buffer)
+	packets := protocol.NewPacketWriter(request)
+	assert.NoError(packets.WriteLine("command=ls-refs"))
+	assert.NoError(packets.Delim())
+	assert.NoError(packets.WriteLine("symrefs"))
+	assert.NoError(packets.WriteLine("ref-prefix HEAD"))
+	assert.NoError(packets.WriteLine("ref-prefix refs/heads/"))
+	assert.NoError(packets.Flush())
+
+	uploadPack := &protocol.UploadPack{Storer: storage, StatelessRPC: true}
+	response := new(bytes.Buffer)
+	assert.NoError(uploadPack.ServeCommands(request, response))
+
+	var lines []string
+	reader := protocol.NewPacketReader(response)
+	for {
+		packet, err := reader.Read()
+		assert.NoError(err)
+		if packet.Type == protocol.FlushPacket {
+			break
+		}
+
+		lines = append(lines, packet.Line())
+	}
+
+	assert.Equal([]string{
+		master + " HEAD symref-target:refs/heads/master",
+		branch + " refs/heads/branch",
+		master + " refs/heads/master",
+	}, lines)
+}
+
+func fetch(t *testing.T, storage *memory.Storage, arguments ...string) (string, error) {
+	request := new(bytes.Buffer)
+	packets := protocol.NewPacketWriter(request)
+	assert.NoError(t, packets.WriteLine("command=fetch"))
+	assert.NoError(t, packets.Delim())
+	for _, argument := range arguments {
+		assert.NoError(t, packets.WriteLine("%s", argument))
+	}
+	assert.NoError(t, packets.Flush())
+
+	uploadPack := &protocol.UploadPack{Storer: storage, StatelessRPC: true}
+	response := new(bytes.Buffer)
+	err := uploadPack.ServeCommands(request, response)
+
+	return response.String(), err
+}
+
+func TestFetchDeepensRelativeToClientShallowCommits(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	first := testutil.StoreCommit(t, storage, "first")
+	second := testutil.StoreCommit(t, storage, "second", first)
+	third := testutil.StoreCommit(t, storage, "third", second)
+	assert.NoError(storage.SetReference(
+		plumbing.NewHashReference("refs/heads/master", third)))
+
+	response, err := fetch(t, storage,
+		"want "+third.String(),
+		"have "+third.String(),
+		"shallow "+third.String(),
+		"deepen 1",
+		"deepen-relative",
+		"no-progress",
+		"done")
+	assert.NoError(err)
+	assert.Contains(response, "shallow "+second.String())
+	assert.Contains(response, "unshallow "+third.String())
+	assert.NotContains(response, "shallow "+first.String())
+}
+
+func TestFetchRejectsUnknownArguments(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	commit := testutil.StoreCommit(t, storage, "commit")
+	assert.NoError(storage.SetReference(
+		plumbing.NewHashReference("refs/heads/master", commit)))
+
+	response, err := fetch(t, storage, "want "+commit.String(), "frobnicate", "done")
+	assert.Error(err)
+	assert.Contains(response, `ERR upload-pack: unexpected fetch argument "frobnicate"`)
+}
+
+func TestFetchRejectsUnreachableWants(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := memory.NewStorage()
+	first := testutil.StoreCommit(t, storage, "first")
+	second := testutil.StoreCommit(t, storage, "second", first)
+	dangling := testutil.StoreCommit(t, storage, "dangling", first)
+	assert.NoError(storage.SetReference(
+		plumbing.NewHashReference("refs/heads/master", second)))
+
+	_, err := fetch(t, storage, "want "+first.String(), "no-progress", "done")
+	assert.NoError(err)
+
+	response, err := fetch(t, storage, "want "+dangling.String(), "no-progress", "done")
+	assert.Error(err)
+	assert.Contains(response, "ERR upload-pack: not our ref "+dangling.String())
+}
+
+func TestFetchSendsLargeObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	storage, commit, blob := storeIncompressible(t)
+
+	response, err := fetch(t, storage, "want "+commit.String(), "no-progress", "done")
+	assert.NoError(err)
+
+	_, err = unpack(t, strings.NewReader(response)).EncodedObject(plumbing.BlobObject, blob)
+	assert.NoError(err)
+}
+
+// readCounter records the objects that are read from a storage
+type readCounter struct {
+	*memory.Storage
+	reads map[plumbing.Hash]int
+}
+
+func (counter *readCounter) EncodedObject(
+	kind plumbing.ObjectType,
+	hash plumbing.Hash,
+) (plumbing.EncodedObject, error) {
+	counter.reads[hash]++
+
+	return counter.Storage.EncodedObject(kind, hash)
+}
+
+func TestListReferencesOnlyResolvesMatchingReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	storage := &readCounter{Storage: memory.NewStorage(), reads: make(map[plumbing.Hash]int)}
+	commit := testutil.StoreCommit(t, storage.Storage, "commit")
+	tag := testutil.StoreObject(t, storage.Storage, &object.Tag{
+		Name:       "v1.0.0",
+		Tagger:     object.Signature{Name: "Jane Doe", Email: "jane@example.com"},
+		Message:    "Release",
+		TargetType: plumbing.CommitObject,
+		Target:     commit,
+	})
+	assert.NoError(storage.SetReference(
+		plumbing.NewHashReference("refs/heads/master", commit)))
+	assert.NoError(storage.SetReference(
+		plumbing.NewHashReference("refs/tags/v1.0.0", tag)))
+
+	request := new(bytes.Buffer)
+	packets := protocol.NewPacketWriter(request)
+	assert.NoError(packets.WriteLine("command=ls-refs"))
+	assert.NoError(packets.Delim())
+	assert.NoError(packets.WriteLine("peel"))
+	assert.NoError(packets.WriteLine("ref-prefix refs/heads/"))
+	assert.NoError(packets.Flush())
+
+	uploadPack := &protocol.UploadPack{Storer: storage, StatelessRPC: true}
+	response := new(bytes.Buffer)
+	assert.NoError(uploadPack.ServeCommands(request, response))
+
+	assert.Contains(response.String(), commit.String()+" refs/heads/master")
+	assert.NotContains(response.String(), "refs/tags/v1.0.0")
+	assert.Zero(storage.reads[tag])
+}
@@ -0,0 +1,239 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+)
+
+// List of registered repository names
+// swagger:response GetEntriesOkResponse
+type GetEntriesOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Registration `json:"data,omitempty"`
+	}
+}
+
+// The registered repository name
+// swagger:response EntryOkResponse
+type EntryOkResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Registration `json:"data,omitempty"`
+	}
+}
+
+// The name was unregistered
+// swagger:response DeleteEntryNoContentResponse
+type DeleteEntryNoContentResponse struct{}
+
+// swagger:parameters createEntry
+type CreateEntryParams struct {
+	// in: body
+	// required: true
+	Body CreateEntryRequest
+}
+
+type CreateEntryRequest struct {
+	// The name clients refer to the repository by
+	//
+	// required: true
+	// example: team/project
+	Name string `json:"name"`
+
+	// Where the repository is stored on the server
+	//
+	// required: true
+	// example: /srv/git/team/project
+	Location string `json:"location"`
+}
+
+// swagger:parameters updateEntry
+type UpdateEntryParams struct {
+	// in: body
+	// required: true
+	Body UpdateEntryRequest
+}
+
+type UpdateEntryRequest struct {
+	// Where the repository is now stored on the server
+	//
+	// required: true
+	// example: /srv/git/archive/project
+	Location string `json:"location"`
+}
+
+// swagger:parameters getEntry updateEntry deleteEntry
+type EntryParams struct {
+	// The registered name. Its segments are separated by '/', or by '|'.
+	//
+	// in: path
+	// required: true
+	Name string `json:"name"`
+}
+
+func writeEntry(writer http.ResponseWriter, statusCode int, entry Entry) {
+	dataPayload := response.Payload{
+		Data: []interface{}{entry.Registration()},
+	}
+
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+		panic(err)
+	}
+}
+
+// pathName decodes the name in the request path, whose segments may be
+// separated by '|' instead of '/'
+func pathName(request *http.Request) string {
+	return strings.ReplaceAll(mux.Vars(request)["name"], "|", "/")
+}
+
+// checkLocation makes sure a repository can be opened at location. It
+// reports whether it can.
+func checkLocation(writer http.ResponseWriter, reader git.Reader, location string) bool {
+	if location == "" {
+		response.WriteError(writer, http.StatusBadRequest, errors.New("a location is required"))
+		return false
+	}
+
+	_, err := reader.Open(location)
+	if err == git.ErrOutsideRoot {
+		response.WriteError(writer, http.StatusForbidden, err)
+		return false
+	}
+	if err != nil {
+		response.WriteError(writer, http.StatusBadRequest, err)
+		return false
+	}
+
+	return true
+}
+
+// NewGetEntriesHandler lists the registered names
+func NewGetEntriesHandler(store *Store) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		entries := store.List()
+
+		data := make([]interface{}, len(entries))
+		for i := range entries {
+			data[i] = entries[i].Registration()
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewGetEntryHandler returns a registered name
+func NewGetEntryHandler(store *Store) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		entry, ok := store.Find(pathName(request))
+		if !ok {
+			response.WriteError(writer, http.StatusNotFound, ErrNameNotFound)
+			return
+		}
+
+		writeEntry(writer, http.StatusOK, entry)
+	}
+}
+
+// NewCreateEntryHandler registers a name for a repository. The reader must
+// not resolve names itself, so that names cannot point to other names.
+func NewCreateEntryHandler(store *Store, reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body CreateEntryRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		if !ValidName(body.Name) {
+			response.WriteError(writer, http.StatusBadRequest, ErrInvalidName)
+			return
+		}
+		if !checkLocation(writer, reader, body.Location) {
+			return
+		}
+
+		entry, err := store.Add(body.Name, body.Location)
+		if err == ErrNameExists {
+			response.WriteError(writer, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeEntry(writer, http.StatusCreated, entry)
+	}
+}
+
+// NewUpdateEntryHandler points a registered name at the new location of its
+// repository
+func NewUpdateEntryHandler(store *Store, reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body UpdateEntryRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		name := pathName(request)
+		if _, ok := store.Find(name); !ok {
+			response.WriteError(writer, http.StatusNotFound, ErrNameNotFound)
+			return
+		}
+		if !checkLocation(writer, reader, body.Location) {
+			return
+		}
+
+		entry, err := store.Move(name, body.Location)
+		if err == ErrNameNotFound {
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeEntry(writer, http.StatusOK, entry)
+	}
+}
+
+// NewDeleteEntryHandler unregisters a name
+func NewDeleteEntryHandler(store *Store) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		err := store.Remove(pathName(request))
+		if err == ErrNameNotFound {
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,46 @@
+package registry
+
+// Entry is a registered name along with where its repository is stored
+type Entry struct {
+	// The name clients refer to the repository by
+	//
+	// required: true
+	// example: team/project
+	Name string `json:"name,omitempty"`
+
+	// Where the repository is stored on the server
+	//
+	// required: true
+	// example: /srv/git/team/project
+	Location string `json:"location,omitempty"`
+
+	// When the name was registered
+	//
+	// required: true
+	// example: 2019-05-26T12:41:18-04:00
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// Registration is a registered name as clients see it. Where the repository
+// is stored on the server is left out.
+type Registration struct {
+	// The name clients refer to the repository by
+	//
+	// required: true
+	// example: team/project
+	Name string `json:"name,omitempty"`
+
+	// When the name was registered
+	//
+	// required: true
+	// example: 2019-05-26T12:41:18-04:00
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// Registration returns the entry as clients see it
+func (entry Entry) Registration() Registration {
+	return Registration{
+		Name:      entry.Name,
+		CreatedAt: entry.CreatedAt,
+	}
+}
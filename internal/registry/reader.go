@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+)
+
+// Reader opens repositories by their registered name, falling back to
+// treating the name as a path when it is not registered
+type Reader struct {
+	store  *Store
+	reader git.Reader
+}
+
+// NewReader creates a reader that resolves names before opening repositories
+// with reader
+func NewReader(store *Store, reader git.Reader) *Reader {
+	return &Reader{store: store, reader: reader}
+}
+
+// Resolve returns the location of the repository registered by name, or the
+// name itself if it is not registered. A leading slash, as in SSH URLs, is
+// ignored when looking up names.
+func (reader *Reader) Resolve(name string) string {
+	if entry, ok := reader.store.Find(strings.TrimPrefix(name, "/")); ok {
+		return entry.Location
+	}
+
+	return name
+}
+
+// Open opens the repository registered by name
+func (reader *Reader) Open(name string) (git.Repository, error) {
+	return reader.reader.Open(reader.Resolve(name))
+}
+
+// Locate returns the path of the repository registered by name, when the
+// underlying reader can locate repositories
+func (reader *Reader) Locate(name string) (string, error) {
+	locator, ok := reader.reader.(git.Locator)
+	if !ok {
+		return "", errors.New("repositories cannot be located")
+	}
+
+	return locator.Locate(reader.Resolve(name))
+}
@@ -0,0 +1,189 @@
+// Package registry maps stable repository names, such as team/project, to
+// the locations the repositories are stored at
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+
+var (
+	// ErrNameNotFound is returned when no repository is registered by a name
+	ErrNameNotFound = errors.New("name is not registered")
+	// ErrNameExists is returned when a name is registered twice
+	ErrNameExists = errors.New("name is already registered")
+	// ErrInvalidName is returned for names that are not slash separated
+	// slugs
+	ErrInvalidName = errors.New("names must be slash separated segments of letters, digits, '.', '_' and '-'")
+)
+
+// ValidName reports whether a name can be registered
+func ValidName(name string) bool {
+	if !nameRegex.MatchString(name) {
+		return false
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Store holds the registered names, persisting them to a JSON file
+type Store struct {
+	path    string
+	mutex   sync.RWMutex
+	entries []Entry
+}
+
+// NewStore loads the names registered at path. An empty path keeps the names
+// in memory only.
+func NewStore(path string) (*Store, error) {
+	store := &Store{path: path}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.entries); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// List returns every registered name, sorted
+func (store *Store) List() []Entry {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	entries := make([]Entry, len(store.entries))
+	copy(entries, store.entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries
+}
+
+// Find returns the entry registered by a name
+func (store *Store) Find(name string) (Entry, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, entry := range store.entries {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+
+	return Entry{}, false
+}
+
+// Add registers a name for the repository at location
+func (store *Store) Add(name string, location string) (Entry, error) {
+	if !ValidName(name) {
+		return Entry{}, ErrInvalidName
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, entry := range store.entries {
+		if entry.Name == name {
+			return Entry{}, ErrNameExists
+		}
+	}
+
+	entry := Entry{
+		Name:      name,
+		Location:  location,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	previous := store.entries
+	store.entries = append(append([]Entry{}, store.entries...), entry)
+	if err := store.save(); err != nil {
+		store.entries = previous
+		return Entry{}, err
+	}
+
+	return entry, nil
+}
+
+// Move points a name at a new location
+func (store *Store) Move(name string, location string) (Entry, error) {
+	return store.update(name, func(entries []Entry, i int) []Entry {
+		entries[i].Location = location
+		return entries
+	})
+}
+
+// Remove unregisters a name. The repository itself is left untouched.
+func (store *Store) Remove(name string) error {
+	_, err := store.update(name, func(entries []Entry, i int) []Entry {
+		return append(entries[:i], entries[i+1:]...)
+	})
+
+	return err
+}
+
+// update applies a change to a copy of the entries and saves it
+func (store *Store) update(name string, change func([]Entry, int) []Entry) (Entry, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i, entry := range store.entries {
+		if entry.Name != name {
+			continue
+		}
+
+		entries := change(append([]Entry{}, store.entries...), i)
+		if i < len(entries) && entries[i].Name == name {
+			entry = entries[i]
+		}
+
+		previous := store.entries
+		store.entries = entries
+		if err := store.save(); err != nil {
+			store.entries = previous
+			return Entry{}, err
+		}
+
+		return entry, nil
+	}
+
+	return Entry{}, ErrNameNotFound
+}
+
+func (store *Store) save() error {
+	if store.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(store.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(store.path, data, 0600)
+}
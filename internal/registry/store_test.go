@@ -0,0 +1,94 @@
+package registry_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/mock"
+	"github.com/drdgvhbh/gitserver/internal/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(registry.ValidName("project"))
+	assert.True(registry.ValidName("team/project.git"))
+	assert.False(registry.ValidName(""))
+	assert.False(registry.ValidName("/srv/git/project"))
+	assert.False(registry.ValidName("team/../project"))
+	assert.False(registry.ValidName("team//project"))
+	assert.False(registry.ValidName("team|project"))
+}
+
+func TestStoreRegistersAndMovesNames(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := registry.NewStore("")
+	assert.NoError(err)
+
+	entry, err := store.Add("team/project", "/srv/git/project")
+	assert.NoError(err)
+	assert.Equal("team/project", entry.Name)
+
+	_, err = store.Add("team/project", "/srv/git/other")
+	assert.Equal(registry.ErrNameExists, err)
+
+	moved, err := store.Move("team/project", "/srv/git/moved")
+	assert.NoError(err)
+	assert.Equal("/srv/git/moved", moved.Location)
+
+	found, ok := store.Find("team/project")
+	assert.True(ok)
+	assert.Equal("/srv/git/moved", found.Location)
+
+	assert.NoError(store.Remove("team/project"))
+	assert.Equal(registry.ErrNameNotFound, store.Remove("team/project"))
+	assert.Empty(store.List())
+}
+
+func TestStorePersistsNames(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, err := ioutil.TempDir("", "gitserver-registry")
+	assert.NoError(err)
+	defer os.RemoveAll(directory)
+
+	registryPath := path.Join(directory, "registry.json")
+	store, err := registry.NewStore(registryPath)
+	assert.NoError(err)
+
+	_, err = store.Add("team/project", "/srv/git/project")
+	assert.NoError(err)
+
+	reloaded, err := registry.NewStore(registryPath)
+	assert.NoError(err)
+	assert.Equal(store.List(), reloaded.List())
+}
+
+func TestReaderOpensRepositoriesByName(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := registry.NewStore("")
+	assert.NoError(err)
+	_, err = store.Add("team/project", "/srv/git/project")
+	assert.NoError(err)
+
+	pathReader := new(mock.Reader)
+	pathReader.On("Open", "/srv/git/project").Return(nil, nil)
+	pathReader.On("Open", "/srv/git/other").Return(nil, nil)
+
+	reader := registry.NewReader(store, pathReader)
+
+	_, err = reader.Open("team/project")
+	assert.NoError(err)
+	_, err = reader.Open("/team/project")
+	assert.NoError(err)
+	_, err = reader.Open("/srv/git/other")
+	assert.NoError(err)
+
+	pathReader.AssertNumberOfCalls(t, "Open", 3)
+	pathReader.AssertCalled(t, "Open", "/srv/git/project")
+}
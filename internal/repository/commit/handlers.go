@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/repository/reference"
 	"github.com/drdgvhbh/gitserver/internal/response"
 	"github.com/gorilla/mux"
 )
@@ -68,28 +69,7 @@ func NewGetCommitsHandler(reader git.Reader) func(http.ResponseWriter, *http.Req
 
 			defer commitHistory.Close()
 			err = commitHistory.ForEach(func(commit git.Commit) error {
-				author := commit.Author()
-				committer := commit.Committer()
-				commitRefs := references[commit.Hash()]
-				if commitRefs == nil {
-					commitRefs = make([]string, 0)
-				}
-
-				commitData = append(commitData, Commit{
-					Hash:    commit.Hash(),
-					Summary: commit.Summary(),
-					Author: &Contributor{
-						Name:      author.Name(),
-						Email:     author.Email(),
-						Timestamp: author.Timestamp().Format(time.RFC3339),
-					},
-					Committer: &Contributor{
-						Name:      committer.Name(),
-						Email:     committer.Email(),
-						Timestamp: committer.Timestamp().Format(time.RFC3339),
-					},
-					References: commitRefs,
-				})
+				commitData = append(commitData, New(commit, references[commit.Hash()]))
 				return nil
 			})
 			if err != nil {
@@ -129,3 +109,68 @@ func NewGetCommitsHandler(reader git.Reader) func(http.ResponseWriter, *http.Req
 		}
 	}
 }
+
+// List of branches and tags containing a commit
+// swagger:response GetContainingReferencesOkResponse
+type GetContainingReferencesOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The request method
+		//
+		// required: true
+		// example: repositories.%7Chome%7Cdrd%7Cgo%7Csrc%7Cgithub.com%7Cdrdgvhbh%7Cgitserver.commits.be50985852e7aadc4392fb4809f3f9e265a92694.containing.get
+		Method string `json:"method,omitempty"`
+		// The response data
+		//
+		// required: true
+		Data []reference.Reference `json:"data,omitempty"`
+	}
+}
+
+// NewGetContainingReferencesHandler returns the branches and tags whose history
+// includes the specified commit
+func NewGetContainingReferencesHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repositoryPath := vars["directory"]
+		repository, _ := reader.Open(repositoryPath)
+
+		err := (func() error {
+			references, err := repository.ReferencesContaining(git.NewHash(vars["hash"]))
+			if err != nil {
+				return err
+			}
+
+			data := make([]interface{}, len(references))
+			for i, ref := range references {
+				data[i] = reference.Reference{
+					Hash: ref.Hash().String(),
+					Name: string(ref.Name()),
+				}
+			}
+
+			dataPayload := response.Payload{
+				Data: data,
+			}
+
+			return json.NewEncoder(writer).Encode(&dataPayload)
+		})()
+
+		if err != nil {
+			if err == git.ErrObjectNotFound {
+				writer.WriteHeader(http.StatusNotFound)
+			}
+
+			errorPayload := response.Payload{
+				Errors: map[string]interface{}{
+					"error": err.Error(),
+				},
+			}
+			err = json.NewEncoder(writer).Encode(&errorPayload)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
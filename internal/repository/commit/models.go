@@ -1,5 +1,11 @@
 package commit
 
+import (
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+)
+
 type Contributor struct {
 	// Contributor's Name
 	//
@@ -45,3 +51,37 @@ type Commit struct {
 	// required: true
 	References []string `json:"references"`
 }
+
+// New summarizes a commit along with the references pointing to it
+func New(commit git.Commit, references []string) Commit {
+	author := commit.Author()
+	committer := commit.Committer()
+	if references == nil {
+		references = make([]string, 0)
+	}
+
+	return Commit{
+		Hash:    commit.Hash(),
+		Summary: commit.Summary(),
+		Author: &Contributor{
+			Name:      author.Name(),
+			Email:     author.Email(),
+			Timestamp: author.Timestamp().Format(time.RFC3339),
+		},
+		Committer: &Contributor{
+			Name:      committer.Name(),
+			Email:     committer.Email(),
+			Timestamp: committer.Timestamp().Format(time.RFC3339),
+		},
+		References: references,
+	}
+}
+
+// swagger:parameters listContainingReferences
+type HashParams struct {
+	// The hash of the commit
+	//
+	// in: path
+	// required: true
+	Hash string `json:"hash"`
+}
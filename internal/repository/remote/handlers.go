@@ -0,0 +1,344 @@
+package remote
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/drdgvhbh/gitserver/internal/credential"
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/mirror"
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+	gogit "gopkg.in/src-d/go-git.v4"
+)
+
+// List of remotes of the repository
+// swagger:response GetRemotesOkResponse
+type GetRemotesOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Remote `json:"data,omitempty"`
+	}
+}
+
+// The created remote
+// swagger:response CreateRemoteCreatedResponse
+type CreateRemoteCreatedResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Remote `json:"data,omitempty"`
+	}
+}
+
+// The remote and its remote-tracking references were removed
+// swagger:response DeleteRemoteNoContentResponse
+type DeleteRemoteNoContentResponse struct{}
+
+// The references the fetch changed
+// swagger:response FetchRemoteOkResponse
+type FetchRemoteOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []event.Change `json:"data,omitempty"`
+	}
+}
+
+// The outcome of the push for each remote reference
+// swagger:response PushRemoteOkResponse
+type PushRemoteOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []PushResult `json:"data,omitempty"`
+	}
+}
+
+// swagger:parameters deleteRemote fetchRemote pushRemote
+type RemoteParams struct {
+	// The name of the remote
+	//
+	// in: path
+	// required: true
+	Name string `json:"name"`
+}
+
+// swagger:parameters createRemote
+type CreateRemoteParams struct {
+	// in: body
+	// required: true
+	Body CreateRemoteRequest
+}
+
+type CreateRemoteRequest struct {
+	// The name of the remote
+	//
+	// required: true
+	// example: origin
+	Name string `json:"name"`
+
+	// The URLs of the remote. Paths on the server must lie within the
+	// repository roots.
+	//
+	// required: true
+	// example: ["https://github.com/drdgvhbh/gitserver.git"]
+	URLs []string `json:"urls"`
+
+	// The refspecs the remote is fetched with. Every branch is fetched to
+	// refs/remotes/<name>/ by default.
+	//
+	// example: ["+refs/heads/*:refs/remotes/origin/*"]
+	Fetch []string `json:"fetch"`
+}
+
+// swagger:parameters fetchRemote
+type FetchRemoteParams struct {
+	// in: body
+	Body FetchRemoteRequest
+}
+
+type FetchRemoteRequest struct {
+	// The refspecs to fetch with instead of those of the remote
+	//
+	// example: ["+refs/heads/master:refs/remotes/origin/master"]
+	RefSpecs []string `json:"refspecs"`
+
+	// Whether to remove the remote-tracking references whose source is gone
+	// from the remote
+	//
+	// example: true
+	Prune bool `json:"prune"`
+}
+
+// swagger:parameters pushRemote
+type PushRemoteParams struct {
+	// in: body
+	Body PushRemoteRequest
+}
+
+type PushRemoteRequest struct {
+	// The refspecs to push. Short names are looked up among branches, then
+	// tags, and a leading + forces the update. The current branch is pushed
+	// when there are none.
+	//
+	// example: ["main", "+refs/heads/feature:refs/heads/feature", ":refs/heads/stale"]
+	RefSpecs []string `json:"refspecs"`
+
+	// Whether to overwrite remote references as long as they are where their
+	// remote-tracking references say, like git push --force-with-lease
+	//
+	// example: true
+	ForceWithLease bool `json:"forceWithLease"`
+
+	// The hashes remote references are expected at. They are overwritten as
+	// long as they still are. The zero hash expects the reference not to
+	// exist.
+	//
+	// example: {"refs/heads/main": "0123456789abcdef0123456789abcdef01234567"}
+	Leases map[string]string `json:"leases"`
+}
+
+// NewGetRemotesHandler lists the remotes of a repository
+func NewGetRemotesHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		repository, _ := reader.Open(mux.Vars(request)["directory"])
+
+		remotes, err := List(repository)
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := make([]interface{}, len(remotes))
+		for i := range remotes {
+			data[i] = remotes[i]
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewCreateRemoteHandler adds a remote to a repository. Remotes on the local
+// filesystem must lie within the sandbox.
+func NewCreateRemoteHandler(
+	reader git.Reader,
+	sandbox *git.Sandbox,
+) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body CreateRemoteRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		repository, _ := reader.Open(mux.Vars(request)["directory"])
+
+		created, err := Add(repository, body.Name, body.URLs, body.Fetch, sandbox)
+		switch err {
+		case nil:
+		case ErrInvalidName, ErrNoURL, ErrInvalidRefSpec, mirror.ErrUnsupportedURL, git.ErrOutsideRoot:
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		case gogit.ErrRemoteExists:
+			response.WriteError(writer, http.StatusConflict, err)
+			return
+		default:
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		dataPayload := response.Payload{
+			Data: []interface{}{created},
+		}
+		writer.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewDeleteRemoteHandler removes a remote and its remote-tracking references
+func NewDeleteRemoteHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		err := Remove(repository, vars["name"])
+		switch err {
+		case nil:
+		case gogit.ErrRemoteNotFound:
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		default:
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewFetchRemoteHandler fetches from a remote of a repository, and returns
+// the references that changed. The remote is authenticated to with the
+// stored credentials.
+func NewFetchRemoteHandler(
+	reader git.Reader,
+	credentials *credential.Store,
+) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body FetchRemoteRequest
+		if request.ContentLength != 0 {
+			if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+				response.WriteError(writer, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		changes, err := Fetch(repository, vars["name"], &FetchOptions{
+			RefSpecs:    body.RefSpecs,
+			Prune:       body.Prune,
+			Credentials: credentials,
+		})
+		switch err {
+		case nil:
+		case gogit.ErrRemoteNotFound:
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		case ErrInvalidRefSpec:
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		default:
+			// Fetches mostly fail talking to the remote
+			response.WriteError(writer, http.StatusBadGateway, err)
+			return
+		}
+
+		data := make([]interface{}, len(changes))
+		for i := range changes {
+			data[i] = changes[i]
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewPushRemoteHandler pushes references of a repository to one of its
+// remotes, and returns the outcome for each remote reference. The remote is
+// authenticated to with the stored credentials.
+func NewPushRemoteHandler(
+	reader git.Reader,
+	credentials *credential.Store,
+) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body PushRemoteRequest
+		if request.ContentLength != 0 {
+			if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+				response.WriteError(writer, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		results, err := Push(repository, vars["name"], &PushOptions{
+			RefSpecs:       body.RefSpecs,
+			ForceWithLease: body.ForceWithLease,
+			Leases:         body.Leases,
+			Credentials:    credentials,
+		})
+		switch err {
+		case nil:
+		case gogit.ErrRemoteNotFound:
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		case ErrInvalidRefSpec, ErrInvalidLease, ErrUnknownSource, ErrNothingToPush:
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		default:
+			// Pushes mostly fail talking to the remote
+			response.WriteError(writer, http.StatusBadGateway, err)
+			return
+		}
+
+		data := make([]interface{}, len(results))
+		for i := range results {
+			data[i] = results[i]
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
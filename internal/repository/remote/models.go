@@ -0,0 +1,58 @@
+package remote
+
+type Remote struct {
+	// The name of the remote
+	//
+	// required: true
+	// example: origin
+	Name string `json:"name"`
+
+	// The URLs of the remote, with their passwords redacted
+	//
+	// required: true
+	// example: ["https://github.com/drdgvhbh/gitserver.git"]
+	URLs []string `json:"urls"`
+
+	// The refspecs the remote is fetched with
+	//
+	// required: true
+	// example: ["+refs/heads/*:refs/remotes/origin/*"]
+	Fetch []string `json:"fetch"`
+}
+
+type PushResult struct {
+	// The remote reference
+	//
+	// required: true
+	// example: refs/heads/master
+	Reference string `json:"reference"`
+
+	// The local reference pushed to it, empty for deletions
+	//
+	// example: refs/heads/master
+	Source string `json:"source,omitempty"`
+
+	// The hash of the remote reference before the push, zero when it did not
+	// exist
+	//
+	// required: true
+	// example: 0123456789abcdef0123456789abcdef01234567
+	Before string `json:"before"`
+
+	// The hash pushed, zero for deletions
+	//
+	// required: true
+	// example: 89abcdef0123456789abcdef0123456789abcdef
+	After string `json:"after"`
+
+	// The outcome, one of ok, up-to-date, rejected, stale or error
+	//
+	// required: true
+	// example: ok
+	Status string `json:"status"`
+
+	// Why the reference was not updated
+	//
+	// example: non-fast-forward
+	Message string `json:"message,omitempty"`
+}
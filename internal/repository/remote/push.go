@@ -0,0 +1,356 @@
+package remote
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+var (
+	// ErrUnknownSource is returned for refspecs whose source is not a
+	// reference of the repository
+	ErrUnknownSource = errors.New("the source of a refspec does not match any reference")
+	// ErrNothingToPush is returned when pushing without refspecs while HEAD
+	// is not on a branch
+	ErrNothingToPush = errors.New("no refspecs were given and HEAD is not on a branch")
+	// ErrInvalidLease is returned for leases that are not full hashes
+	ErrInvalidLease = errors.New("leases must be full hexadecimal hashes")
+)
+
+// The status of a pushed reference
+const (
+	// PushOK means the remote reference was updated
+	PushOK = "ok"
+	// PushUpToDate means the remote reference already had the hash
+	PushUpToDate = "up-to-date"
+	// PushRejected means the update needed to be forced, because it is not a
+	// fast-forward or the remote reference is a tag
+	PushRejected = "rejected"
+	// PushStale means the remote reference was not where its lease expected
+	PushStale = "stale"
+	// PushFailed means the remote refused the update
+	PushFailed = "error"
+)
+
+// PushOptions describes what is pushed to a remote
+type PushOptions struct {
+	// RefSpecs map local references to remote ones. The current branch is
+	// pushed to the branch of the same name when there are none.
+	RefSpecs []string
+	// ForceWithLease overwrites remote references as long as they are where
+	// their remote-tracking reference says, like git push --force-with-lease
+	ForceWithLease bool
+	// Leases map remote references to the hash they are expected at. They are
+	// overwritten as long as they still are. The zero hash expects the remote
+	// reference not to exist.
+	Leases map[string]string
+	// Credentials authenticate to the remote
+	Credentials Authenticator
+}
+
+// update is a remote reference a push sets
+type update struct {
+	source      plumbing.ReferenceName
+	destination plumbing.ReferenceName
+	hash        plumbing.Hash
+	force       bool
+}
+
+// Push updates the references of a remote from those of the repository, and
+// returns the outcome for each remote reference. References that cannot be
+// fast-forwarded are rejected unless forced, or leased and still where
+// expected.
+func Push(repository git.Repository, name string, options *PushOptions) ([]PushResult, error) {
+	wrapee, err := gogit.Open(repository.Storer(), nil)
+	if err != nil {
+		return nil, err
+	}
+	pushed, err := wrapee.Remote(name)
+	if err != nil {
+		return nil, err
+	}
+
+	leases := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for reference, hash := range options.Leases {
+		if len(hash) != 40 || strings.Trim(strings.ToLower(hash), "0123456789abcdef") != "" {
+			return nil, ErrInvalidLease
+		}
+		leases[plumbing.ReferenceName(reference)] = plumbing.NewHash(hash)
+	}
+
+	refSpecs := options.RefSpecs
+	if len(refSpecs) == 0 {
+		head, err := repository.Storer().Reference(plumbing.HEAD)
+		if err != nil || head.Type() != plumbing.SymbolicReference {
+			return nil, ErrNothingToPush
+		}
+		refSpecs = []string{head.Target().String()}
+	}
+	updates, err := expand(repository.Storer(), refSpecs)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := authenticate(options.Credentials, pushed.Config())
+	references, err := pushed.List(&gogit.ListOptions{Auth: auth})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return nil, err
+	}
+	remoteHashes := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for _, reference := range references {
+		if reference.Type() == plumbing.HashReference {
+			remoteHashes[reference.Name()] = reference.Hash()
+		}
+	}
+
+	results := make([]PushResult, len(updates))
+	var accepted []int
+	var accept []config.RefSpec
+	for i, u := range updates {
+		before := remoteHashes[u.destination]
+		results[i] = PushResult{
+			Reference: u.destination.String(),
+			Source:    u.source.String(),
+			Before:    before.String(),
+			After:     u.hash.String(),
+		}
+
+		expected, leased := leases[u.destination]
+		if !leased && options.ForceWithLease {
+			expected, leased = tracking(repository.Storer(), pushed.Config().Fetch, u.destination), true
+		}
+
+		switch {
+		case before == u.hash:
+			results[i].Status = PushUpToDate
+			continue
+		case leased && before != expected:
+			results[i].Status = PushStale
+			results[i].Message = "the remote reference is at " + before.String() +
+				" instead of " + expected.String()
+			continue
+		case !leased && !u.force:
+			if message := rejection(repository.Storer(), u, before); message != "" {
+				results[i].Status = PushRejected
+				results[i].Message = message
+				continue
+			}
+		}
+
+		// Every check was made, so the update is forced to keep go-git from
+		// checking fast-forwards again. The remote still refuses it when its
+		// reference moved since it was listed.
+		accepted = append(accepted, i)
+		if u.source == "" {
+			accept = append(accept, config.RefSpec(":"+u.destination.String()))
+		} else {
+			accept = append(accept, config.RefSpec("+"+u.source.String()+":"+u.destination.String()))
+		}
+	}
+
+	if len(accept) > 0 {
+		// Pushing updates the remote-tracking references of what it pushed
+		unlock := git.LockReferences(repository.Storer())
+		status, message := PushOK, ""
+		err := pushed.Push(&gogit.PushOptions{
+			RemoteName: name,
+			RefSpecs:   accept,
+			Auth:       auth,
+		})
+		unlock()
+		if err != nil && err != gogit.NoErrAlreadyUpToDate {
+			status, message = PushFailed, err.Error()
+		}
+		for _, i := range accepted {
+			results[i].Status = status
+			results[i].Message = message
+		}
+	}
+
+	return results, nil
+}
+
+// expand turns refspecs into the updates they make, sorted by remote
+// reference. Short names are looked up among branches, then tags.
+func expand(s storage.Storer, refSpecs []string) ([]update, error) {
+	updates := make(map[plumbing.ReferenceName]update)
+	for _, refSpec := range refSpecs {
+		force := strings.HasPrefix(refSpec, "+")
+		parts := strings.SplitN(strings.TrimPrefix(refSpec, "+"), ":", 2)
+		source, destination := parts[0], parts[0]
+		if len(parts) == 2 {
+			destination = parts[1]
+		}
+
+		if source == "" {
+			if destination == "" || strings.Contains(destination, "*") {
+				return nil, ErrInvalidRefSpec
+			}
+			name := qualify(destination, "refs/heads/")
+			updates[name] = update{destination: name, force: true}
+			continue
+		}
+
+		if strings.Contains(source, "*") {
+			wildcard := config.RefSpec(source + ":" + destination)
+			if wildcard.Validate() != nil || !strings.HasPrefix(source, "refs/") ||
+				!strings.HasPrefix(destination, "refs/") {
+				return nil, ErrInvalidRefSpec
+			}
+
+			iter, err := s.IterReferences()
+			if err != nil {
+				return nil, err
+			}
+			err = iter.ForEach(func(reference *plumbing.Reference) error {
+				if reference.Type() == plumbing.HashReference && wildcard.Match(reference.Name()) {
+					name := wildcard.Dst(reference.Name())
+					updates[name] = update{
+						source:      reference.Name(),
+						destination: name,
+						hash:        reference.Hash(),
+						force:       force,
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if strings.Contains(destination, "*") {
+			return nil, ErrInvalidRefSpec
+		}
+		reference, err := resolve(s, source)
+		if err != nil {
+			return nil, err
+		}
+		namespace := "refs/heads/"
+		if strings.HasPrefix(reference.Name().String(), "refs/tags/") {
+			namespace = "refs/tags/"
+		}
+		if len(parts) == 1 {
+			destination = reference.Name().String()
+		}
+		name := qualify(destination, namespace)
+		updates[name] = update{
+			source:      reference.Name(),
+			destination: name,
+			hash:        reference.Hash(),
+			force:       force,
+		}
+	}
+
+	sorted := make([]update, 0, len(updates))
+	for _, u := range updates {
+		sorted = append(sorted, u)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].destination < sorted[j].destination
+	})
+
+	return sorted, nil
+}
+
+// qualify prefixes names that are not full reference names with namespace
+func qualify(name string, namespace string) plumbing.ReferenceName {
+	if strings.HasPrefix(name, "refs/") {
+		return plumbing.ReferenceName(name)
+	}
+
+	return plumbing.ReferenceName(namespace + name)
+}
+
+// resolve returns the hash reference name stands for, following HEAD
+func resolve(s storage.Storer, name string) (*plumbing.Reference, error) {
+	candidates := []string{name}
+	if !strings.HasPrefix(name, "refs/") && name != plumbing.HEAD.String() {
+		candidates = []string{"refs/heads/" + name, "refs/tags/" + name}
+	}
+
+	for _, candidate := range candidates {
+		reference, err := s.Reference(plumbing.ReferenceName(candidate))
+		if err == plumbing.ErrReferenceNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if reference.Type() == plumbing.SymbolicReference {
+			resolved, err := storer.ResolveReference(s, reference.Target())
+			if err != nil {
+				return nil, ErrUnknownSource
+			}
+			// HEAD is pushed as the branch it is on
+			return plumbing.NewHashReference(reference.Target(), resolved.Hash()), nil
+		}
+
+		return reference, nil
+	}
+
+	return nil, ErrUnknownSource
+}
+
+// tracking returns the hash of the remote-tracking reference of the remote
+// reference by the name, or the zero hash when there is none
+func tracking(s storer.ReferenceStorer, fetch []config.RefSpec, name plumbing.ReferenceName) plumbing.Hash {
+	for _, refSpec := range fetch {
+		if !refSpec.Match(name) {
+			continue
+		}
+
+		reference, err := s.Reference(refSpec.Dst(name))
+		if err == nil && reference.Type() == plumbing.HashReference {
+			return reference.Hash()
+		}
+	}
+
+	return plumbing.ZeroHash
+}
+
+// rejection tells why an update that is not forced cannot be made, or
+// returns an empty string when it can
+func rejection(s storer.EncodedObjectStorer, u update, before plumbing.Hash) string {
+	if u.hash.IsZero() || before.IsZero() {
+		return ""
+	}
+	if strings.HasPrefix(u.destination.String(), "refs/tags/") {
+		return "the tag already exists on the remote"
+	}
+	if _, err := s.EncodedObject(plumbing.AnyObject, before); err != nil {
+		return "the remote has commits that are not in the repository, fetch first"
+	}
+
+	commit, err := object.GetCommit(s, u.hash)
+	if err != nil {
+		return err.Error()
+	}
+	fastForward := false
+	err = object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(c *object.Commit) error {
+		if c.Hash == before {
+			fastForward = true
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return err.Error()
+	}
+	if !fastForward {
+		return "non-fast-forward"
+	}
+
+	return ""
+}
@@ -0,0 +1,281 @@
+// Package remote manages the remotes of repositories, and fetches from and
+// pushes to them
+package remote
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/mirror"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+var (
+	// ErrInvalidName is returned for remote names that are not made of
+	// letters, digits, dots, dashes and underscores
+	ErrInvalidName = errors.New("remote names can only contain letters, digits, '.', '-' and '_'")
+	// ErrNoURL is returned when adding a remote without a URL
+	ErrNoURL = errors.New("remotes need at least one URL")
+	// ErrInvalidRefSpec is returned for refspecs that cannot be fetched with
+	ErrInvalidRefSpec = errors.New("refspecs must map a source to a destination, like +refs/heads/*:refs/remotes/origin/*")
+)
+
+// Authenticator looks up how to authenticate to the remote at a URL
+type Authenticator interface {
+	Auth(rawURL string) transport.AuthMethod
+}
+
+// authenticate returns the authentication for the first URL of the remote
+func authenticate(credentials Authenticator, remoteConfig *config.RemoteConfig) transport.AuthMethod {
+	if credentials == nil || len(remoteConfig.URLs) == 0 {
+		return nil
+	}
+
+	return credentials.Auth(remoteConfig.URLs[0])
+}
+
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func toRemote(remoteConfig *config.RemoteConfig) Remote {
+	remote := Remote{
+		Name:  remoteConfig.Name,
+		URLs:  make([]string, len(remoteConfig.URLs)),
+		Fetch: make([]string, len(remoteConfig.Fetch)),
+	}
+	for i, rawURL := range remoteConfig.URLs {
+		remote.URLs[i] = git.RedactURL(rawURL)
+	}
+	for i, refSpec := range remoteConfig.Fetch {
+		remote.Fetch[i] = refSpec.String()
+	}
+
+	return remote
+}
+
+// List returns the remotes of the repository, sorted by name
+func List(repository git.Repository) ([]Remote, error) {
+	cfg, err := repository.Storer().Config()
+	if err != nil {
+		return nil, err
+	}
+
+	remotes := make([]Remote, 0, len(cfg.Remotes))
+	for _, remoteConfig := range cfg.Remotes {
+		remotes = append(remotes, toRemote(remoteConfig))
+	}
+
+	sort.Slice(remotes, func(i, j int) bool {
+		return remotes[i].Name < remotes[j].Name
+	})
+
+	return remotes, nil
+}
+
+// parseRefSpecs validates refspecs to fetch with
+func parseRefSpecs(refSpecs []string) ([]config.RefSpec, error) {
+	parsed := make([]config.RefSpec, len(refSpecs))
+	for i, refSpec := range refSpecs {
+		parsed[i] = config.RefSpec(refSpec)
+		if parsed[i].Validate() != nil || parsed[i].IsDelete() {
+			return nil, ErrInvalidRefSpec
+		}
+	}
+
+	return parsed, nil
+}
+
+// Add adds a remote to the repository. Without refspecs, every branch of the
+// remote is fetched to refs/remotes/<name>/, like git remote add does. The
+// URLs are checked against the sandbox like mirror.CheckURL does.
+func Add(
+	repository git.Repository,
+	name string,
+	urls []string,
+	refSpecs []string,
+	sandbox *git.Sandbox,
+) (Remote, error) {
+	if !nameRegex.MatchString(name) {
+		return Remote{}, ErrInvalidName
+	}
+	if len(urls) == 0 {
+		return Remote{}, ErrNoURL
+	}
+	for _, rawURL := range urls {
+		if err := mirror.CheckURL(rawURL, sandbox); err != nil {
+			return Remote{}, err
+		}
+	}
+	fetch, err := parseRefSpecs(refSpecs)
+	if err != nil {
+		return Remote{}, err
+	}
+
+	wrapee, err := gogit.Open(repository.Storer(), nil)
+	if err != nil {
+		return Remote{}, err
+	}
+	created, err := wrapee.CreateRemote(&config.RemoteConfig{
+		Name:  name,
+		URLs:  urls,
+		Fetch: fetch,
+	})
+	if err != nil {
+		return Remote{}, err
+	}
+
+	return toRemote(created.Config()), nil
+}
+
+// Remove removes a remote and its remote-tracking references, like
+// git remote remove does
+func Remove(repository git.Repository, name string) error {
+	wrapee, err := gogit.Open(repository.Storer(), nil)
+	if err != nil {
+		return err
+	}
+	removed, err := wrapee.Remote(name)
+	if err != nil {
+		return err
+	}
+
+	if err := wrapee.DeleteRemote(name); err != nil {
+		return err
+	}
+
+	return prune(repository.Storer(), removed.Config().Fetch, nil)
+}
+
+// FetchOptions describes how a remote is fetched
+type FetchOptions struct {
+	// RefSpecs replace the refspecs the remote is configured with
+	RefSpecs []string
+	// Prune removes the remote-tracking references whose source is gone from
+	// the remote
+	Prune bool
+	// Credentials authenticate to the remote
+	Credentials Authenticator
+}
+
+// Fetch fetches the references of a remote along with their history, and
+// returns the references that changed
+func Fetch(repository git.Repository, name string, options *FetchOptions) ([]event.Change, error) {
+	wrapee, err := gogit.Open(repository.Storer(), nil)
+	if err != nil {
+		return nil, err
+	}
+	fetched, err := wrapee.Remote(name)
+	if err != nil {
+		return nil, err
+	}
+
+	refSpecs, err := parseRefSpecs(options.RefSpecs)
+	if err != nil {
+		return nil, err
+	}
+	if len(refSpecs) == 0 {
+		refSpecs = fetched.Config().Fetch
+	}
+
+	unlock := git.LockReferences(repository.Storer())
+	defer unlock()
+
+	before, err := event.Snapshot(repository.Storer())
+	if err != nil {
+		return nil, err
+	}
+
+	auth := authenticate(options.Credentials, fetched.Config())
+	references, err := fetched.List(&gogit.ListOptions{Auth: auth})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return nil, err
+	}
+
+	if len(references) > 0 {
+		err = fetched.Fetch(&gogit.FetchOptions{
+			RemoteName: name,
+			RefSpecs:   refSpecs,
+			Auth:       auth,
+		})
+		if err != nil && err != gogit.NoErrAlreadyUpToDate {
+			return nil, err
+		}
+	}
+
+	if options.Prune {
+		if err := prune(repository.Storer(), refSpecs, references); err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := event.Snapshot(repository.Storer())
+	if err != nil {
+		return nil, err
+	}
+
+	return event.Diff(before, after), nil
+}
+
+// prune removes the references the refspecs map to that none of the remote
+// references map to
+func prune(
+	s storer.ReferenceStorer,
+	refSpecs []config.RefSpec,
+	references []*plumbing.Reference,
+) error {
+	expected := make(map[plumbing.ReferenceName]bool)
+	for _, refSpec := range refSpecs {
+		for _, reference := range references {
+			if refSpec.Match(reference.Name()) {
+				expected[refSpec.Dst(reference.Name())] = true
+			}
+		}
+	}
+
+	iter, err := s.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var stale []plumbing.ReferenceName
+	err = iter.ForEach(func(reference *plumbing.Reference) error {
+		name := reference.Name()
+		if reference.Type() != plumbing.HashReference || expected[name] {
+			return nil
+		}
+
+		for _, refSpec := range refSpecs {
+			if destination(refSpec).Match(name) {
+				stale = append(stale, name)
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range stale {
+		if err := s.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// destination returns a refspec that matches the references refSpec maps to
+func destination(refSpec config.RefSpec) config.RefSpec {
+	parts := strings.SplitN(strings.TrimPrefix(refSpec.String(), "+"), ":", 2)
+
+	return config.RefSpec(parts[1] + ":" + parts[0])
+}
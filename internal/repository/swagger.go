@@ -1,8 +1,9 @@
 package repository
 
-// swagger:parameters listCommits listReferences
+// swagger:parameters listCommits listReferences listContainingReferences getBundle createBundle getArchive deleteRepository archiveRepository unarchiveRepository getMirror configureMirror deleteMirror syncMirror listPushMirrors createPushMirror deletePushMirror syncPushMirror listRemotes createRemote deleteRemote fetchRemote pushRemote listWebhooks createWebhook deleteWebhook listDeliveries redeliver streamEvents
 type Params struct {
-	// The directory of the repository
+	// The directory or registered name of the repository. Its segments are
+	// separated by '/', or by '|'.
 	//
 	// in: path
 	// required: true
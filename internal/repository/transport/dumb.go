@@ -0,0 +1,154 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	"github.com/gorilla/mux"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// cacheForever marks a response as immutable, which objects and packs are
+// since they are named after their content
+func cacheForever(writer http.ResponseWriter) {
+	header := writer.Header()
+	header.Set("Expires", "Fri, 01 Jan 2100 00:00:00 GMT")
+	header.Set("Cache-Control", "public, max-age=31536000")
+}
+
+// serveFile copies a file of the git directory to the client
+func serveFile(
+	writer http.ResponseWriter,
+	gitDirectory billy.Filesystem,
+	filename string,
+	contentType string,
+) {
+	if gitDirectory == nil {
+		http.Error(writer, "not found", http.StatusNotFound)
+		return
+	}
+
+	info, err := gitDirectory.Stat(filename)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		http.Error(writer, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	file, err := gitDirectory.Open(filename)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if _, err := io.Copy(writer, file); err != nil {
+		log.Printf("%s: serving %s: %s\n", gitDirectory.Root(), filename, err)
+	}
+}
+
+// serveInfoRefs lists the references of a repository for dumb HTTP clients,
+// which request info/refs without naming a service
+func serveInfoRefs(writer http.ResponseWriter, repositoryPath string, repository git.Repository) {
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	disableCaching(writer)
+
+	if err := protocol.WriteInfoRefs(writer, repository.Storer()); err != nil {
+		log.Printf("%s: listing references: %s\n", repositoryPath, err)
+	}
+}
+
+// NewGetHeadHandler serves the HEAD file of a repository to dumb HTTP clients
+func NewGetHeadHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		disableCaching(writer)
+		serveFile(writer, repository.GitDirectory(), "HEAD", "text/plain")
+	}
+}
+
+// NewGetInfoPacksHandler lists the packfiles of a repository, which dumb HTTP
+// clients fall back to when an object is not stored loose
+func NewGetInfoPacksHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repositoryPath := vars["directory"]
+		repository, _ := reader.Open(repositoryPath)
+
+		gitDirectory := repository.GitDirectory()
+		if gitDirectory == nil {
+			http.NotFound(writer, request)
+			return
+		}
+
+		files, err := gitDirectory.ReadDir(path.Join("objects", "pack"))
+		if err != nil && !os.IsNotExist(err) {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		disableCaching(writer)
+
+		var packs strings.Builder
+		for _, file := range files {
+			if !file.IsDir() && strings.HasSuffix(file.Name(), ".pack") {
+				fmt.Fprintf(&packs, "P %s\n", file.Name())
+			}
+		}
+		packs.WriteString("\n")
+
+		if _, err := io.WriteString(writer, packs.String()); err != nil {
+			log.Printf("%s: listing packs: %s\n", repositoryPath, err)
+		}
+	}
+}
+
+// NewGetLooseObjectHandler serves a zlib compressed loose object
+func NewGetLooseObjectHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		cacheForever(writer)
+		serveFile(writer,
+			repository.GitDirectory(),
+			path.Join("objects", vars["prefix"], vars["suffix"]),
+			"application/x-git-loose-object")
+	}
+}
+
+// NewGetPackHandler serves a packfile or the index of one
+func NewGetPackHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		contentType := "application/x-git-packed-objects"
+		if vars["extension"] == "idx" {
+			contentType = "application/x-git-packed-objects-toc"
+		}
+
+		cacheForever(writer)
+		serveFile(writer,
+			repository.GitDirectory(),
+			path.Join("objects", "pack",
+				fmt.Sprintf("pack-%s.%s", vars["hash"], vars["extension"])),
+			contentType)
+	}
+}
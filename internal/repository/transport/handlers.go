@@ -0,0 +1,170 @@
+// Package transport serves the git smart and dumb HTTP protocols, so that
+// the repositories exposed by the REST API can also be cloned, fetched and
+// pushed to
+package transport
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	"github.com/gorilla/mux"
+)
+
+func disableCaching(writer http.ResponseWriter) {
+	header := writer.Header()
+	header.Set("Expires", "Fri, 01 Jan 1980 00:00:00 GMT")
+	header.Set("Pragma", "no-cache")
+	header.Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+}
+
+// requestBody returns the request body, decompressing it if the client
+// gzipped it
+func requestBody(request *http.Request) (io.ReadCloser, error) {
+	if request.Header.Get("Content-Encoding") == "gzip" {
+		return gzip.NewReader(request.Body)
+	}
+
+	return request.Body, nil
+}
+
+// prepareServiceResponse checks the content type of a service request and
+// sets the headers of its response. It reports whether the request can be
+// served.
+func prepareServiceResponse(
+	writer http.ResponseWriter,
+	request *http.Request,
+	service string,
+) bool {
+	contentType := fmt.Sprintf("application/x-%s-request", service)
+	if request.Header.Get("Content-Type") != contentType {
+		http.Error(writer, "unexpected content type", http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	writer.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
+	disableCaching(writer)
+
+	return true
+}
+
+// NewGetInfoRefsHandler advertises the references of a repository to smart
+// HTTP clients, or lists them for dumb HTTP clients
+func NewGetInfoRefsHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repositoryPath := vars["directory"]
+		repository, _ := reader.Open(repositoryPath)
+
+		var advertise func(io.Writer) error
+		version := protocol.RequestedVersion(request.Header.Get("Git-Protocol"))
+		service := request.URL.Query().Get("service")
+		switch service {
+		case protocol.UploadPackService:
+			uploadPack := &protocol.UploadPack{
+				Storer:       repository.Storer(),
+				StatelessRPC: true,
+			}
+			advertise = uploadPack.AdvertiseReferences
+			if version == 2 {
+				advertise = uploadPack.AdvertiseCapabilities
+			}
+		case protocol.ReceivePackService:
+			version = 0
+			receivePack := &protocol.ReceivePack{Storer: repository.Storer()}
+			advertise = receivePack.AdvertiseReferences
+		case "":
+			serveInfoRefs(writer, repositoryPath, repository)
+			return
+		default:
+			http.Error(writer, "unsupported service", http.StatusForbidden)
+			return
+		}
+
+		writer.Header().Set("Content-Type",
+			fmt.Sprintf("application/x-%s-advertisement", service))
+		disableCaching(writer)
+
+		err := (func() error {
+			// Protocol v2 clients do not expect the service preamble
+			if version != 2 {
+				packets := protocol.NewPacketWriter(writer)
+				if err := protocol.WriteServiceHeader(packets, service); err != nil {
+					return err
+				}
+			}
+
+			return advertise(writer)
+		})()
+
+		if err != nil {
+			log.Printf("%s: advertising references: %s\n", repositoryPath, err)
+		}
+	}
+}
+
+// NewPostUploadPackHandler negotiates with a smart HTTP client and sends it
+// the packfile it needs
+func NewPostUploadPackHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repositoryPath := vars["directory"]
+		repository, _ := reader.Open(repositoryPath)
+
+		if !prepareServiceResponse(writer, request, protocol.UploadPackService) {
+			return
+		}
+
+		body, err := requestBody(request)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+
+		uploadPack := &protocol.UploadPack{
+			Storer:       repository.Storer(),
+			StatelessRPC: true,
+		}
+
+		serve := uploadPack.Serve
+		if protocol.RequestedVersion(request.Header.Get("Git-Protocol")) == 2 {
+			serve = uploadPack.ServeCommands
+		}
+
+		if err := serve(body, writer); err != nil {
+			log.Printf("%s: upload-pack: %s\n", repositoryPath, err)
+		}
+	}
+}
+
+// NewPostReceivePackHandler receives a packfile from a smart HTTP client,
+// updates the pushed references and reports the status of each one
+func NewPostReceivePackHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repositoryPath := vars["directory"]
+		repository, _ := reader.Open(repositoryPath)
+
+		if !prepareServiceResponse(writer, request, protocol.ReceivePackService) {
+			return
+		}
+
+		body, err := requestBody(request)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+
+		receivePack := &protocol.ReceivePack{Storer: repository.Storer()}
+
+		if _, err := receivePack.Serve(body, writer); err != nil {
+			log.Printf("%s: receive-pack: %s\n", repositoryPath, err)
+		}
+	}
+}
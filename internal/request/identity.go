@@ -0,0 +1,22 @@
+package request
+
+import (
+	"context"
+	"net/http"
+)
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx that carries the name of whoever sent
+// the request
+func WithIdentity(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, identityKey{}, name)
+}
+
+// Identity returns the name of whoever sent the request, which is only known
+// when they authenticated with a named API key
+func Identity(request *http.Request) (string, bool) {
+	name, ok := request.Context().Value(identityKey{}).(string)
+
+	return name, ok && name != ""
+}
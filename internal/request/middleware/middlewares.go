@@ -2,17 +2,22 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/drdgvhbh/gitserver/internal/request"
 
 	"github.com/drdgvhbh/gitserver/internal/response"
 
+	"github.com/drdgvhbh/gitserver/internal/connection"
+	"github.com/drdgvhbh/gitserver/internal/event"
 	"github.com/drdgvhbh/gitserver/internal/git"
 
 	"github.com/google/uuid"
@@ -22,23 +27,51 @@ import (
 var versionPrefixRegex = regexp.MustCompile("/v[0-9]+/")
 var repositoryDoesNotExistRegex = regexp.MustCompile("repository does not exist")
 
-func NewAuthMiddleware(apiKey string) mux.MiddlewareFunc {
+// NewAuthMiddleware only lets through requests that carry one of the API keys.
+// A key written as name:key is sent as key, and the requests that carry it are
+// attributed to name.
+func NewAuthMiddleware(apiKeys ...string) mux.MiddlewareFunc {
+	names := make([]string, len(apiKeys))
+	keys := make([]string, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		keys[i] = apiKey
+		if separator := strings.Index(apiKey, ":"); separator > 0 {
+			names[i], keys[i] = apiKey[:separator], apiKey[separator+1:]
+		}
+	}
+
+	// identify returns the name of the key candidate is, if it is one
+	identify := func(candidate string) (string, bool) {
+		for i, key := range keys {
+			if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+				return names[i], true
+			}
+		}
+
+		return "", false
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-			err := (func() error {
-				authorization := request.Header.Get("Authorization")
-
-				authorizationRegexp, err := regexp.Compile(
-					fmt.Sprintf("^%s$", apiKey))
-				if err != nil {
-					return err
+			name, err := (func() (string, error) {
+				if name, ok := identify(request.Header.Get("Authorization")); ok {
+					return name, nil
 				}
 
-				if authorizationRegexp.MatchString(authorization) {
-					return nil
+				// Git clients can only send credentials with basic auth, so the
+				// key is accepted as either the username or the password
+				username, password, ok := request.BasicAuth()
+				if !ok {
+					return "", errors.New("Unauthorized")
+				}
+				if name, ok := identify(password); ok {
+					return name, nil
+				}
+				if name, ok := identify(username); ok {
+					return name, nil
 				}
 
-				return errors.New("Unauthorized")
+				return "", errors.New("Unauthorized")
 			})()
 
 			if err != nil {
@@ -47,15 +80,24 @@ func NewAuthMiddleware(apiKey string) mux.MiddlewareFunc {
 						"error": "Unauthorized",
 					},
 				}
+				writer.Header().Set("WWW-Authenticate", `Basic realm="gitserver"`)
 				writer.WriteHeader(http.StatusUnauthorized)
 				_ = json.NewEncoder(writer).Encode(&errorPayload)
 			} else {
+				if name != "" {
+					request = withIdentity(request, name)
+				}
 				next.ServeHTTP(writer, request)
 			}
 		})
 	}
 }
 
+// withIdentity attributes r to name
+func withIdentity(r *http.Request, name string) *http.Request {
+	return r.WithContext(request.WithIdentity(r.Context(), name))
+}
+
 // ContentType injects application/json as the content type
 func ContentType(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
@@ -103,6 +145,8 @@ func NewResponseWriter(newResponseWriter request.NewResponseWriter) mux.Middlewa
 	}
 }
 
+// RepositoryDirectoryVariableSanitizer turns the '|' that can separate the
+// segments of the directory variable into '/'
 func RepositoryDirectoryVariableSanitizer(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		vars := mux.Vars(request)
@@ -133,6 +177,13 @@ func NewOpenRepository(reader git.Reader) mux.MiddlewareFunc {
 						},
 					}
 					writer.WriteHeader(http.StatusNotFound)
+				} else if err == git.ErrOutsideRoot {
+					errorPayload = &response.Payload{
+						Errors: map[string]interface{}{
+							"error": err.Error(),
+						},
+					}
+					writer.WriteHeader(http.StatusForbidden)
 				} else {
 					panic(err) // TODO: Replace with a log statement or something more appropriate
 				}
@@ -148,3 +199,71 @@ func NewOpenRepository(reader git.Reader) mux.MiddlewareFunc {
 		})
 	}
 }
+
+// NewRefuseArchived creates a middleware that refuses requests to archived
+// repositories with 403 Forbidden, for endpoints that change the repository.
+// It must come after the repository is known to exist.
+func NewRefuseArchived(reader git.Reader) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			repository, err := reader.Open(mux.Vars(request)["directory"])
+			if err == nil {
+				archived, err := git.IsArchived(repository)
+				if err != nil {
+					log.Printf("%s: %s\n", mux.Vars(request)["directory"], err)
+					response.WriteError(writer, http.StatusInternalServerError, err)
+					return
+				}
+
+				if archived {
+					response.WriteError(writer, http.StatusForbidden, git.ErrArchived)
+					return
+				}
+			}
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// NewPublishChanges creates a middleware that publishes the references a
+// request changed to bus. Requests that only read are passed through. It must
+// come after the repository is known to exist.
+func NewPublishChanges(reader git.Reader, bus *event.Bus) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			repositoryPath := mux.Vars(request)["directory"]
+			repository, err := reader.Open(repositoryPath)
+			if err != nil || request.Method == http.MethodGet || request.Method == http.MethodHead {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			err = bus.Watch(git.Locate(reader, repositoryPath), repository.Storer(), func() error {
+				next.ServeHTTP(writer, request)
+				return nil
+			})
+			if err != nil {
+				log.Printf("%s: %s\n", repositoryPath, err)
+			}
+		})
+	}
+}
+
+// NewLiftWriteDeadline creates a middleware that lifts the write deadline of
+// the connection a request came in on, for responses that stream for as long
+// as the client listens. Connections the tracker does not know of, such as
+// HTTP/2 ones, keep their deadline.
+func NewLiftWriteDeadline(connections *connection.Tracker) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if conn, ok := connections.Conn(request); ok {
+				if err := conn.SetWriteDeadline(time.Time{}); err != nil {
+					log.Printf("%s: %s\n", request.URL.Path, err)
+				}
+			}
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
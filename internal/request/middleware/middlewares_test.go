@@ -8,7 +8,11 @@ import (
 	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/drdgvhbh/gitserver/internal/connection"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/request"
 	"github.com/drdgvhbh/gitserver/internal/request/middleware"
 
 	"github.com/drdgvhbh/gitserver/internal/mock"
@@ -17,6 +21,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 )
 
 var uuidRegex = regexp.MustCompile("^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-4[a-fA-F0-9]{3}-[8|9|aA|bB][a-fA-F0-9]{3}-[a-fA-F0-9]{12}$")
@@ -119,6 +125,68 @@ func TestResponseWriterMiddleware(t *testing.T) {
 	assert.EqualValues(testMessage, message)
 }
 
+func TestAuthMiddlewareAcceptsBasicAuth(t *testing.T) {
+	mockHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte{})
+	}
+
+	assert := assert.New(t)
+
+	const apiKey = "e8b8dc29-d1d9-495d-b509-4dde3701018b"
+	handler := middleware.NewAuthMiddleware(apiKey)(http.HandlerFunc(mockHandler))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.SetBasicAuth("git", apiKey)
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	req, _ = http.NewRequest("GET", ts.URL, nil)
+	req.SetBasicAuth("git", "wrong")
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(err)
+	assert.Equal(http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(`Basic realm="gitserver"`, res.Header.Get("WWW-Authenticate"))
+}
+
+func TestAuthMiddlewareAttributesRequestsToNamedKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	var name string
+	var identified bool
+	mockHandler := func(w http.ResponseWriter, r *http.Request) {
+		name, identified = request.Identity(r)
+	}
+
+	const apiKey = "e8b8dc29-d1d9-495d-b509-4dde3701018b"
+	const otherKey = "0b9f2f44-2b0c-4b45-9d0f-3f3d3a1f7c55"
+	handler := middleware.NewAuthMiddleware("alice:"+apiKey, otherKey)(
+		http.HandlerFunc(mockHandler))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("git", apiKey)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(http.StatusOK, res.Code)
+	assert.True(identified)
+	assert.Equal("alice", name)
+
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("git", "alice:"+apiKey)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(http.StatusUnauthorized, res.Code)
+
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("alice", otherKey)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(http.StatusOK, res.Code)
+	assert.False(identified)
+}
+
 func TestRepositoryDirectoryVariableSanitizer(t *testing.T) {
 	mockHandler := func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte{})
@@ -186,3 +254,98 @@ func (suite *NewOpenRepositoryMiddlewareTestSuite) TestReportsRepositoryNotFound
 func TestNewOpenRepositoryMiddlewareTestSuite(t *testing.T) {
 	suite.Run(t, new(NewOpenRepositoryMiddlewareTestSuite))
 }
+
+func TestRefuseArchivedRefusesArchivedRepositories(t *testing.T) {
+	assert := assert.New(t)
+
+	path := "/srv/project.git"
+	repository := new(mock.Repository)
+	repository.On("Storer").Return(memory.NewStorage())
+	reader := new(mock.Reader)
+	reader.On("Open", path).Return(repository, nil)
+
+	handler := middleware.NewRefuseArchived(reader)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+	serve := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/", nil)
+		req = mux.SetURLVars(req, map[string]string{"directory": path})
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	assert.Equal(http.StatusNoContent, serve().Code)
+
+	assert.NoError(git.SetArchived(repository, true))
+	res := serve()
+	assert.Equal(http.StatusForbidden, res.Code)
+	assert.JSONEq(
+		`{ "errors": { "error": "repository is archived and read-only" }}`,
+		res.Body.String())
+}
+
+// unreadableConfig is a storage whose configuration cannot be read
+type unreadableConfig struct {
+	*memory.Storage
+}
+
+func (unreadableConfig) Config() (*config.Config, error) {
+	return nil, errors.New("config is unreadable")
+}
+
+func TestRefuseArchivedReportsUnreadableConfigs(t *testing.T) {
+	assert := assert.New(t)
+
+	path := "/srv/project.git"
+	repository := new(mock.Repository)
+	repository.On("Storer").Return(unreadableConfig{memory.NewStorage()})
+	reader := new(mock.Reader)
+	reader.On("Open", path).Return(repository, nil)
+
+	handler := middleware.NewRefuseArchived(reader)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+	req, _ := http.NewRequest("POST", "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"directory": path})
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(http.StatusInternalServerError, res.Code)
+	assert.JSONEq(`{ "errors": { "error": "config is unreadable" }}`, res.Body.String())
+}
+
+func TestLiftWriteDeadlineOutlivesTheWriteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	connections := connection.NewTracker()
+	router := mux.NewRouter()
+	router.Handle("/bounded", slow)
+	router.Handle("/stream", middleware.NewLiftWriteDeadline(connections)(slow))
+
+	server := httptest.NewUnstartedServer(router)
+	server.Listener = connections.Listen(server.Listener)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	_, err := http.Get(server.URL + "/bounded")
+	assert.Error(err)
+
+	res, err := http.Get(server.URL + "/stream")
+	assert.NoError(err)
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(err)
+	assert.Equal("done", string(body))
+}
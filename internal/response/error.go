@@ -0,0 +1,18 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// WriteError writes a response with the status code whose payload holds the
+// message of err
+func WriteError(writer http.ResponseWriter, statusCode int, err error) {
+	errorPayload := Payload{
+		Errors: map[string]interface{}{
+			"error": err.Error(),
+		},
+	}
+	writer.WriteHeader(statusCode)
+	_ = json.NewEncoder(writer).Encode(&errorPayload)
+}
@@ -2,7 +2,21 @@ package internal
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/drdgvhbh/gitserver/internal/archive"
+	"github.com/drdgvhbh/gitserver/internal/bundle"
+	"github.com/drdgvhbh/gitserver/internal/connection"
+	"github.com/drdgvhbh/gitserver/internal/credential"
+	"github.com/drdgvhbh/gitserver/internal/discovery"
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/jobs"
+	"github.com/drdgvhbh/gitserver/internal/key"
+	"github.com/drdgvhbh/gitserver/internal/lfs"
+	"github.com/drdgvhbh/gitserver/internal/lifecycle"
+	"github.com/drdgvhbh/gitserver/internal/mirror"
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	"github.com/drdgvhbh/gitserver/internal/registry"
 	"github.com/drdgvhbh/gitserver/internal/repository"
 
 	request2 "github.com/drdgvhbh/gitserver/internal/request"
@@ -10,9 +24,13 @@ import (
 
 	"github.com/drdgvhbh/gitserver/internal/repository/commit"
 	"github.com/drdgvhbh/gitserver/internal/repository/reference"
+	"github.com/drdgvhbh/gitserver/internal/repository/remote"
+	"github.com/drdgvhbh/gitserver/internal/repository/transport"
 	"github.com/drdgvhbh/gitserver/internal/response"
 
 	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/watch"
+	"github.com/drdgvhbh/gitserver/internal/webhook"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"gopkg.in/src-d/go-billy.v4"
@@ -20,6 +38,13 @@ import (
 
 var _ = repository.Params{}
 
+// directoryPath matches the directory of a repository, whose segments can be
+// separated by '/' as well as '|'. It is lazy, so that the routes under a
+// repository are matched against what follows the shortest directory. It
+// starts the path of each route rather than ending the prefix of their
+// router, since mux takes the variables of a prefix from the prefix alone.
+const directoryPath = "/{directory:.+?}"
+
 var (
 	responseProperties = &response.Properties{
 		APIVersion: "0.0.1",
@@ -37,28 +62,300 @@ func newResponseWriter(
 	}
 }
 
-func NewRootHandler(worktree billy.Filesystem) http.Handler {
-	fileSystem := git.NewReader(worktree)
+// Options configure the root handler
+type Options struct {
+	// FileSystem is the filesystem repositories are opened from
+	FileSystem billy.Filesystem
+	// Sandbox confines repositories to its roots. Repositories are not
+	// confined when it is nil.
+	Sandbox *git.Sandbox
+	// Keys holds the SSH public keys managed through the API
+	Keys *key.Store
+	// APIKeys are the keys clients authenticate with
+	APIKeys []string
+	// Credentials authenticate to remotes. They are kept in memory when it is
+	// nil.
+	Credentials *credential.Store
+	// Registry maps names to repositories. Names are kept in memory when it
+	// is nil.
+	Registry *registry.Store
+	// Trash keeps deleted repositories. Repositories cannot be deleted when
+	// it is nil.
+	Trash *lifecycle.Trash
+	// Jobs runs the background jobs. One job runs at a time when it is nil.
+	Jobs *jobs.Runner
+	// Mirrors syncs the mirrors. Mirrors are only synced on request when it
+	// is nil.
+	Mirrors *mirror.Scheduler
+	// Events tells subscribers about the references that changed. A bus is
+	// created when it is nil.
+	Events *event.Bus
+	// Pusher replicates to push mirrors. One that retries after ten seconds
+	// is subscribed to Events when it is nil.
+	Pusher *mirror.Pusher
+	// Webhooks delivers webhooks. One that retries after ten seconds is
+	// subscribed to Events when it is nil.
+	Webhooks *webhook.Dispatcher
+	// Watcher notices the changes streamed to clients. One that polls every
+	// second is created when it is nil.
+	Watcher *watch.Watcher
+	// Connections tracks the connections of the server, so that streams can
+	// outlive the write timeout. Streams are bound by it when it is nil.
+	Connections *connection.Tracker
+}
+
+func NewRootHandler(options *Options) http.Handler {
+	pathReader := git.NewReader(options.FileSystem)
+	if options.Sandbox != nil {
+		pathReader = git.NewSandboxedReader(options.FileSystem, options.Sandbox)
+	}
+
+	names := options.Registry
+	if names == nil {
+		names, _ = registry.NewStore("")
+	}
+	fileSystem := registry.NewReader(names, pathReader)
+
+	// Only confined servers know where to look for repositories
+	var roots []string
+	if options.Sandbox != nil {
+		roots = options.Sandbox.Roots()
+	}
+	scanner := discovery.NewScanner(options.FileSystem, roots, names)
+
+	runner := options.Jobs
+	if runner == nil {
+		runner = jobs.NewRunner(1)
+	}
+	bus := options.Events
+	if bus == nil {
+		bus = event.NewBus()
+	}
+	mirrors := options.Mirrors
+	if mirrors == nil {
+		mirrors = mirror.NewScheduler(fileSystem, scanner, runner, bus)
+	}
+	pusher := options.Pusher
+	if pusher == nil {
+		pusher = mirror.NewPusher(fileSystem, 10*time.Second)
+		bus.Subscribe(pusher.Handle)
+	}
+	webhooks := options.Webhooks
+	if webhooks == nil {
+		webhooks = webhook.NewDispatcher(fileSystem, scanner, 10*time.Second)
+		bus.Subscribe(webhooks.Handle)
+	}
+	watcher := options.Watcher
+	if watcher == nil {
+		watcher = watch.NewWatcher(fileSystem, bus, time.Second)
+	}
+	keys := options.Keys
+	if keys == nil {
+		keys, _ = key.NewStore("")
+	}
+	credentials := options.Credentials
+	if credentials == nil {
+		credentials, _ = credential.NewStore("")
+	}
 
 	router := mux.NewRouter()
 	router.Use(middleware.ContentType)
 	router.Use(middleware.IDContext)
 	router.Use(middleware.MethodContext)
+
+	authMiddleware := middleware.NewAuthMiddleware(options.APIKeys...)
+
+	// The git transport speaks its own wire format, so it is registered ahead
+	// of the JSON API and does not go through the response writer. The .git/
+	// that ends its prefix tells the directory apart from what follows it.
+	transportRouter := router.
+		PathPrefix("/v1/repositories" + directoryPath + ".git/").
+		Subrouter()
+	transportRouter.Use(authMiddleware)
+	transportRouter.Use(middleware.RepositoryDirectoryVariableSanitizer)
+	transportRouter.Use(middleware.NewOpenRepository(fileSystem))
+
+	// Archived repositories cannot be pushed to
+	pushRouter := transportRouter.NewRoute().Subrouter()
+	pushRouter.Use(middleware.NewRefuseArchived(fileSystem))
+	pushRouter.Use(middleware.NewPublishChanges(fileSystem, bus))
+	pushRouter.
+		HandleFunc("/info/refs", transport.NewGetInfoRefsHandler(fileSystem)).
+		Queries("service", protocol.ReceivePackService).
+		Methods("GET")
+	pushRouter.
+		HandleFunc("/git-receive-pack", transport.NewPostReceivePackHandler(fileSystem)).
+		Methods("POST")
+
+	transportRouter.
+		HandleFunc("/info/refs", transport.NewGetInfoRefsHandler(fileSystem)).
+		Methods("GET")
+	transportRouter.
+		HandleFunc("/git-upload-pack", transport.NewPostUploadPackHandler(fileSystem)).
+		Methods("POST")
+
+	// The dumb HTTP protocol reads files of the git directory directly
+	transportRouter.
+		HandleFunc("/HEAD", transport.NewGetHeadHandler(fileSystem)).
+		Methods("GET")
+	transportRouter.
+		HandleFunc("/objects/info/packs", transport.NewGetInfoPacksHandler(fileSystem)).
+		Methods("GET")
+	transportRouter.
+		HandleFunc("/objects/{prefix:[0-9a-f]{2}}/{suffix:[0-9a-f]{38}}",
+			transport.NewGetLooseObjectHandler(fileSystem)).
+		Methods("GET")
+	transportRouter.
+		HandleFunc("/objects/pack/pack-{hash:[0-9a-f]{40}}.{extension:pack|idx}",
+			transport.NewGetPackHandler(fileSystem)).
+		Methods("GET")
+
+	// Git LFS clients derive the LFS server from the remote URL by appending
+	// /info/lfs, and speak their own JSON media type.
+	lfsRouter := transportRouter.PathPrefix("/info/lfs").Subrouter()
+	lfsRouter.
+		HandleFunc("/objects/batch", lfs.NewBatchHandler(fileSystem, lfs.NewFilesystemBackend)).
+		Methods("POST")
+	lfsRouter.
+		HandleFunc("/objects/{oid:[0-9a-f]{64}}", lfs.NewDownloadHandler(fileSystem, lfs.NewFilesystemBackend)).
+		Methods("GET")
+	lfsRouter.
+		HandleFunc("/objects/{oid:[0-9a-f]{64}}/verify", lfs.NewVerifyHandler(fileSystem, lfs.NewFilesystemBackend)).
+		Methods("POST")
+	lfsRouter.
+		HandleFunc("/locks", lfs.NewListLocksHandler(fileSystem)).
+		Methods("GET")
+	lfsRouter.
+		HandleFunc("/locks/verify", lfs.NewVerifyLocksHandler(fileSystem)).
+		Methods("POST")
+
+	// Archived repositories take no new objects, and their locks are frozen
+	lfsWriteRouter := lfsRouter.NewRoute().Subrouter()
+	lfsWriteRouter.Use(middleware.NewRefuseArchived(fileSystem))
+	lfsWriteRouter.
+		HandleFunc("/objects/{oid:[0-9a-f]{64}}", lfs.NewUploadHandler(fileSystem, lfs.NewFilesystemBackend)).
+		Methods("PUT")
+	lfsWriteRouter.
+		HandleFunc("/locks", lfs.NewCreateLockHandler(fileSystem)).
+		Methods("POST")
+	lfsWriteRouter.
+		HandleFunc("/locks/{id}/unlock", lfs.NewUnlockHandler(fileSystem)).
+		Methods("POST")
+
+	// Downloads are streamed as they are, so like the transport they are
+	// registered ahead of the JSON API and skip its response writer.
+	downloadRouter := router.
+		PathPrefix("/v1/repositories").
+		Subrouter()
+	downloadRouter.Use(authMiddleware)
+	downloadRouter.Use(middleware.RepositoryDirectoryVariableSanitizer)
+	downloadRouter.Use(middleware.NewOpenRepository(fileSystem))
+
+	// swagger:route GET /repositories/{directory}/bundle getBundle
+	//
+	// Download a bundle
+	//
+	// This will stream a git bundle of the specified references, or of every
+	// reference, leaving out the history the receiving side already has.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/x-git-bundle
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetBundleOkResponse
+	downloadRouter.
+		HandleFunc(directoryPath+"/bundle", bundle.NewGetBundleHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route GET /repositories/{directory}/archive/{revision}.{format} getArchive
+	//
+	// Download an archive
+	//
+	// This will stream the tree at the revision as a tarball or a zip file,
+	// leaving out the paths marked export-ignore in .gitattributes.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/gzip
+	//			- application/zip
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetArchiveOkResponse
+	downloadRouter.
+		HandleFunc(directoryPath+`/archive/{revision:.+}.{format:tar\.gz|zip}`,
+			archive.NewGetArchiveHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route GET /repositories/{directory}/events streamEvents
+	//
+	// Stream changes
+	//
+	// This will stream server-sent events whenever the references, HEAD, the
+	// index or the worktree of the repository change, until the client
+	// disconnects.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- text/event-stream
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: StreamEventsOkResponse
+	streamRouter := downloadRouter.NewRoute().Subrouter()
+	streamRouter.Use(middleware.NewLiftWriteDeadline(options.Connections))
+	streamRouter.
+		HandleFunc(directoryPath+"/events", watch.NewStreamEventsHandler(watcher)).
+		Methods("GET")
+
 	apiVersionRouter := router.PathPrefix("/v1").Subrouter()
 	apiVersionRouter.Use(middleware.NewResponseWriter(newResponseWriter))
-	apiVersionRouter.Use(middleware.NewAuthMiddleware("e8b8dc29-d1d9-495d-b509-4dde3701018b"))
+	apiVersionRouter.Use(authMiddleware)
 
-	repositoriesRouter := apiVersionRouter.
-		PathPrefix("/repositories/{directory}").
-		Subrouter()
-	repositoriesRouter.Use(middleware.RepositoryDirectoryVariableSanitizer)
-	repositoriesRouter.Use(middleware.NewOpenRepository(fileSystem))
+	// swagger:route GET /keys listKeys
+	//
+	// List public keys
+	//
+	// This will list the SSH public keys allowed to use the git transport.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetKeysOkResponse
+	apiVersionRouter.
+		HandleFunc("/keys", key.NewGetKeysHandler(keys)).
+		Methods("GET")
 
-	// swagger:route GET /repositories/{directory}/commits listCommits
+	// swagger:route POST /keys createKey
 	//
-	// List commits
+	// Register a public key
 	//
-	// This will list the commit in the specified repository.
+	// This will allow the SSH public key to clone, fetch and push over SSH.
 	//
 	//     	Consumes:
 	//     	- application/json
@@ -71,16 +368,62 @@ func NewRootHandler(worktree billy.Filesystem) http.Handler {
 	//			Security:
 	//				api_key:
 	//			Responses:
-	//       	200: GetCommitsOkResponse
-	repositoriesRouter.
-		HandleFunc("/commits", commit.NewGetCommitsHandler(fileSystem)).
+	//       	201: CreateKeyCreatedResponse
+	apiVersionRouter.
+		HandleFunc("/keys", key.NewCreateKeyHandler(keys)).
+		Methods("POST")
+
+	// swagger:route DELETE /keys/{id} deleteKey
+	//
+	// Remove a public key
+	//
+	// This will revoke SSH access for the public key.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: DeleteKeyNoContentResponse
+	apiVersionRouter.
+		HandleFunc("/keys/{id}", key.NewDeleteKeyHandler(keys)).
+		Methods("DELETE")
+
+	// swagger:route GET /credentials listCredentials
+	//
+	// List credentials
+	//
+	// This will list the credentials remotes are authenticated to with,
+	// without their passwords.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetCredentialsOkResponse
+	apiVersionRouter.
+		HandleFunc("/credentials", credential.NewGetCredentialsHandler(credentials)).
 		Methods("GET")
 
-	// swagger:route GET /repositories/{directory}/references listReferences
+	// swagger:route POST /credentials createCredential
 	//
-	// List references
+	// Store a credential
 	//
-	// This will list the references in the specified repository.
+	// This will authenticate fetches from and pushes to the remotes under the
+	// URL with the user name and password or token.
 	//
 	//     	Consumes:
 	//     	- application/json
@@ -93,10 +436,836 @@ func NewRootHandler(worktree billy.Filesystem) http.Handler {
 	//			Security:
 	//				api_key:
 	//			Responses:
-	//       	200: GetReferencesOkResponse
-	repositoriesRouter.
-		HandleFunc("/references", reference.NewGetReferencesHandler(fileSystem)).
+	//       	201: CreateCredentialCreatedResponse
+	apiVersionRouter.
+		HandleFunc("/credentials", credential.NewCreateCredentialHandler(credentials)).
+		Methods("POST")
+
+	// swagger:route DELETE /credentials/{id} deleteCredential
+	//
+	// Remove a credential
+	//
+	// This will stop authenticating to remotes with the credential.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: DeleteCredentialNoContentResponse
+	apiVersionRouter.
+		HandleFunc("/credentials/{id}", credential.NewDeleteCredentialHandler(credentials)).
+		Methods("DELETE")
+
+	// swagger:route GET /repositories listRepositories
+	//
+	// List repositories
+	//
+	// This will list the repositories found under the repository roots.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetRepositoriesOkResponse
+	apiVersionRouter.
+		HandleFunc("/repositories", discovery.NewGetRepositoriesHandler(scanner)).
+		Methods("GET")
+
+	// swagger:route POST /repositories createRepository
+	//
+	// Create a repository
+	//
+	// This will initialize a repository under the repository root, optionally
+	// with an initial commit of a README and a .gitignore.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	201: CreateRepositoryCreatedResponse
+	apiVersionRouter.
+		HandleFunc("/repositories", lifecycle.NewCreateRepositoryHandler(options.FileSystem, roots)).
+		Methods("POST")
+
+	// swagger:route POST /imports importRepository
+	//
+	// Import a repository
+	//
+	// This will start a job that copies every branch and tag of a repository
+	// on the local filesystem into a new repository under the repository root.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	202: JobAcceptedResponse
+	apiVersionRouter.
+		HandleFunc("/imports",
+			lifecycle.NewImportRepositoryHandler(options.FileSystem, roots, runner)).
+		Methods("POST")
+
+	// swagger:route GET /jobs listJobs
+	//
+	// List jobs
+	//
+	// This will list the background jobs, most recent first.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetJobsOkResponse
+	apiVersionRouter.
+		HandleFunc("/jobs", jobs.NewGetJobsHandler(runner)).
+		Methods("GET")
+
+	// swagger:route GET /jobs/{id} getJob
+	//
+	// Get a job
+	//
+	// This will return the status and progress of a background job.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: JobOkResponse
+	apiVersionRouter.
+		HandleFunc("/jobs/{id}", jobs.NewGetJobHandler(runner)).
+		Methods("GET")
+
+	// swagger:route GET /registry listEntries
+	//
+	// List repository names
+	//
+	// This will list the names repositories can be referred to by.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetEntriesOkResponse
+	apiVersionRouter.
+		HandleFunc("/registry", registry.NewGetEntriesHandler(names)).
 		Methods("GET")
 
+	// swagger:route POST /registry createEntry
+	//
+	// Register a repository name
+	//
+	// This will let clients refer to the repository at the location by the name.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	201: EntryOkResponse
+	apiVersionRouter.
+		HandleFunc("/registry", registry.NewCreateEntryHandler(names, pathReader)).
+		Methods("POST")
+
+	// swagger:route GET /registry/{name} getEntry
+	//
+	// Get a repository name
+	//
+	// This will return the repository location registered by the name.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: EntryOkResponse
+	apiVersionRouter.
+		HandleFunc("/registry/{name:.+}", registry.NewGetEntryHandler(names)).
+		Methods("GET")
+
+	// swagger:route PUT /registry/{name} updateEntry
+	//
+	// Move a repository name
+	//
+	// This will point the name at the new location of its repository.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: EntryOkResponse
+	apiVersionRouter.
+		HandleFunc("/registry/{name:.+}", registry.NewUpdateEntryHandler(names, pathReader)).
+		Methods("PUT")
+
+	// swagger:route DELETE /registry/{name} deleteEntry
+	//
+	// Unregister a repository name
+	//
+	// This will remove the name, leaving the repository untouched.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: DeleteEntryNoContentResponse
+	apiVersionRouter.
+		HandleFunc("/registry/{name:.+}", registry.NewDeleteEntryHandler(names)).
+		Methods("DELETE")
+
+	repositoriesRouter := apiVersionRouter.
+		PathPrefix("/repositories").
+		Subrouter()
+	repositoriesRouter.Use(middleware.RepositoryDirectoryVariableSanitizer)
+	repositoriesRouter.Use(middleware.NewOpenRepository(fileSystem))
+
+	// swagger:route GET /repositories/{directory}/commits listCommits
+	//
+	// List commits
+	//
+	// This will list the commit in the specified repository.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetCommitsOkResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/commits", commit.NewGetCommitsHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route GET /repositories/{directory}/commits/{hash}/containing listContainingReferences
+	//
+	// List references containing a commit
+	//
+	// This will list the branches and tags whose history includes the specified commit.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetContainingReferencesOkResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/commits/{hash:[0-9a-f]{40}}/containing",
+			commit.NewGetContainingReferencesHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route GET /repositories/{directory}/references listReferences
+	//
+	// List references
+	//
+	// This will list the references in the specified repository.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetReferencesOkResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/references", reference.NewGetReferencesHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route POST /repositories/{directory}/archive archiveRepository
+	//
+	// Archive a repository
+	//
+	// This will make the repository read-only: pushes and every other change
+	// are refused until it is unarchived.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: ArchiveRepositoryNoContentResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/archive", lifecycle.NewArchiveRepositoryHandler(fileSystem, true)).
+		Methods("POST")
+
+	// swagger:route DELETE /repositories/{directory}/archive unarchiveRepository
+	//
+	// Unarchive a repository
+	//
+	// This will make an archived repository writable again.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: ArchiveRepositoryNoContentResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/archive", lifecycle.NewArchiveRepositoryHandler(fileSystem, false)).
+		Methods("DELETE")
+
+	// swagger:route GET /repositories/{directory}/mirror getMirror
+	//
+	// Get the mirror status
+	//
+	// This will return the upstream the repository mirrors, and when it was last
+	// synced.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: MirrorOkResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/mirror", mirror.NewGetMirrorHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route GET /repositories/{directory}/mirror/push listPushMirrors
+	//
+	// List push mirrors
+	//
+	// This will list the repositories the references are replicated to, and
+	// when they were last replicated to.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetPushMirrorsOkResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/mirror/push", mirror.NewGetPushMirrorsHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route GET /repositories/{directory}/remotes listRemotes
+	//
+	// List remotes
+	//
+	// This will list the remotes in the config of the repository.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetRemotesOkResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/remotes", remote.NewGetRemotesHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route GET /repositories/{directory}/webhooks listWebhooks
+	//
+	// List webhooks
+	//
+	// This will list the webhooks of the repository, without their secrets.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetWebhooksOkResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/webhooks", webhook.NewGetWebhooksHandler(fileSystem)).
+		Methods("GET")
+
+	// swagger:route GET /repositories/{directory}/webhooks/{id}/deliveries listDeliveries
+	//
+	// List deliveries of a webhook
+	//
+	// This will list the latest deliveries of the webhook, newest first, along
+	// with their payload and outcome.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: GetDeliveriesOkResponse
+	repositoriesRouter.
+		HandleFunc(directoryPath+"/webhooks/{id}/deliveries", webhook.NewGetDeliveriesHandler(fileSystem)).
+		Methods("GET")
+
+	// Archived repositories refuse every change
+	repositoriesWriteRouter := repositoriesRouter.NewRoute().Subrouter()
+	repositoriesWriteRouter.Use(middleware.NewRefuseArchived(fileSystem))
+	repositoriesWriteRouter.Use(middleware.NewPublishChanges(fileSystem, bus))
+
+	// swagger:route POST /repositories/{directory}/bundle createBundle
+	//
+	// Unbundle a bundle
+	//
+	// This will store the objects of the git bundle in the request body and
+	// update the references it carries. References that would not be
+	// fast-forwarded are refused unless forced, and the branch checked out in
+	// the worktree is always refused.
+	//
+	//     	Consumes:
+	//     	- application/x-git-bundle
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: CreateBundleOkResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/bundle", bundle.NewCreateBundleHandler(fileSystem)).
+		Methods("POST")
+
+	// swagger:route PUT /repositories/{directory}/mirror configureMirror
+	//
+	// Mirror an upstream
+	//
+	// This will make the repository a mirror of the upstream, whose references
+	// are fetched periodically, replacing those of the repository.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: MirrorOkResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/mirror", mirror.NewConfigureMirrorHandler(fileSystem, options.Sandbox)).
+		Methods("PUT")
+
+	// swagger:route DELETE /repositories/{directory}/mirror deleteMirror
+	//
+	// Stop mirroring an upstream
+	//
+	// This will stop syncing the repository, keeping the references it has.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: DeleteMirrorNoContentResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/mirror", mirror.NewDeleteMirrorHandler(fileSystem)).
+		Methods("DELETE")
+
+	// swagger:route POST /repositories/{directory}/mirror/sync syncMirror
+	//
+	// Sync a mirror
+	//
+	// This will start a job that fetches the references of the upstream right
+	// away.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	202: JobAcceptedResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/mirror/sync", mirror.NewSyncMirrorHandler(mirrors)).
+		Methods("POST")
+
+	// swagger:route POST /repositories/{directory}/mirror/push createPushMirror
+	//
+	// Add a push mirror
+	//
+	// This will replicate the references to the downstream repository now, and
+	// whenever they change.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	201: PushMirrorOkResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/mirror/push", mirror.NewCreatePushMirrorHandler(fileSystem, options.Sandbox, pusher)).
+		Methods("POST")
+
+	// swagger:route DELETE /repositories/{directory}/mirror/push/{name} deletePushMirror
+	//
+	// Remove a push mirror
+	//
+	// This will stop replicating the references to the downstream repository.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: DeletePushMirrorNoContentResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/mirror/push/{name}", mirror.NewDeletePushMirrorHandler(fileSystem)).
+		Methods("DELETE")
+
+	// swagger:route POST /repositories/{directory}/mirror/push/{name}/sync syncPushMirror
+	//
+	// Sync a push mirror
+	//
+	// This will replicate the references to the downstream repository right away.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	202: PushMirrorOkResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/mirror/push/{name}/sync", mirror.NewSyncPushMirrorHandler(fileSystem, pusher)).
+		Methods("POST")
+
+	// swagger:route POST /repositories/{directory}/remotes createRemote
+	//
+	// Add a remote
+	//
+	// This will add a remote to the config of the repository.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	201: CreateRemoteCreatedResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/remotes", remote.NewCreateRemoteHandler(fileSystem, options.Sandbox)).
+		Methods("POST")
+
+	// swagger:route DELETE /repositories/{directory}/remotes/{name} deleteRemote
+	//
+	// Remove a remote
+	//
+	// This will remove the remote from the config of the repository, along with
+	// its remote-tracking references.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: DeleteRemoteNoContentResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/remotes/{name}", remote.NewDeleteRemoteHandler(fileSystem)).
+		Methods("DELETE")
+
+	// swagger:route POST /repositories/{directory}/remotes/{name}/fetch fetchRemote
+	//
+	// Fetch from a remote
+	//
+	// This will fetch the references of the remote with its refspecs or those
+	// in the request, optionally pruning stale remote-tracking references.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: FetchRemoteOkResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/remotes/{name}/fetch", remote.NewFetchRemoteHandler(fileSystem, credentials)).
+		Methods("POST")
+
+	// swagger:route POST /repositories/{directory}/remotes/{name}/push pushRemote
+	//
+	// Push to a remote
+	//
+	// This will push references to the remote, authenticating with the
+	// stored credentials. Updates that are not fast-forwards are rejected
+	// unless forced or leased, and the outcome is reported for each remote
+	// reference.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	200: PushRemoteOkResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/remotes/{name}/push", remote.NewPushRemoteHandler(fileSystem, credentials)).
+		Methods("POST")
+
+	// swagger:route POST /repositories/{directory}/webhooks createWebhook
+	//
+	// Add a webhook
+	//
+	// This will post a signed JSON payload to the URL whenever a reference of
+	// the repository changes in a way the webhook subscribes to.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	201: CreateWebhookCreatedResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/webhooks", webhook.NewCreateWebhookHandler(fileSystem)).
+		Methods("POST")
+
+	// swagger:route DELETE /repositories/{directory}/webhooks/{id} deleteWebhook
+	//
+	// Remove a webhook
+	//
+	// This will stop delivering the webhook and remove its deliveries.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: DeleteWebhookNoContentResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/webhooks/{id}", webhook.NewDeleteWebhookHandler(fileSystem)).
+		Methods("DELETE")
+
+	// swagger:route POST /repositories/{directory}/webhooks/{id}/deliveries/{delivery}/redeliver redeliver
+	//
+	// Redeliver a payload
+	//
+	// This will post the payload of the delivery again, as a new delivery.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	202: RedeliverAcceptedResponse
+	repositoriesWriteRouter.
+		HandleFunc(directoryPath+"/webhooks/{id}/deliveries/{delivery}/redeliver", webhook.NewRedeliverHandler(webhooks)).
+		Methods("POST")
+
+	// swagger:route DELETE /repositories/{directory} deleteRepository
+	//
+	// Delete a repository
+	//
+	// This will move the repository to the trash, where it is kept for the
+	// retention period before it is removed for good.
+	//
+	//     	Consumes:
+	//     	- application/json
+	//
+	//			Produces:
+	//			- application/json
+	//
+	//			Schemes: http
+	//
+	//			Security:
+	//				api_key:
+	//			Responses:
+	//       	204: DeleteRepositoryNoContentResponse
+	// It is registered last, so that DELETE /repositories/team/mirror deletes
+	// the mirror of team rather than a repository named team/mirror.
+	repositoriesRouter.
+		HandleFunc(directoryPath, lifecycle.NewDeleteRepositoryHandler(fileSystem, names, options.Trash, roots)).
+		Methods("DELETE")
+
 	return handlers.RecoveryHandler()(router)
 }
@@ -0,0 +1,66 @@
+package internal_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/lifecycle"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+const apiKey = "secret"
+
+func TestRootHandlerRoutesRepositoriesWhateverTheirName(t *testing.T) {
+	assert := assert.New(t)
+
+	root, _ := testutil.NewRepository(t, "team/project")
+	defer os.RemoveAll(root)
+
+	fileSystem := osfs.New("/")
+	assert.NoError(lifecycle.Init(fileSystem, filepath.Join(root, "registry"), &lifecycle.InitOptions{Readme: true}))
+	sandbox, err := git.NewSandbox(root)
+	assert.NoError(err)
+
+	handler := internal.NewRootHandler(&internal.Options{
+		FileSystem: fileSystem,
+		Sandbox:    sandbox,
+		APIKeys:    []string{apiKey},
+	})
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", apiKey)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	for _, target := range []string{
+		"/v1/repositories/team/project/references",
+		"/v1/repositories/team|project/references",
+		"/v1/repositories/registry/references",
+		"/v1/repositories/team/project.git/info/refs?service=git-upload-pack",
+		"/v1/registry",
+	} {
+		assert.Equal(http.StatusOK, serve("GET", target, "").Code, target)
+	}
+
+	res := serve("POST", "/v1/registry",
+		`{"name": "team/alias", "location": "team/project"}`)
+	assert.Equal(http.StatusCreated, res.Code, res.Body.String())
+	assert.Equal(http.StatusOK, serve("GET", "/v1/registry/team/alias", "").Code)
+	assert.Equal(http.StatusOK, serve("GET", "/v1/repositories/team/alias/references", "").Code)
+
+	// The routes under a repository are not mistaken for the repository
+	assert.Equal(http.StatusNoContent, serve("DELETE", "/v1/repositories/team/project/archive", "").Code)
+	_, err = os.Stat(filepath.Join(root, "team", "project"))
+	assert.NoError(err)
+}
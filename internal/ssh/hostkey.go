@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// LoadHostKey reads the host key stored at path. When there is none, an
+// ed25519 key is generated and saved there so that clients see the same host
+// key across restarts. An empty path keeps the generated key in memory only.
+func LoadHostKey(path string) (gossh.Signer, error) {
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			return gossh.ParsePrivateKey(data)
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		data := pem.EncodeToMemory(&pem.Block{
+			Type:  "OPENSSH PRIVATE KEY",
+			Bytes: marshalOpenSSHKey(public, private),
+		})
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	return gossh.NewSignerFromKey(private)
+}
+
+// marshalOpenSSHKey encodes an unencrypted ed25519 private key in the format
+// ssh-keygen writes, described in PROTOCOL.key of OpenSSH
+func marshalOpenSSHKey(public ed25519.PublicKey, private ed25519.PrivateKey) []byte {
+	publicKey, _ := gossh.NewPublicKey(public)
+
+	var check [4]byte
+	_, _ = rand.Read(check[:])
+
+	block := gossh.Marshal(struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Public  []byte
+		Private []byte
+		Comment string
+	}{
+		Check1:  binary.BigEndian.Uint32(check[:]),
+		Check2:  binary.BigEndian.Uint32(check[:]),
+		Keytype: gossh.KeyAlgoED25519,
+		Public:  public,
+		Private: private,
+	})
+	for i := byte(1); len(block)%8 != 0; i++ {
+		block = append(block, i)
+	}
+
+	return append([]byte("openssh-key-v1\x00"), gossh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PublicKey    []byte
+		PrivateBlock []byte
+	}{
+		CipherName:   "none",
+		KdfName:      "none",
+		NumKeys:      1,
+		PublicKey:    publicKey.Marshal(),
+		PrivateBlock: block,
+	})...)
+}
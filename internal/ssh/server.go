@@ -0,0 +1,147 @@
+// Package ssh serves git-upload-pack and git-receive-pack over SSH to clients
+// authenticated with a registered public key
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/key"
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	gliderssh "github.com/gliderlabs/ssh"
+)
+
+const keyContextKey = "key"
+
+// NewServer creates an SSH server for the repositories reader can open, that
+// publishes the references pushes change to bus
+func NewServer(reader git.Reader, keys *key.Store, bus *event.Bus) *gliderssh.Server {
+	return &gliderssh.Server{
+		Handler: NewSessionHandler(reader, bus),
+		PublicKeyHandler: func(ctx gliderssh.Context, publicKey gliderssh.PublicKey) bool {
+			registered, ok := keys.Find(publicKey)
+			if ok {
+				ctx.SetValue(keyContextKey, registered)
+			}
+
+			return ok
+		},
+	}
+}
+
+// NewSessionHandler runs the git command requested by a session
+func NewSessionHandler(reader git.Reader, bus *event.Bus) gliderssh.Handler {
+	return func(session gliderssh.Session) {
+		err := serve(reader, bus, session)
+		if err != nil {
+			fmt.Fprintf(session.Stderr(), "fatal: %s\n", err)
+			_ = session.Exit(1)
+
+			registered, _ := session.Context().Value(keyContextKey).(key.Key)
+			log.Printf("ssh: %s (%s): %s\n",
+				strings.Join(session.Command(), " "), registered.Fingerprint, err)
+			return
+		}
+
+		_ = session.Exit(0)
+	}
+}
+
+func serve(reader git.Reader, bus *event.Bus, session gliderssh.Session) error {
+	command := session.Command()
+	if len(command) != 2 {
+		return fmt.Errorf("interactive shells are not supported")
+	}
+
+	service, repositoryPath := command[0], command[1]
+	if service != protocol.UploadPackService && service != protocol.ReceivePackService {
+		return fmt.Errorf("unsupported command %s", service)
+	}
+
+	repository, repositoryPath, err := open(reader, repositoryPath)
+	if err != nil {
+		return err
+	}
+
+	if service == protocol.ReceivePackService {
+		archived, err := git.IsArchived(repository)
+		if err != nil {
+			return err
+		}
+		if archived {
+			return git.ErrArchived
+		}
+	}
+
+	version := 0
+	for _, variable := range session.Environ() {
+		if strings.HasPrefix(variable, "GIT_PROTOCOL=") {
+			version = protocol.RequestedVersion(strings.TrimPrefix(variable, "GIT_PROTOCOL="))
+		}
+	}
+
+	if service == protocol.UploadPackService {
+		return serveService(service, version, repository, session, session)
+	}
+
+	return bus.Watch(git.Locate(reader, repositoryPath), repository.Storer(), func() error {
+		return serveService(service, version, repository, session, session)
+	})
+}
+
+// open opens the repository a client asked for, and returns the path it was
+// opened by. Clients usually name it with a .git suffix, as they do with the
+// HTTP transport. ssh:// URLs send the path with a leading slash, which is
+// dropped so that it is resolved relative to the roots or as a registered
+// name, like scp-style paths.
+func open(reader git.Reader, repositoryPath string) (git.Repository, string, error) {
+	repositoryPath = strings.TrimLeft(repositoryPath, "/")
+
+	repository, err := reader.Open(repositoryPath)
+	if err == nil || !strings.HasSuffix(repositoryPath, ".git") {
+		return repository, repositoryPath, err
+	}
+
+	repositoryPath = strings.TrimSuffix(repositoryPath, ".git")
+	repository, err = reader.Open(repositoryPath)
+
+	return repository, repositoryPath, err
+}
+
+func serveService(
+	service string,
+	version int,
+	repository git.Repository,
+	reader io.Reader,
+	writer io.Writer,
+) error {
+	switch service {
+	case protocol.UploadPackService:
+		uploadPack := &protocol.UploadPack{Storer: repository.Storer()}
+		if version == 2 {
+			if err := uploadPack.AdvertiseCapabilities(writer); err != nil {
+				return err
+			}
+
+			return uploadPack.ServeCommands(reader, writer)
+		}
+
+		if err := uploadPack.AdvertiseReferences(writer); err != nil {
+			return err
+		}
+
+		return uploadPack.Serve(reader, writer)
+	default:
+		receivePack := &protocol.ReceivePack{Storer: repository.Storer()}
+		if err := receivePack.AdvertiseReferences(writer); err != nil {
+			return err
+		}
+
+		_, err := receivePack.Serve(reader, writer)
+		return err
+	}
+}
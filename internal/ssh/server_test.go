@@ -0,0 +1,150 @@
+package ssh_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/key"
+	"github.com/drdgvhbh/gitserver/internal/protocol"
+	"github.com/drdgvhbh/gitserver/internal/ssh"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+// newSigner generates a client key
+func newSigner(t *testing.T) gossh.Signer {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	signer, err := gossh.NewSignerFromKey(private)
+	assert.NoError(t, err)
+
+	return signer
+}
+
+// serve starts a server for the repositories under root, and returns its
+// address along with a function that stops it
+func serve(t *testing.T, root string, keys *key.Store) (string, func()) {
+	sandbox, err := git.NewSandbox(root)
+	assert.NoError(t, err)
+
+	server := ssh.NewServer(git.NewSandboxedReader(osfs.New("/"), sandbox), keys, event.NewBus())
+	hostKey, err := ssh.LoadHostKey("")
+	assert.NoError(t, err)
+	server.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	return listener.Addr().String(), func() {
+		_ = server.Close()
+	}
+}
+
+func dial(address string, signer gossh.Signer) (*gossh.Client, error) {
+	return gossh.Dial("tcp", address, &gossh.ClientConfig{
+		User:            "git",
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(signer)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	})
+}
+
+func TestServerRefusesUnregisteredKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, _ := testutil.NewRepository(t, "project")
+	defer os.RemoveAll(directory)
+
+	keys, err := key.NewStore("")
+	assert.NoError(err)
+	address, stop := serve(t, directory, keys)
+	defer stop()
+
+	_, err = dial(address, newSigner(t))
+	assert.Error(err)
+}
+
+func TestServerServesUploadPackToRegisteredKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, repositoryPath := testutil.NewRepository(t, "project")
+	defer os.RemoveAll(directory)
+
+	signer := newSigner(t)
+	keys, err := key.NewStore("")
+	assert.NoError(err)
+	_, err = keys.Add("ci", string(gossh.MarshalAuthorizedKey(signer.PublicKey())))
+	assert.NoError(err)
+
+	address, stop := serve(t, directory, keys)
+	defer stop()
+
+	client, err := dial(address, signer)
+	if !assert.NoError(err) {
+		return
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if !assert.NoError(err) {
+		return
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	assert.NoError(err)
+	stdout, err := session.StdoutPipe()
+	assert.NoError(err)
+	assert.NoError(session.Start("git-upload-pack '/project.git'"))
+
+	// The advertisement lists HEAD first
+	packets := protocol.NewPacketReader(stdout)
+	packet, err := packets.Read()
+	if !assert.NoError(err) {
+		return
+	}
+	fields := strings.Fields(packet.Line())
+	if !assert.True(len(fields) >= 2 && strings.HasPrefix(fields[1], "HEAD")) {
+		return
+	}
+	head := fields[0]
+	for packet.Type != protocol.FlushPacket {
+		packet, err = packets.Read()
+		if !assert.NoError(err) {
+			return
+		}
+	}
+
+	request := new(bytes.Buffer)
+	out := protocol.NewPacketWriter(request)
+	assert.NoError(out.WriteLine("want %s no-progress", head))
+	assert.NoError(out.Flush())
+	assert.NoError(out.WriteLine("done"))
+	_, err = stdin.Write(request.Bytes())
+	assert.NoError(err)
+
+	response, err := ioutil.ReadAll(stdout)
+	assert.NoError(err)
+	assert.NoError(session.Wait())
+
+	repository, err := git.NewReader(osfs.New("/")).Open(repositoryPath)
+	assert.NoError(err)
+	reference, err := repository.Head()
+	assert.NoError(err)
+	assert.Equal(reference.Hash().String(), head)
+	assert.Contains(string(response), "NAK\n")
+	assert.Contains(string(response), "PACK")
+}
@@ -0,0 +1,74 @@
+// Package testutil holds the fixtures that the tests of several packages
+// build their repositories and objects from
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// Encoder is implemented by the go-git objects, such as trees and commits
+type Encoder interface {
+	Encode(plumbing.EncodedObject) error
+}
+
+// StoreObject encodes o into storage and returns its hash
+func StoreObject(t *testing.T, storage storer.EncodedObjectStorer, o Encoder) plumbing.Hash {
+	encoded := storage.NewEncodedObject()
+	assert.NoError(t, o.Encode(encoded))
+
+	hash, err := storage.SetEncodedObject(encoded)
+	assert.NoError(t, err)
+
+	return hash
+}
+
+// StoreBlob stores a blob with the specified content and returns its hash
+func StoreBlob(t *testing.T, storage storer.EncodedObjectStorer, content string) plumbing.Hash {
+	encoded := storage.NewEncodedObject()
+	encoded.SetType(plumbing.BlobObject)
+
+	writer, err := encoded.Writer()
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	hash, err := storage.SetEncodedObject(encoded)
+	assert.NoError(t, err)
+
+	return hash
+}
+
+// StoreCommit stores a commit on top of parents whose tree holds a README.md
+// with message as its content
+func StoreCommit(
+	t *testing.T,
+	storage storer.EncodedObjectStorer,
+	message string,
+	parents ...plumbing.Hash,
+) plumbing.Hash {
+	tree := StoreObject(t, storage, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "README.md", Mode: filemode.Regular, Hash: StoreBlob(t, storage, message)},
+	}})
+
+	signature := object.Signature{
+		Name:  "Jane Doe",
+		Email: "jane@example.com",
+		When:  time.Unix(1500000000, 0).UTC(),
+	}
+
+	return StoreObject(t, storage, &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     tree,
+		ParentHashes: parents,
+	})
+}
@@ -0,0 +1,82 @@
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// NewRepository creates a repository called name under a new temporary
+// directory, with a main branch holding a README.md. The caller removes the
+// directory when it is done. When the repository cannot be created, the
+// directory is removed and the test stops.
+func NewRepository(t *testing.T, name string) (directory string, repositoryPath string) {
+	directory, err := ioutil.TempDir("", "gitserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := false
+	defer func() {
+		if !created {
+			_ = os.RemoveAll(directory)
+		}
+	}()
+
+	// Temporary directories can be reached through symbolic links, while
+	// repositories are reported by their real path
+	resolved, err := filepath.EvalSymlinks(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory = resolved
+
+	repositoryPath = filepath.Join(directory, name)
+	if err := initRepository(repositoryPath); err != nil {
+		t.Fatal(err)
+	}
+
+	created = true
+	return directory, repositoryPath
+}
+
+func initRepository(path string) error {
+	repository, err := gogit.PlainInit(path, false)
+	if err != nil {
+		return err
+	}
+
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName("main"))
+	if err := repository.Storer.SetReference(head); err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(path, "README.md"), []byte("# "+filepath.Base(path)+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return err
+	}
+	if _, err := worktree.Add("README.md"); err != nil {
+		return err
+	}
+
+	_, err = worktree.Commit("Initial commit", &gogit.CommitOptions{
+		Author: &object.Signature{
+			Name:  "Jane Doe",
+			Email: "jane@example.com",
+			When:  time.Unix(1500000000, 0).UTC(),
+		},
+	})
+
+	return err
+}
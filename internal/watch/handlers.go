@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+)
+
+// keepAlive is how often a comment is sent on quiet streams, so that proxies
+// do not close them
+const keepAlive = 15 * time.Second
+
+// reconnectDelay is how long clients wait before reconnecting to a closed
+// stream
+const reconnectDelay = 3 * time.Second
+
+// A stream of server-sent events, one for each change. The event name is the
+// type of the change, and its data is the change as JSON.
+// swagger:response StreamEventsOkResponse
+type StreamEventsOkResponse struct {
+	// in: body
+	Body []Change
+}
+
+// NewStreamEventsHandler streams the changes of a repository as server-sent
+// events until the client goes away
+func NewStreamEventsHandler(watcher *Watcher) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		flusher, ok := writer.(http.Flusher)
+		if !ok {
+			response.WriteError(writer, http.StatusInternalServerError, errors.New("streaming is not supported"))
+			return
+		}
+
+		changes, stop, err := watcher.Subscribe(mux.Vars(request)["directory"])
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+		defer stop()
+
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Header().Set("Cache-Control", "no-cache")
+		// Buffering proxies would hold the events back
+		writer.Header().Set("X-Accel-Buffering", "no")
+		writer.WriteHeader(http.StatusOK)
+		if _, err := fmt.Fprintf(writer, "retry: %d\n\n", reconnectDelay/time.Millisecond); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+
+		for id := 1; ; {
+			select {
+			case <-request.Context().Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(writer, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case change, ok := <-changes:
+				if !ok {
+					return
+				}
+
+				data, err := json.Marshal(change)
+				if err != nil {
+					panic(err)
+				}
+				if _, err := fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", id, change.Type, data); err != nil {
+					return
+				}
+				id++
+			}
+			flusher.Flush()
+		}
+	}
+}
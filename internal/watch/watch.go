@@ -0,0 +1,370 @@
+// Package watch notices the changes of repositories that clients display:
+// their references, HEAD, index and worktree. Repositories are polled, and
+// polled right away when the event bus reports that their references changed.
+// Files that git ignores are not watched.
+package watch
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+)
+
+// The types of changes
+const (
+	// References means branches, tags or other references changed
+	References = "references"
+	// Head means HEAD points somewhere else
+	Head = "head"
+	// Index means the staging area changed
+	Index = "index"
+	// Worktree means files of the worktree were added, removed or modified
+	Worktree = "worktree"
+)
+
+type Change struct {
+	// The type of the change: references, head, index or worktree
+	//
+	// required: true
+	// example: references
+	Type string `json:"type"`
+
+	// The references that changed, for references changes
+	References []event.Change `json:"references,omitempty"`
+
+	// The reference or hash HEAD points to, for head changes
+	//
+	// example: refs/heads/master
+	Head string `json:"head,omitempty"`
+
+	// When the change was noticed
+	//
+	// required: true
+	// example: 2019-05-26T12:41:18-04:00
+	At string `json:"at"`
+}
+
+// state is what changes are noticed in
+type state struct {
+	references map[plumbing.ReferenceName]plumbing.Hash
+	head       string
+	index      string
+	worktree   string
+}
+
+// read captures the state of a repository
+func read(repository git.Repository) (*state, error) {
+	references, err := event.Snapshot(repository.Storer())
+	if err != nil {
+		return nil, err
+	}
+
+	current := &state{references: references}
+
+	head, err := repository.Storer().Reference(plumbing.HEAD)
+	switch {
+	case err == plumbing.ErrReferenceNotFound:
+	case err != nil:
+		return nil, err
+	case head.Type() == plumbing.SymbolicReference:
+		current.head = head.Target().String()
+	default:
+		current.head = head.Hash().String()
+	}
+
+	var excludes []gitignore.Pattern
+	if gitDirectory := repository.GitDirectory(); gitDirectory != nil {
+		info, err := gitDirectory.Stat("index")
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			current.index = stamp(info)
+		}
+
+		excludes, err = readPatterns(gitDirectory, "info/exclude", nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if worktree := repository.Worktree(); worktree != nil {
+		digest := sha1.New()
+		if err := walk(worktree, nil, excludes, digest); err != nil {
+			return nil, err
+		}
+		current.worktree = hex.EncodeToString(digest.Sum(nil))
+	}
+
+	return current, nil
+}
+
+// stamp identifies the content of a file without reading it
+func stamp(info os.FileInfo) string {
+	return fmt.Sprintf("%s %d %s %d", info.Name(), info.Size(), info.Mode(), info.ModTime().UnixNano())
+}
+
+// readPatterns reads the ignore patterns of a file, which apply under domain
+func readPatterns(fileSystem billy.Filesystem, name string, domain []string) ([]gitignore.Pattern, error) {
+	file, err := fileSystem.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []gitignore.Pattern
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+	}
+
+	return patterns, nil
+}
+
+// walk writes the stamps of the files under directory to digest, leaving out
+// the git directory and the files that git ignores
+func walk(
+	fileSystem billy.Filesystem,
+	directory []string,
+	patterns []gitignore.Pattern,
+	digest hash.Hash,
+) error {
+	ignores, err := readPatterns(fileSystem, path.Join(append(directory, ".gitignore")...), directory)
+	if err != nil {
+		return err
+	}
+	// Patterns of subdirectories must not leak into their siblings
+	patterns = append(patterns[:len(patterns):len(patterns)], ignores...)
+	matcher := gitignore.NewMatcher(patterns)
+
+	infos, err := fileSystem.ReadDir(path.Join(directory...))
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		name := append(directory[:len(directory):len(directory)], info.Name())
+		if path.Join(name...) == ".git" || matcher.Match(name, info.IsDir()) {
+			continue
+		}
+
+		fmt.Fprintf(digest, "%s\x00%s\n", path.Join(name...), stamp(info))
+		if info.IsDir() {
+			if err := walk(fileSystem, name, patterns, digest); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// diff returns the changes between two states
+func diff(before, after *state, at time.Time) []Change {
+	var changes []Change
+	timestamp := at.Format(time.RFC3339)
+
+	if references := event.Diff(before.references, after.references); len(references) > 0 {
+		changes = append(changes, Change{Type: References, References: references, At: timestamp})
+	}
+	if before.head != after.head {
+		changes = append(changes, Change{Type: Head, Head: after.head, At: timestamp})
+	}
+	if before.index != after.index {
+		changes = append(changes, Change{Type: Index, At: timestamp})
+	}
+	if before.worktree != after.worktree {
+		changes = append(changes, Change{Type: Worktree, At: timestamp})
+	}
+
+	return changes
+}
+
+// subscriberBuffer is how many changes a subscriber can fall behind by before
+// it is dropped
+const subscriberBuffer = 16
+
+// Watcher notices the changes of repositories. The subscribers of a
+// repository share a single poller.
+type Watcher struct {
+	reader   git.Reader
+	bus      *event.Bus
+	interval time.Duration
+
+	mutex   sync.Mutex
+	pollers map[string]*poller
+}
+
+// poller polls a repository for its subscribers
+type poller struct {
+	path        string
+	repository  git.Repository
+	subscribers map[chan Change]bool
+	poke        chan struct{}
+	done        chan struct{}
+	unsubscribe func()
+	stopped     bool
+}
+
+// NewWatcher creates a watcher for the repositories reader can open, that
+// polls them every interval
+func NewWatcher(reader git.Reader, bus *event.Bus, interval time.Duration) *Watcher {
+	return &Watcher{
+		reader:   reader,
+		bus:      bus,
+		interval: interval,
+		pollers:  make(map[string]*poller),
+	}
+}
+
+// Subscribe starts watching the repository by the name. Its changes are sent
+// on the returned channel until stop is called. The channel is closed when
+// the repository can no longer be read, or when the subscriber falls too far
+// behind.
+func (watcher *Watcher) Subscribe(name string) (changes <-chan Change, stop func(), err error) {
+	repository, err := watcher.reader.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	repositoryPath := git.Locate(watcher.reader, name)
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	p, ok := watcher.pollers[repositoryPath]
+	if !ok {
+		current, err := read(repository)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		p = &poller{
+			path:        repositoryPath,
+			repository:  repository,
+			subscribers: make(map[chan Change]bool),
+			poke:        make(chan struct{}, 1),
+			done:        make(chan struct{}),
+		}
+		p.unsubscribe = watcher.bus.Subscribe(func(changed event.Event) {
+			if changed.Repository != repositoryPath {
+				return
+			}
+			select {
+			case p.poke <- struct{}{}:
+			default:
+			}
+		})
+		watcher.pollers[repositoryPath] = p
+		go watcher.poll(p, current)
+	}
+
+	sent := make(chan Change, subscriberBuffer)
+	p.subscribers[sent] = true
+
+	var once sync.Once
+	return sent, func() { once.Do(func() { watcher.unsubscribe(p, sent) }) }, nil
+}
+
+// unsubscribe removes a subscriber, and stops the poller once it has none
+func (watcher *Watcher) unsubscribe(p *poller, sent chan Change) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	if p.subscribers[sent] {
+		delete(p.subscribers, sent)
+		close(sent)
+	}
+	if len(p.subscribers) == 0 {
+		watcher.stop(p)
+	}
+}
+
+// stop stops a poller and closes the channels of its subscribers. The mutex
+// must be held.
+func (watcher *Watcher) stop(p *poller) {
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+
+	p.unsubscribe()
+	close(p.done)
+	delete(watcher.pollers, p.path)
+	for sent := range p.subscribers {
+		delete(p.subscribers, sent)
+		close(sent)
+	}
+}
+
+// poll reads the repository every interval, and when the bus reports that
+// its references changed, and sends the changes to the subscribers
+func (watcher *Watcher) poll(p *poller, current *state) {
+	ticker := time.NewTicker(watcher.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		case <-p.poke:
+		}
+
+		next, err := read(p.repository)
+		if err != nil {
+			log.Printf("watch: %s: %s\n", p.path, err)
+			watcher.mutex.Lock()
+			watcher.stop(p)
+			watcher.mutex.Unlock()
+			return
+		}
+
+		changes := diff(current, next, time.Now())
+		current = next
+		if len(changes) == 0 {
+			continue
+		}
+
+		watcher.mutex.Lock()
+		for sent := range p.subscribers {
+			for _, change := range changes {
+				select {
+				case sent <- change:
+					continue
+				default:
+				}
+
+				// A subscriber that falls behind is dropped rather than
+				// holding back the others
+				delete(p.subscribers, sent)
+				close(sent)
+				break
+			}
+		}
+		watcher.mutex.Unlock()
+	}
+}
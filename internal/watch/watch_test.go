@@ -0,0 +1,151 @@
+package watch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/testutil"
+	"github.com/drdgvhbh/gitserver/internal/watch"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// next returns the next change, failing when there is none in time
+func next(t *testing.T, changes <-chan watch.Change) watch.Change {
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change was noticed")
+		return watch.Change{}
+	}
+}
+
+func TestWatcherNoticesChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, repositoryPath := testutil.NewRepository(t, "project")
+	defer os.RemoveAll(directory)
+
+	watcher := watch.NewWatcher(git.NewReader(osfs.New("/")), event.NewBus(), 10*time.Millisecond)
+	changes, stop, err := watcher.Subscribe(repositoryPath)
+	assert.NoError(err)
+	defer stop()
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(repositoryPath, "notes.txt"), []byte("notes\n"), 0644))
+	assert.Equal(watch.Worktree, next(t, changes).Type)
+
+	wrapee, err := gogit.PlainOpen(repositoryPath)
+	assert.NoError(err)
+	worktree, err := wrapee.Worktree()
+	assert.NoError(err)
+	_, err = worktree.Add("notes.txt")
+	assert.NoError(err)
+	assert.Equal(watch.Index, next(t, changes).Type)
+
+	head, err := wrapee.Head()
+	assert.NoError(err)
+	assert.NoError(wrapee.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature", head.Hash())))
+	change := next(t, changes)
+	assert.Equal(watch.References, change.Type)
+	assert.Equal([]event.Change{{
+		Reference: "refs/heads/feature",
+		Before:    plumbing.ZeroHash.String(),
+		After:     head.Hash().String(),
+	}}, change.References)
+
+	assert.NoError(wrapee.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/feature")))
+	change = next(t, changes)
+	assert.Equal(watch.Head, change.Type)
+	assert.Equal("refs/heads/feature", change.Head)
+}
+
+func TestWatcherPollsWhenTheBusReportsChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, repositoryPath := testutil.NewRepository(t, "project")
+	defer os.RemoveAll(directory)
+
+	bus := event.NewBus()
+	watcher := watch.NewWatcher(git.NewReader(osfs.New("/")), bus, time.Hour)
+	changes, stop, err := watcher.Subscribe(repositoryPath)
+	assert.NoError(err)
+
+	wrapee, err := gogit.PlainOpen(repositoryPath)
+	assert.NoError(err)
+	assert.NoError(bus.Watch(repositoryPath, wrapee.Storer, func() error {
+		return wrapee.Storer.RemoveReference("refs/heads/main")
+	}))
+
+	change := next(t, changes)
+	assert.Equal(watch.References, change.Type)
+	assert.Len(change.References, 1)
+	assert.True(change.References[0].IsDelete())
+
+	stop()
+	stop()
+	_, ok := <-changes
+	assert.False(ok)
+}
+
+func TestSubscribersShareAPoller(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, repositoryPath := testutil.NewRepository(t, "project")
+	defer os.RemoveAll(directory)
+
+	watcher := watch.NewWatcher(git.NewReader(osfs.New("/")), event.NewBus(), 10*time.Millisecond)
+	first, stopFirst, err := watcher.Subscribe(repositoryPath)
+	assert.NoError(err)
+	second, stopSecond, err := watcher.Subscribe(repositoryPath)
+	assert.NoError(err)
+	defer stopSecond()
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(repositoryPath, "notes.txt"), []byte("notes\n"), 0644))
+	assert.Equal(watch.Worktree, next(t, first).Type)
+	assert.Equal(watch.Worktree, next(t, second).Type)
+
+	// The others keep being sent changes when one stops
+	stopFirst()
+	_, ok := <-first
+	assert.False(ok)
+
+	assert.NoError(os.Remove(filepath.Join(repositoryPath, "notes.txt")))
+	assert.Equal(watch.Worktree, next(t, second).Type)
+}
+
+func TestWatcherIgnoresIgnoredFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	directory, repositoryPath := testutil.NewRepository(t, "project")
+	defer os.RemoveAll(directory)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(repositoryPath, ".gitignore"), []byte("*.log\n"), 0644))
+	assert.NoError(os.MkdirAll(filepath.Join(repositoryPath, ".git", "info"), 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(repositoryPath, ".git", "info", "exclude"), []byte("build/\n"), 0644))
+
+	watcher := watch.NewWatcher(git.NewReader(osfs.New("/")), event.NewBus(), 10*time.Millisecond)
+	changes, stop, err := watcher.Subscribe(repositoryPath)
+	assert.NoError(err)
+	defer stop()
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(repositoryPath, "debug.log"), []byte("debug\n"), 0644))
+	assert.NoError(os.MkdirAll(filepath.Join(repositoryPath, "build"), 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(repositoryPath, "build", "output"), []byte("output\n"), 0644))
+
+	select {
+	case change := <-changes:
+		t.Fatalf("an ignored file was noticed: %s", change.Type)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(repositoryPath, "notes.txt"), []byte("notes\n"), 0644))
+	assert.Equal(watch.Worktree, next(t, changes).Type)
+}
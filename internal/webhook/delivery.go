@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"gopkg.in/src-d/go-billy.v4"
+)
+
+// deliveriesDirectory holds a log of deliveries for each webhook, in the git
+// directory of the repository
+const deliveriesDirectory = "webhooks"
+
+// maxDeliveries is how many deliveries are kept for each webhook
+const maxDeliveries = 100
+
+// ErrDeliveryNotFound is returned when a webhook has no delivery with the
+// requested identifier
+var ErrDeliveryNotFound = errors.New("delivery does not exist")
+
+// The status of a delivery
+const (
+	// DeliveryPending means the payload is being delivered
+	DeliveryPending = "pending"
+	// DeliverySucceeded means the URL responded with a 2xx status
+	DeliverySucceeded = "succeeded"
+	// DeliveryFailed means every attempt to deliver the payload failed
+	DeliveryFailed = "failed"
+)
+
+// deliveriesMutex serializes every read-modify-write of a delivery log
+var deliveriesMutex sync.Mutex
+
+type Delivery struct {
+	// The identifier of the delivery
+	//
+	// required: true
+	// example: 5f0c6f3e-7d5e-4c6a-9a43-2e3b6f5d8c21
+	ID string `json:"id"`
+
+	// The event type that was delivered
+	//
+	// required: true
+	// example: push
+	Event string `json:"event"`
+
+	// The reference that changed
+	//
+	// required: true
+	// example: refs/heads/master
+	Reference string `json:"reference"`
+
+	// One of pending, succeeded or failed
+	//
+	// required: true
+	// example: succeeded
+	Status string `json:"status"`
+
+	// How many times delivering the payload was attempted
+	//
+	// required: true
+	// example: 1
+	Attempts int `json:"attempts"`
+
+	// The status code the URL last responded with
+	//
+	// example: 200
+	StatusCode int `json:"statusCode,omitempty"`
+
+	// Why the last attempt failed
+	Error string `json:"error,omitempty"`
+
+	// When the delivery was created
+	//
+	// required: true
+	// example: 2019-05-26T12:41:18-04:00
+	CreatedAt string `json:"createdAt"`
+
+	// When delivering the payload was last attempted
+	//
+	// example: 2019-05-26T12:41:19-04:00
+	AttemptedAt string `json:"attemptedAt,omitempty"`
+
+	// The delivery this one delivers the payload of again
+	//
+	// example: 0c5f2d0e-8d0b-4f5e-9d36-6b1f3c1e2a7b
+	RedeliveryOf string `json:"redeliveryOf,omitempty"`
+
+	// The payload that was posted
+	//
+	// required: true
+	Payload json.RawMessage `json:"payload"`
+}
+
+// deliveryLog keeps the deliveries of a webhook, newest first
+type deliveryLog struct {
+	fileSystem billy.Filesystem
+	file       string
+}
+
+func openLog(repository git.Repository, id string) (*deliveryLog, error) {
+	gitDirectory := repository.GitDirectory()
+	if gitDirectory == nil {
+		return nil, errors.New("repository is not stored on a filesystem")
+	}
+
+	return &deliveryLog{
+		fileSystem: gitDirectory,
+		file:       path.Join(deliveriesDirectory, id+".json"),
+	}, nil
+}
+
+func (log *deliveryLog) load() ([]Delivery, error) {
+	file, err := log.fileSystem.Open(log.file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []Delivery
+	if err := json.Unmarshal(data, &deliveries); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (log *deliveryLog) save(deliveries []Delivery) error {
+	data, err := json.MarshalIndent(deliveries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := log.fileSystem.MkdirAll(path.Dir(log.file), 0755); err != nil {
+		return err
+	}
+
+	file, err := log.fileSystem.Create(log.file)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// add records a delivery, dropping the oldest ones past maxDeliveries
+func (log *deliveryLog) add(delivery Delivery) error {
+	deliveriesMutex.Lock()
+	defer deliveriesMutex.Unlock()
+
+	deliveries, err := log.load()
+	if err != nil {
+		return err
+	}
+
+	deliveries = append([]Delivery{delivery}, deliveries...)
+	if len(deliveries) > maxDeliveries {
+		deliveries = deliveries[:maxDeliveries]
+	}
+
+	return log.save(deliveries)
+}
+
+// update changes the delivery with the identifier. Deliveries that were
+// dropped from the log meanwhile are left alone.
+func (log *deliveryLog) update(id string, change func(*Delivery)) error {
+	deliveriesMutex.Lock()
+	defer deliveriesMutex.Unlock()
+
+	deliveries, err := log.load()
+	if err != nil {
+		return err
+	}
+
+	for i := range deliveries {
+		if deliveries[i].ID == id {
+			change(&deliveries[i])
+			return log.save(deliveries)
+		}
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the deliveries of the webhook with the identifier,
+// newest first
+func ListDeliveries(repository git.Repository, id string) ([]Delivery, error) {
+	if _, err := Read(repository, id); err != nil {
+		return nil, err
+	}
+
+	log, err := openLog(repository, id)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveriesMutex.Lock()
+	defer deliveriesMutex.Unlock()
+
+	deliveries, err := log.load()
+	if deliveries == nil && err == nil {
+		deliveries = []Delivery{}
+	}
+
+	return deliveries, err
+}
+
+// FindDelivery returns the delivery of the webhook by its identifier
+func FindDelivery(repository git.Repository, id string, deliveryID string) (*Delivery, error) {
+	deliveries, err := ListDeliveries(repository, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range deliveries {
+		if deliveries[i].ID == deliveryID {
+			return &deliveries[i], nil
+		}
+	}
+
+	return nil, ErrDeliveryNotFound
+}
+
+func removeDeliveries(repository git.Repository, id string) error {
+	if repository.GitDirectory() == nil {
+		return nil
+	}
+
+	log, err := openLog(repository, id)
+	if err != nil {
+		return err
+	}
+
+	deliveriesMutex.Lock()
+	defer deliveriesMutex.Unlock()
+
+	err = log.fileSystem.Remove(log.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/drdgvhbh/gitserver/internal/discovery"
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/google/uuid"
+)
+
+const (
+	// deliveryAttempts is how many times a payload is posted before its
+	// delivery fails
+	deliveryAttempts = 5
+	// maxDeliveryBackoff caps the delay between attempts
+	maxDeliveryBackoff = 5 * time.Minute
+	// deliveryTimeout bounds each attempt
+	deliveryTimeout = 10 * time.Second
+)
+
+// The headers payloads are posted with
+const (
+	// EventHeader holds the event type
+	EventHeader = "X-Gitserver-Event"
+	// DeliveryHeader holds the identifier of the delivery
+	DeliveryHeader = "X-Gitserver-Delivery"
+	// SignatureHeader holds sha256= followed by the hexadecimal HMAC-SHA256
+	// of the payload, keyed with the secret of the webhook
+	SignatureHeader = "X-Gitserver-Signature-256"
+)
+
+// Dispatcher delivers the webhooks of repositories whose references change.
+// Failed attempts are retried with an exponential backoff.
+type Dispatcher struct {
+	reader  git.Reader
+	scanner *discovery.Scanner
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewDispatcher creates a dispatcher for the repositories reader can open,
+// that first retries a failed attempt after backoff. Payloads name
+// repositories the way scanner lists them.
+func NewDispatcher(
+	reader git.Reader,
+	scanner *discovery.Scanner,
+	backoff time.Duration,
+) *Dispatcher {
+	return &Dispatcher{
+		reader:  reader,
+		scanner: scanner,
+		client:  &http.Client{Timeout: deliveryTimeout},
+		backoff: backoff,
+	}
+}
+
+// Handle delivers the webhooks of the repository of the event. It is meant
+// to be subscribed to the event bus.
+func (dispatcher *Dispatcher) Handle(changed event.Event) {
+	go func() {
+		if err := dispatcher.handle(changed); err != nil {
+			log.Printf("webhook: %s: %s\n", changed.Repository, err)
+		}
+	}()
+}
+
+func (dispatcher *Dispatcher) handle(changed event.Event) error {
+	repository, err := dispatcher.reader.Open(changed.Repository)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := ReadAll(repository)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	for _, change := range changed.Changes {
+		var payload *Payload
+		for _, eventType := range eventTypes(change) {
+			for i := range webhooks {
+				if !webhooks[i].subscribes(eventType) {
+					continue
+				}
+
+				if payload == nil {
+					payload, err = newPayload(
+						dispatcher.scanner.Name(changed.Repository), repository, change)
+					if err != nil {
+						return err
+					}
+				}
+				payload.Event = eventType
+				body, err := json.Marshal(payload)
+				if err != nil {
+					return err
+				}
+
+				_, err = dispatcher.dispatch(changed.Repository, repository, webhooks[i].ID, Delivery{
+					Event:     eventType,
+					Reference: change.Reference,
+					Payload:   body,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Redeliver posts the payload of a delivery of the webhook with the
+// identifier again, as a new delivery
+func (dispatcher *Dispatcher) Redeliver(
+	repositoryPath string,
+	id string,
+	deliveryID string,
+) (*Delivery, error) {
+	repository, err := dispatcher.reader.Open(repositoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	delivered, err := FindDelivery(repository, id, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	return dispatcher.dispatch(git.Locate(dispatcher.reader, repositoryPath), repository, id, Delivery{
+		Event:        delivered.Event,
+		Reference:    delivered.Reference,
+		RedeliveryOf: delivered.ID,
+		Payload:      delivered.Payload,
+	})
+}
+
+// dispatch records a pending delivery, and starts delivering it
+func (dispatcher *Dispatcher) dispatch(
+	repositoryPath string,
+	repository git.Repository,
+	id string,
+	delivery Delivery,
+) (*Delivery, error) {
+	deliveries, err := openLog(repository, id)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.ID = uuid.New().String()
+	delivery.Status = DeliveryPending
+	delivery.CreatedAt = time.Now().Format(time.RFC3339)
+	if err := deliveries.add(delivery); err != nil {
+		return nil, err
+	}
+
+	go dispatcher.deliver(repositoryPath, id, delivery)
+
+	return &delivery, nil
+}
+
+// deliver posts the payload until the URL accepts it or the attempts run out,
+// recording each attempt. It stops when the webhook is removed.
+func (dispatcher *Dispatcher) deliver(repositoryPath string, id string, delivery Delivery) {
+	backoff := dispatcher.backoff
+	for attempt := 1; ; attempt++ {
+		repository, err := dispatcher.reader.Open(repositoryPath)
+		if err != nil {
+			log.Printf("webhook: %s: %s\n", repositoryPath, err)
+			return
+		}
+		webhook, err := Read(repository, id)
+		if err != nil {
+			if err != ErrWebhookNotFound {
+				log.Printf("webhook: %s: %s: %s\n", repositoryPath, id, err)
+			}
+			return
+		}
+
+		statusCode, postErr := dispatcher.post(webhook, &delivery)
+
+		deliveries, err := openLog(repository, id)
+		if err == nil {
+			err = deliveries.update(delivery.ID, func(recorded *Delivery) {
+				recorded.Attempts = attempt
+				recorded.StatusCode = statusCode
+				recorded.AttemptedAt = time.Now().Format(time.RFC3339)
+				recorded.Error = ""
+				switch {
+				case postErr == nil:
+					recorded.Status = DeliverySucceeded
+				case attempt == deliveryAttempts:
+					recorded.Status = DeliveryFailed
+					recorded.Error = postErr.Error()
+				default:
+					recorded.Error = postErr.Error()
+				}
+			})
+		}
+		if err != nil {
+			log.Printf("webhook: %s: %s: %s\n", repositoryPath, id, err)
+		}
+
+		if postErr == nil || attempt == deliveryAttempts {
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxDeliveryBackoff {
+			backoff = maxDeliveryBackoff
+		}
+	}
+}
+
+// post posts the payload of the delivery to the URL of the webhook, and
+// returns the status code it responded with
+func (dispatcher *Dispatcher) post(webhook *Webhook, delivery *Delivery) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, webhook.url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "gitserver-webhook")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	if webhook.secret != "" {
+		request.Header.Set(SignatureHeader, Sign(webhook.secret, delivery.Payload))
+	}
+
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("the URL responded with %s", response.Status)
+	}
+
+	return response.StatusCode, nil
+}
+
+// Sign returns the signature header of a payload signed with secret, so that
+// receivers can check it came from the server
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/response"
+	"github.com/gorilla/mux"
+)
+
+// List of webhooks of the repository
+// swagger:response GetWebhooksOkResponse
+type GetWebhooksOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Webhook `json:"data,omitempty"`
+	}
+}
+
+// The created webhook
+// swagger:response CreateWebhookCreatedResponse
+type CreateWebhookCreatedResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Webhook `json:"data,omitempty"`
+	}
+}
+
+// The webhook and its deliveries were removed
+// swagger:response DeleteWebhookNoContentResponse
+type DeleteWebhookNoContentResponse struct{}
+
+// List of deliveries of the webhook, newest first
+// swagger:response GetDeliveriesOkResponse
+type GetDeliveriesOKResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Delivery `json:"data,omitempty"`
+	}
+}
+
+// The delivery that posts the payload again
+// swagger:response RedeliverAcceptedResponse
+type RedeliverAcceptedResponse struct {
+	// in: body
+	Body struct {
+		response.Base
+		// The response data
+		//
+		// required: true
+		Data []Delivery `json:"data,omitempty"`
+	}
+}
+
+// swagger:parameters deleteWebhook listDeliveries redeliver
+type WebhookParams struct {
+	// The identifier of the webhook
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// swagger:parameters redeliver
+type DeliveryParams struct {
+	// The identifier of the delivery
+	//
+	// in: path
+	// required: true
+	Delivery string `json:"delivery"`
+}
+
+// swagger:parameters createWebhook
+type CreateWebhookParams struct {
+	// in: body
+	// required: true
+	Body CreateWebhookRequest
+}
+
+type CreateWebhookRequest struct {
+	// The URL payloads are posted to
+	//
+	// required: true
+	// example: https://ci.example.com/hooks/gitserver
+	URL string `json:"url"`
+
+	// The secret payloads are signed with. It is never returned.
+	//
+	// example: 7f3b9c1e5a
+	Secret string `json:"secret"`
+
+	// The event types to deliver: push, create or delete. It defaults to
+	// push.
+	//
+	// example: ["push", "delete"]
+	Events []string `json:"events"`
+}
+
+// NewGetWebhooksHandler lists the webhooks of a repository
+func NewGetWebhooksHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		repository, _ := reader.Open(mux.Vars(request)["directory"])
+
+		webhooks, err := ReadAll(repository)
+		if err != nil {
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := make([]interface{}, len(webhooks))
+		for i := range webhooks {
+			data[i] = webhooks[i]
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewCreateWebhookHandler adds a webhook to a repository
+func NewCreateWebhookHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var body CreateWebhookRequest
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		}
+
+		repository, _ := reader.Open(mux.Vars(request)["directory"])
+
+		webhook, err := Add(repository, body.URL, body.Secret, body.Events)
+		switch err {
+		case nil:
+		case ErrInvalidURL, ErrUnknownEvent:
+			response.WriteError(writer, http.StatusBadRequest, err)
+			return
+		default:
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		dataPayload := response.Payload{
+			Data: []interface{}{webhook},
+		}
+		writer.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewDeleteWebhookHandler removes a webhook and its deliveries
+func NewDeleteWebhookHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		err := Remove(repository, vars["id"])
+		switch err {
+		case nil:
+		case ErrWebhookNotFound:
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		default:
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewGetDeliveriesHandler lists the deliveries of a webhook, newest first
+func NewGetDeliveriesHandler(reader git.Reader) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+		repository, _ := reader.Open(vars["directory"])
+
+		deliveries, err := ListDeliveries(repository, vars["id"])
+		switch err {
+		case nil:
+		case ErrWebhookNotFound:
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		default:
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		data := make([]interface{}, len(deliveries))
+		for i := range deliveries {
+			data[i] = deliveries[i]
+		}
+
+		dataPayload := response.Payload{
+			Data: data,
+		}
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// NewRedeliverHandler posts the payload of a delivery again
+func NewRedeliverHandler(dispatcher *Dispatcher) func(http.ResponseWriter, *http.Request) {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		vars := mux.Vars(request)
+
+		delivery, err := dispatcher.Redeliver(vars["directory"], vars["id"], vars["delivery"])
+		switch err {
+		case nil:
+		case ErrWebhookNotFound, ErrDeliveryNotFound:
+			response.WriteError(writer, http.StatusNotFound, err)
+			return
+		default:
+			response.WriteError(writer, http.StatusInternalServerError, err)
+			return
+		}
+
+		dataPayload := response.Payload{
+			Data: []interface{}{delivery},
+		}
+		writer.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(writer).Encode(&dataPayload); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"github.com/drdgvhbh/gitserver/internal/event"
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/drdgvhbh/gitserver/internal/repository/commit"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// maxCommits caps the commits a payload summarizes
+const maxCommits = 20
+
+type Payload struct {
+	// The event type
+	//
+	// required: true
+	// example: push
+	Event string `json:"event"`
+
+	// The registered name of the repository, or its path relative to its
+	// root
+	//
+	// required: true
+	// example: team/project
+	Repository string `json:"repository"`
+
+	// The reference that changed
+	//
+	// required: true
+	// example: refs/heads/master
+	Reference string `json:"reference"`
+
+	// The hash the reference pointed to, zero when it was created
+	//
+	// required: true
+	// example: 0000000000000000000000000000000000000000
+	Before string `json:"before"`
+
+	// The hash the reference points to, zero when it was deleted
+	//
+	// required: true
+	// example: 2b9dd4a8d0e7e1d4f4ae2ee1b4c1d0d4b3f5c6e7
+	After string `json:"after"`
+
+	// Whether the reference was created
+	//
+	// required: true
+	Created bool `json:"created"`
+
+	// Whether the reference was deleted
+	//
+	// required: true
+	Deleted bool `json:"deleted"`
+
+	// The commits the reference gained, newest first. For created
+	// references, the commits no other branch has. At most 20 are listed.
+	//
+	// required: true
+	Commits []commit.Commit `json:"commits"`
+}
+
+// eventTypes returns the event types a change is delivered for
+func eventTypes(change event.Change) []string {
+	switch {
+	case change.IsDelete():
+		return []string{EventDelete}
+	case change.IsCreate():
+		return []string{EventPush, EventCreate}
+	default:
+		return []string{EventPush}
+	}
+}
+
+// newPayload describes the change of a reference of the repository named
+// name, for every event type
+func newPayload(name string, repository git.Repository, change event.Change) (*Payload, error) {
+	payload := &Payload{
+		Repository: name,
+		Reference:  change.Reference,
+		Before:     change.Before,
+		After:      change.After,
+		Created:    change.IsCreate(),
+		Deleted:    change.IsDelete(),
+		Commits:    []commit.Commit{},
+	}
+	if payload.Deleted {
+		return payload, nil
+	}
+
+	s := repository.Storer()
+	snapshot, err := event.Snapshot(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// The commits that were there before are left out: those of the previous
+	// hash, or those of the other branches for new references
+	var known []plumbing.Hash
+	if payload.Created {
+		for name, hash := range snapshot {
+			if name.IsBranch() && name.String() != change.Reference {
+				known = append(known, hash)
+			}
+		}
+	} else {
+		known = append(known, plumbing.NewHash(change.Before))
+	}
+	seen, err := ancestors(s, known)
+	if err != nil {
+		return nil, err
+	}
+
+	references := make(map[string][]string)
+	for name, hash := range snapshot {
+		references[hash.String()] = append(references[hash.String()], name.String())
+	}
+
+	after, err := object.GetCommit(s, plumbing.NewHash(change.After))
+	if err == plumbing.ErrObjectNotFound || err == object.ErrUnsupportedObject {
+		// Tags of trees and blobs have no history
+		return payload, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = object.NewCommitPreorderIter(after, seen, nil).ForEach(func(c *object.Commit) error {
+		if len(payload.Commits) == maxCommits {
+			return storer.ErrStop
+		}
+
+		payload.Commits = append(payload.Commits,
+			commit.New(&git.GitCommit{Wrapee: c}, references[c.Hash.String()]))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// ancestors returns the commits reachable from the hashes. Hashes that are
+// not commits are skipped.
+func ancestors(s storer.EncodedObjectStorer, hashes []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	seen := make(map[plumbing.Hash]bool)
+	for _, hash := range hashes {
+		if seen[hash] {
+			continue
+		}
+
+		start, err := object.GetCommit(s, hash)
+		if err != nil {
+			continue
+		}
+
+		err = object.NewCommitPreorderIter(start, seen, nil).ForEach(func(c *object.Commit) error {
+			seen[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return seen, nil
+}
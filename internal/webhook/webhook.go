@@ -0,0 +1,190 @@
+// Package webhook tells external services about the references of
+// repositories that change, by posting signed JSON payloads to their URLs
+package webhook
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/drdgvhbh/gitserver/internal/git"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrWebhookNotFound is returned when a repository has no webhook with
+	// the requested identifier
+	ErrWebhookNotFound = errors.New("webhook does not exist")
+	// ErrInvalidURL is returned for webhook URLs that are not absolute http
+	// or https URLs
+	ErrInvalidURL = errors.New("webhook URLs must be absolute http or https URLs")
+	// ErrUnknownEvent is returned when subscribing a webhook to an event type
+	// that does not exist
+	ErrUnknownEvent = errors.New("webhook events must be push, create or delete")
+)
+
+// The event types webhooks subscribe to
+const (
+	// EventPush is delivered when a reference is created or moved
+	EventPush = "push"
+	// EventCreate is delivered when a reference is created
+	EventCreate = "create"
+	// EventDelete is delivered when a reference is deleted
+	EventDelete = "delete"
+)
+
+// webhookPrefix prefixes the identifier of a webhook to make up the
+// subsection of git.ConfigSection it is configured in
+const webhookPrefix = "webhook."
+
+type Webhook struct {
+	// The identifier of the webhook
+	//
+	// required: true
+	// example: 1b4e28ba-2fa1-41d2-883f-0016d3cca427
+	ID string `json:"id"`
+
+	// The URL payloads are posted to, with its password redacted
+	//
+	// required: true
+	// example: https://ci.example.com/hooks/gitserver
+	URL string `json:"url"`
+
+	// The event types the webhook is delivered for
+	//
+	// required: true
+	// example: ["push"]
+	Events []string `json:"events"`
+
+	// Whether payloads are signed with a secret
+	//
+	// required: true
+	// example: true
+	Signed bool `json:"signed"`
+
+	url    string
+	secret string
+}
+
+// subscribes tells whether the webhook is delivered for the event type
+func (webhook *Webhook) subscribes(eventType string) bool {
+	for _, subscribed := range webhook.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadAll returns the webhooks of the repository, sorted by identifier
+func ReadAll(repository git.Repository) ([]Webhook, error) {
+	cfg, err := repository.Storer().Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []Webhook
+	for _, subsection := range cfg.Raw.Section(git.ConfigSection).Subsections {
+		if !strings.HasPrefix(subsection.Name, webhookPrefix) {
+			continue
+		}
+
+		webhooks = append(webhooks, Webhook{
+			ID:     strings.TrimPrefix(subsection.Name, webhookPrefix),
+			URL:    git.RedactURL(subsection.Option("url")),
+			Events: subsection.Options.GetAll("event"),
+			Signed: subsection.Option("secret") != "",
+			url:    subsection.Option("url"),
+			secret: subsection.Option("secret"),
+		})
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].ID < webhooks[j].ID
+	})
+
+	return webhooks, nil
+}
+
+// Read returns the webhook of the repository with the identifier
+func Read(repository git.Repository, id string) (*Webhook, error) {
+	webhooks, err := ReadAll(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range webhooks {
+		if webhooks[i].ID == id {
+			return &webhooks[i], nil
+		}
+	}
+
+	return nil, ErrWebhookNotFound
+}
+
+// Add makes the repository deliver the event types to rawURL, signing the
+// payloads with secret unless it is empty. Without event types, the webhook
+// is delivered for pushes.
+func Add(repository git.Repository, rawURL string, secret string, events []string) (*Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	if len(events) == 0 {
+		events = []string{EventPush}
+	}
+	for _, eventType := range events {
+		if eventType != EventPush && eventType != EventCreate && eventType != EventDelete {
+			return nil, ErrUnknownEvent
+		}
+	}
+
+	s := repository.Storer()
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	subsection := cfg.Raw.Section(git.ConfigSection).Subsection(webhookPrefix + id)
+	subsection.SetOption("url", rawURL)
+	if secret != "" {
+		subsection.SetOption("secret", secret)
+	}
+	subsection.SetOption("event", events...)
+
+	if err := s.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return Read(repository, id)
+}
+
+// Remove stops delivering the webhook with the identifier, and removes its
+// deliveries
+func Remove(repository git.Repository, id string) error {
+	if _, err := Read(repository, id); err != nil {
+		return err
+	}
+
+	s := repository.Storer()
+	cfg, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Raw.RemoveSubsection(git.ConfigSection, webhookPrefix+id)
+	section := cfg.Raw.Section(git.ConfigSection)
+	if len(section.Options) == 0 && len(section.Subsections) == 0 {
+		cfg.Raw.RemoveSection(git.ConfigSection)
+	}
+
+	if err := s.SetConfig(cfg); err != nil {
+		return err
+	}
+
+	return removeDeliveries(repository, id)
+}
@@ -0,0 +1,42 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+type CloneARepoOverHTTPTestSuite struct {
+	simpleTestSuite
+}
+
+func (suite *CloneARepoOverHTTPTestSuite) TestCloneRepository() {
+	testServer := suite.testServer
+	basePath := suite.basePath
+
+	defer testServer.Close()
+
+	repository, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: fmt.Sprintf("%s/v1/repositories/%s.git", testServer.URL, basePath),
+		Auth: &http.BasicAuth{
+			Username: "git",
+			Password: "e8b8dc29-d1d9-495d-b509-4dde3701018b",
+		},
+	})
+	suite.NoError(err)
+
+	head, err := repository.Head()
+	suite.NoError(err)
+
+	suite.Assert().Equal(
+		"be50985852e7aadc4392fb4809f3f9e265a92694",
+		head.Hash().String())
+}
+
+func TestCloneARepoOverHTTPTestSuite(t *testing.T) {
+	suite.Run(t, new(CloneARepoOverHTTPTestSuite))
+}
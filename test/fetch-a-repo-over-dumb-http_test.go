@@ -0,0 +1,62 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type FetchARepoOverDumbHTTPTestSuite struct {
+	simpleTestSuite
+}
+
+func (suite *FetchARepoOverDumbHTTPTestSuite) get(path string) (*http.Response, string) {
+	req, err := http.NewRequest("GET", fmt.Sprintf(
+		"%s/v1/repositories/%s.git%s", suite.testServer.URL, suite.basePath, path), nil)
+	suite.NoError(err)
+	req.Header.Add("Authorization", "e8b8dc29-d1d9-495d-b509-4dde3701018b")
+
+	resp, err := suite.testServer.Client().Do(req)
+	suite.NoError(err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	suite.NoError(err)
+
+	return resp, string(body)
+}
+
+func (suite *FetchARepoOverDumbHTTPTestSuite) TestListReferences() {
+	defer suite.testServer.Close()
+
+	resp, body := suite.get("/info/refs")
+
+	suite.Assert().Equal(http.StatusOK, resp.StatusCode)
+	suite.Assert().Contains(body,
+		"be50985852e7aadc4392fb4809f3f9e265a92694\trefs/heads/master\n")
+	suite.Assert().NotContains(body, "HEAD")
+}
+
+func (suite *FetchARepoOverDumbHTTPTestSuite) TestReadHead() {
+	defer suite.testServer.Close()
+
+	resp, body := suite.get("/HEAD")
+
+	suite.Assert().Equal(http.StatusOK, resp.StatusCode)
+	suite.Assert().Equal("ref: refs/heads/master\n", body)
+}
+
+func (suite *FetchARepoOverDumbHTTPTestSuite) TestMissingObjectIsNotFound() {
+	defer suite.testServer.Close()
+
+	resp, _ := suite.get("/objects/00/00000000000000000000000000000000000000")
+
+	suite.Assert().Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func TestFetchARepoOverDumbHTTPTestSuite(t *testing.T) {
+	suite.Run(t, new(FetchARepoOverDumbHTTPTestSuite))
+}
@@ -0,0 +1,47 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ListContainingReferencesTestSuite struct {
+	simpleTestSuite
+}
+
+func (suite *ListContainingReferencesTestSuite) TestListReferencesContainingACommit() {
+	testServer := suite.testServer
+	basePath := suite.basePath
+	currentDir := suite.currentDir
+
+	defer testServer.Close()
+
+	reqURL, err := url.Parse(
+		fmt.Sprintf("%s/v1/repositories/%s/commits/a7170f7640bb9b9960fe8a20b4454f71f98c423d/containing", testServer.URL, basePath))
+	suite.NoError(err)
+
+	req, err := http.NewRequest("GET", reqURL.String(), nil)
+	suite.NoError(err)
+
+	data := executeRequest(testServer, req, suite)
+
+	testDataFilePath := fmt.Sprintf(
+		"%s/test-responses/list-containing-references-simple.json",
+		currentDir)
+	testData, err := ioutil.ReadFile(testDataFilePath)
+	suite.NoError(err)
+
+	suite.Assert().JSONEq(
+		string(testData),
+		string(data),
+	)
+}
+
+func TestListContainingReferencesTestSuite(t *testing.T) {
+	suite.Run(t, new(ListContainingReferencesTestSuite))
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+type PushToARepoOverHTTPTestSuite struct {
+	simpleTestSuite
+}
+
+func (suite *PushToARepoOverHTTPTestSuite) TestPushNewBranch() {
+	testServer := suite.testServer
+	clonePath := suite.clonePath
+
+	defer testServer.Close()
+
+	remoteURL := fmt.Sprintf("%s/v1/repositories/%s.git", testServer.URL, clonePath)
+	auth := &githttp.BasicAuth{
+		Username: "git",
+		Password: "e8b8dc29-d1d9-495d-b509-4dde3701018b",
+	}
+
+	repository, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL:  remoteURL,
+		Auth: auth,
+	})
+	suite.NoError(err)
+
+	err = repository.Push(&git.PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/pushed"},
+		Auth:     auth,
+	})
+	suite.NoError(err)
+
+	reqURL, err := url.Parse(
+		fmt.Sprintf("%s/v1/repositories/%s/references", testServer.URL, clonePath))
+	suite.NoError(err)
+
+	req, err := http.NewRequest("GET", reqURL.String(), nil)
+	suite.NoError(err)
+
+	data := executeRequest(testServer, req, suite)
+
+	suite.Assert().Contains(string(data),
+		`{"hash":"be50985852e7aadc4392fb4809f3f9e265a92694","name":"refs/heads/pushed"}`)
+}
+
+func (suite *PushToARepoOverHTTPTestSuite) TestDeleteCurrentBranchIsRejected() {
+	testServer := suite.testServer
+	clonePath := suite.clonePath
+
+	defer testServer.Close()
+
+	remoteURL := fmt.Sprintf("%s/v1/repositories/%s.git", testServer.URL, clonePath)
+	auth := &githttp.BasicAuth{
+		Username: "git",
+		Password: "e8b8dc29-d1d9-495d-b509-4dde3701018b",
+	}
+
+	repository, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL:  remoteURL,
+		Auth: auth,
+	})
+	suite.NoError(err)
+
+	err = repository.Push(&git.PushOptions{
+		RefSpecs: []config.RefSpec{":refs/heads/master"},
+		Auth:     auth,
+	})
+	suite.Error(err)
+}
+
+func TestPushToARepoOverHTTPTestSuite(t *testing.T) {
+	suite.Run(t, new(PushToARepoOverHTTPTestSuite))
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/drdgvhbh/gitserver/internal"
+	"github.com/drdgvhbh/gitserver/internal/key"
 	"github.com/drdgvhbh/gitserver/internal/response"
 	"github.com/stretchr/testify/suite"
 	"gopkg.in/src-d/go-billy.v4"
@@ -26,6 +27,7 @@ type simpleTestSuite struct {
 	rootHandler http.Handler
 	testServer  *httptest.Server
 	basePath    string
+	clonePath   string
 	currentDir  string
 }
 
@@ -41,18 +43,28 @@ func (suite *simpleTestSuite) SetupTest() {
 	err = vm.cloneRepositoryFrom(repoLocation)
 	suite.NoError(err)
 
-	rootHandler := internal.NewRootHandler(osfs.New(""))
+	keys, err := key.NewStore("")
+	suite.NoError(err)
+
+	rootHandler := internal.NewRootHandler(&internal.Options{
+		FileSystem: osfs.New(""),
+		Keys:       keys,
+		APIKeys:    []string{"e8b8dc29-d1d9-495d-b509-4dde3701018b"},
+	})
 	testServer := httptest.NewServer(rootHandler)
 
 	basePath := fmt.Sprintf("%s", strings.Replace(repoLocation, "/", "|", -1))
+	clonePath := strings.Replace(vm.directory, "/", "|", -1)
 
 	suite.rootHandler = rootHandler
 	suite.testServer = testServer
 	suite.basePath = basePath
+	suite.clonePath = clonePath
 	suite.currentDir = path.Dir(repoLocation)
 }
 
 type virtualMachine struct {
+	directory  string
 	fileSystem billy.Filesystem
 	storage    *filesystem.Storage
 }
@@ -79,6 +91,7 @@ func createVirtualMachine() (*virtualMachine, error) {
 		filesystem.Options{KeepDescriptors: true})
 
 	return &virtualMachine{
+		directory:  directory,
 		fileSystem: fs,
 		storage:    storage,
 	}, nil